@@ -1,23 +1,37 @@
 package misp
 
+import (
+	"encoding/json"
+	"fmt"
+)
+
 // Attribute represents a MISP attribute
 type Attribute struct {
-	Comment            string `json:"comment,omitempty"`
-	ID                 string `json:"id,omitempty"`
-	EventID            string `json:"event_id,omitempty"`
-	Distribution       string `json:"distribution,omitempty"`
-	ObjectID           string `json:"object_id,omitempty"`
-	ObjectRelation     string `json:"object_relation,omitempty"`
-	DisableCorrelation bool   `json:"disable_correlation,omitempty"`
-	Deleted            bool   `json:"deleted,omitempty"`
-	Filename           string `json:"filename,omitempty"`
-	Type               string `json:"type,omitempty"`
-	Timestamp          string `json:"timestamp,omitempty"`
-	Value              string `json:"value,omitempty"`
-	SharingGroupID     string `json:"sharing_group_id,omitempty"`
-	Category           string `json:"category,omitempty"`
-	UUID               string `json:"uuid,omitempty"`
-	ToIDS              bool   `json:"to_ids,omitempty"`
+	Comment            string     `json:"comment,omitempty"`
+	ID                 string     `json:"id,omitempty"`
+	EventID            string     `json:"event_id,omitempty"`
+	Distribution       string     `json:"distribution,omitempty"`
+	ObjectID           string     `json:"object_id,omitempty"`
+	ObjectRelation     string     `json:"object_relation,omitempty"`
+	DisableCorrelation bool       `json:"disable_correlation,omitempty"`
+	Deleted            bool       `json:"deleted,omitempty"`
+	Filename           string     `json:"filename,omitempty"`
+	Type               string     `json:"type,omitempty"`
+	Timestamp          string     `json:"timestamp,omitempty"`
+	Value              string     `json:"value,omitempty"`
+	SharingGroupID     string     `json:"sharing_group_id,omitempty"`
+	Category           string     `json:"category,omitempty"`
+	UUID               string     `json:"uuid,omitempty"`
+	ToIDS              bool       `json:"to_ids,omitempty"`
+	FirstSeen          string     `json:"first_seen,omitempty"`
+	LastSeen           string     `json:"last_seen,omitempty"`
+	Data               string     `json:"data,omitempty"` // base64 encoded content of attachments and malware samples
+	Tags               []Tag      `json:"Tag,omitempty"`
+	Galaxies           []Galaxy   `json:"Galaxy,omitempty"`
+	Sightings          []Sighting `json:"Sighting,omitempty"`
+
+	// Fields unknown to this package, kept by ReadEvent for WriteEvent
+	Extra map[string]json.RawMessage `json:"-"`
 }
 
 // AddTag adds a tag to this attribute
@@ -39,3 +53,51 @@ func (a *Attribute) AddTag(client Client, tagName string) error {
 
 	return nil
 }
+
+// AddAttribute adds an attribute to the event identified by eventID and returns
+// the attribute as stored by MISP
+func (client *Client) AddAttribute(eventID string, attr *Attribute) (*Attribute, error) {
+	type attrType struct {
+		Attribute Attribute `json:"Attribute"`
+	}
+
+	path := fmt.Sprintf("/attributes/add/%s", eventID)
+
+	resp, err := client.Post(path, attr)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result attrType
+	decoder := json.NewDecoder(resp.Body)
+	if err = decoder.Decode(&result); err != nil {
+		return nil, fmt.Errorf("Could not unmarshal attribute: %s", err)
+	}
+
+	return &result.Attribute, nil
+}
+
+// AddAttributes adds several attributes to the event identified by eventID in
+// a single request
+func (client *Client) AddAttributes(eventID string, attrs []Attribute) ([]Attribute, error) {
+	type attrsType struct {
+		Attribute []Attribute `json:"Attribute"`
+	}
+
+	path := fmt.Sprintf("/attributes/add/%s", eventID)
+
+	resp, err := client.Post(path, attrs)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result attrsType
+	decoder := json.NewDecoder(resp.Body)
+	if err = decoder.Decode(&result); err != nil {
+		return nil, fmt.Errorf("Could not unmarshal attributes: %s", err)
+	}
+
+	return result.Attribute, nil
+}
@@ -0,0 +1,267 @@
+package misp
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CSVExportColumns are the columns of MISP's CSV export of attributes
+var CSVExportColumns = []string{
+	"uuid", "event_id", "category", "type", "value", "comment", "to_ids", "date",
+	"object_relation", "attribute_tag", "object_uuid", "object_name", "object_meta_category",
+}
+
+// CSVReader reads attributes from CSV files, such as spreadsheets of
+// indicators or MISP's own CSV export
+type CSVReader struct {
+	// 1-based columns of each attribute field, 0 meaning the field is absent.
+	// Only the value column is mandatory.
+	UUIDColumn     int
+	ValueColumn    int
+	TypeColumn     int
+	CategoryColumn int
+	ToIDSColumn    int
+	CommentColumn  int
+	TagsColumn     int
+
+	// The first line holds the column names. When no column is configured,
+	// they are found from these names: uuid, value, type, category, to_ids,
+	// comment and tags or attribute_tag.
+	Header bool
+
+	// Field delimiter, by default a comma, and separator of the tags of the
+	// tags column, by default a comma as well
+	Delimiter    rune
+	TagSeparator string
+}
+
+// csvHeaderColumns maps the column names recognized in headers to the
+// CSVReader fields
+var csvHeaderColumns = map[string]func(r *CSVReader) *int{
+	"uuid":          func(r *CSVReader) *int { return &r.UUIDColumn },
+	"value":         func(r *CSVReader) *int { return &r.ValueColumn },
+	"type":          func(r *CSVReader) *int { return &r.TypeColumn },
+	"category":      func(r *CSVReader) *int { return &r.CategoryColumn },
+	"to_ids":        func(r *CSVReader) *int { return &r.ToIDSColumn },
+	"comment":       func(r *CSVReader) *int { return &r.CommentColumn },
+	"tags":          func(r *CSVReader) *int { return &r.TagsColumn },
+	"attribute_tag": func(r *CSVReader) *int { return &r.TagsColumn },
+}
+
+// Read returns the attributes of the CSV data. Attributes without category
+// get the default category and IDS flag of their type.
+//
+// When there is no type column, or the type cell is empty, the type is
+// detected with ExtractIndicators, and a cell holding several indicators gives
+// one attribute per indicator; cells without indicator are skipped. Invalid
+// types and categories are reported with their line number.
+func (r *CSVReader) Read(in io.Reader) ([]Attribute, error) {
+	reader := csv.NewReader(in)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	if r.Delimiter != 0 {
+		reader.Comma = r.Delimiter
+	}
+
+	columns := *r
+	if columns.TagSeparator == "" {
+		columns.TagSeparator = ","
+	}
+
+	var attrs []Attribute
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Could not parse CSV: %s", err)
+		}
+
+		if line == 1 && r.Header {
+			if columns.ValueColumn == 0 {
+				for i, name := range record {
+					if field, ok := csvHeaderColumns[strings.ToLower(strings.TrimSpace(name))]; ok {
+						*field(&columns) = i + 1
+					}
+				}
+			}
+			if columns.ValueColumn == 0 {
+				return nil, fmt.Errorf("No value column in CSV header")
+			}
+			continue
+		}
+		if columns.ValueColumn == 0 {
+			columns.ValueColumn = 1
+		}
+
+		lineAttrs, err := columns.readRecord(record)
+		if err != nil {
+			return nil, fmt.Errorf("Line %d: %s", line, err)
+		}
+		attrs = append(attrs, lineAttrs...)
+	}
+
+	return attrs, nil
+}
+
+func (r *CSVReader) readRecord(record []string) ([]Attribute, error) {
+	cell := func(column int) string {
+		if column < 1 || column > len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[column-1])
+	}
+
+	value := cell(r.ValueColumn)
+	if value == "" {
+		return nil, nil
+	}
+
+	template := Attribute{
+		UUID:     cell(r.UUIDColumn),
+		Type:     cell(r.TypeColumn),
+		Category: cell(r.CategoryColumn),
+		Comment:  cell(r.CommentColumn),
+	}
+	for _, name := range strings.Split(cell(r.TagsColumn), r.TagSeparator) {
+		if name = strings.TrimSpace(name); name != "" {
+			template.Tags = append(template.Tags, Tag{Name: name})
+		}
+	}
+
+	var attrs []Attribute
+	if template.Type == "" {
+		for _, detected := range ExtractIndicators(value) {
+			attr := template
+			attr.Type = detected.Type
+			attr.Value = detected.Value
+			attrs = append(attrs, attr)
+		}
+		// The UUID only identifies a single attribute
+		if len(attrs) > 1 {
+			for i := range attrs {
+				attrs[i].UUID = ""
+			}
+		}
+	} else {
+		template.Value = value
+		attrs = []Attribute{template}
+	}
+
+	toIDS := cell(r.ToIDSColumn)
+	for i := range attrs {
+		attr := &attrs[i]
+		if !DefaultDescribeTypes.IsValidType(attr.Type) {
+			return nil, fmt.Errorf("Unknown attribute type %q", attr.Type)
+		}
+		if attr.Category != "" && !DefaultDescribeTypes.IsValidCombination(attr.Category, attr.Type) {
+			return nil, fmt.Errorf("Invalid category %q for type %q", attr.Category, attr.Type)
+		}
+		if attr.UUID == "" {
+			attr.UUID = newUUID()
+		}
+
+		DefaultDescribeTypes.ApplyDefaults(attr)
+		if toIDS != "" {
+			attr.ToIDS = parseCSVBool(toIDS)
+		} else {
+			attr.ToIDS = DefaultDescribeTypes.DefaultToIDS(attr.Type)
+		}
+	}
+
+	return attrs, nil
+}
+
+func parseCSVBool(value string) bool {
+	switch strings.ToLower(value) {
+	case "1", "true", "yes", "y", "x":
+		return true
+	}
+	return false
+}
+
+// WriteCSV writes attributes in MISP's CSV export format, see
+// CSVExportColumns. The object columns are left empty, see WriteEventsCSV.
+func WriteCSV(w io.Writer, attrs []Attribute) error {
+	writer := csv.NewWriter(w)
+	writer.Write(CSVExportColumns)
+	for i := range attrs {
+		writer.Write(csvRecord(&attrs[i], nil))
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("Could not write CSV: %s", err)
+	}
+	return nil
+}
+
+// WriteEventsCSV writes the attributes of events, including those of their
+// objects, in MISP's CSV export format. Deleted attributes and objects are
+// left out.
+func WriteEventsCSV(w io.Writer, events []Event) error {
+	writer := csv.NewWriter(w)
+	writer.Write(CSVExportColumns)
+	for _, event := range events {
+		for _, attr := range event.Attribute {
+			if attr.Deleted {
+				continue
+			}
+			attr.EventID = defaultString(attr.EventID, event.ID)
+			writer.Write(csvRecord(&attr, nil))
+		}
+		for i, object := range event.Objects {
+			if object.Deleted {
+				continue
+			}
+			for _, attr := range object.Attributes {
+				if attr.Deleted {
+					continue
+				}
+				attr.EventID = defaultString(attr.EventID, event.ID)
+				writer.Write(csvRecord(&attr, &event.Objects[i]))
+			}
+		}
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("Could not write CSV: %s", err)
+	}
+	return nil
+}
+
+// csvRecord returns the CSV export columns of an attribute, object being the
+// object holding it if any
+func csvRecord(attr *Attribute, object *Object) []string {
+	toIDS := "0"
+	if attr.ToIDS {
+		toIDS = "1"
+	}
+
+	date := ""
+	if ts, err := strconv.ParseInt(attr.Timestamp, 10, 64); err == nil {
+		date = time.Unix(ts, 0).UTC().Format("20060102")
+	}
+
+	tags := make([]string, len(attr.Tags))
+	for i, tag := range attr.Tags {
+		tags[i] = tag.Name
+	}
+
+	var objectUUID, objectName, objectMetaCategory string
+	if object != nil {
+		objectUUID, objectName, objectMetaCategory = object.UUID, object.Name, object.MetaCategory
+	}
+
+	return []string{
+		attr.UUID, attr.EventID, attr.Category, attr.Type, attr.Value, attr.Comment, toIDS, date,
+		attr.ObjectRelation, strings.Join(tags, ","), objectUUID, objectName, objectMetaCategory,
+	}
+}
@@ -0,0 +1,82 @@
+package misp
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func Test_CSVReader(t *testing.T) {
+	// Spreadsheet without type column, value in the second column
+	reader := &CSVReader{ValueColumn: 2, CommentColumn: 3, TagsColumn: 4, Delimiter: ';', TagSeparator: "|"}
+	attrs, err := reader.Read(strings.NewReader(`# exported by the SOC
+1;hxxp://evil[.]com/gate.php;C2 panel;tlp:amber|kill-chain:c2
+2;68b329da9893e34099c7d8ad5cb9c940;dropper;
+3;;empty;
+`))
+	if err != nil {
+		t.Fatalf("Read returned error: %s", err)
+	}
+
+	if len(attrs) != 2 {
+		t.Fatalf("Expected 2 attributes, got %+v", attrs)
+	}
+	if attr := attrs[0]; attr.Type != TypeURL || attr.Value != "http://evil.com/gate.php" || attr.Comment != "C2 panel" ||
+		attr.Category != CategoryNetworkActivity || !attr.ToIDS || len(attr.Tags) != 2 || attr.Tags[1].Name != "kill-chain:c2" {
+		t.Errorf("Unexpected attribute %+v", attr)
+	}
+	if attr := attrs[1]; attr.Type != TypeMD5 || attr.UUID == "" {
+		t.Errorf("Unexpected attribute %+v", attr)
+	}
+
+	// Columns found from the header
+	reader = &CSVReader{Header: true}
+	attrs, err = reader.Read(strings.NewReader("Type,Value,To_IDS,Category\n" +
+		"ip-dst,203.0.113.7,0,Network activity\n" +
+		"text,some notes,,\n"))
+	if err != nil {
+		t.Fatalf("Read returned error: %s", err)
+	}
+	if len(attrs) != 2 || attrs[0].Type != TypeIPDst || attrs[0].ToIDS || attrs[1].Category != CategoryOther {
+		t.Errorf("Unexpected attributes %+v", attrs)
+	}
+
+	_, err = reader.Read(strings.NewReader("type,value,category\nip-dst,203.0.113.7,Network activity\nmd5,68b329da9893e34099c7d8ad5cb9c940,Network activity\n"))
+	if err == nil || !strings.Contains(err.Error(), "Line 3") {
+		t.Errorf("Expected error on line 3, got %v", err)
+	}
+}
+
+func Test_WriteEventsCSV(t *testing.T) {
+	object := NewObject("domain-ip", "network")
+	object.AddAttribute("domain", TypeDomain, "evil.com").Category = CategoryNetworkActivity
+	events := []Event{{
+		ID: "42",
+		Attribute: []Attribute{
+			{UUID: "5a1b1d2e-0c54-4e2b-a1c7-000000000001", Type: TypeIPDst, Category: CategoryNetworkActivity, Value: "203.0.113.7",
+				ToIDS: true, Timestamp: "1488553830", Comment: "C2, port 443", Tags: []Tag{{Name: "tlp:green"}, {Name: "c2"}}},
+			{Type: TypeText, Value: "deleted", Deleted: true},
+		},
+		Objects: []Object{*object},
+	}}
+
+	var buf bytes.Buffer
+	if err := WriteEventsCSV(&buf, events); err != nil {
+		t.Fatalf("WriteEventsCSV returned error: %s", err)
+	}
+
+	want := strings.Join(CSVExportColumns, ",") + "\n" +
+		`5a1b1d2e-0c54-4e2b-a1c7-000000000001,42,Network activity,ip-dst,203.0.113.7,"C2, port 443",1,20170303,,"tlp:green,c2",,,` + "\n" +
+		object.Attributes[0].UUID + ",42,Network activity,domain,evil.com,,0,,domain,," + object.UUID + ",domain-ip,network\n"
+	if buf.String() != want {
+		t.Errorf("Expected:\n%s\ngot:\n%s", want, buf.String())
+	}
+
+	attrs, err := (&CSVReader{Header: true}).Read(&buf)
+	if err != nil {
+		t.Fatalf("Read returned error on exported CSV: %s", err)
+	}
+	if len(attrs) != 2 || attrs[0].UUID != "5a1b1d2e-0c54-4e2b-a1c7-000000000001" || attrs[0].Comment != "C2, port 443" || len(attrs[0].Tags) != 2 {
+		t.Errorf("Unexpected attributes %+v", attrs)
+	}
+}
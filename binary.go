@@ -0,0 +1,253 @@
+package misp
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"debug/elf"
+	"debug/pe"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// BinaryObjects holds the MISP objects describing a local binary, as produced
+// by PyMISP's make_binary_objects: a file object, an optional pe or elf object
+// referenced from it, and one section object per section of the binary.
+type BinaryObjects struct {
+	File     *Object
+	Binary   *Object   // pe or elf object, nil if the format was not recognized
+	Sections []*Object // pe-section or elf-section objects
+}
+
+// Objects returns all generated objects, ready to be appended to Event.Objects
+func (b *BinaryObjects) Objects() []Object {
+	objects := []Object{*b.File}
+	if b.Binary != nil {
+		objects = append(objects, *b.Binary)
+	}
+	for _, section := range b.Sections {
+		objects = append(objects, *section)
+	}
+	return objects
+}
+
+// MakeBinaryObjects parses the given PE or ELF binary and generates the
+// file, pe/elf and section objects describing it. Files that are neither PE
+// nor ELF only get a file object.
+func MakeBinaryObjects(filename string) (*BinaryObjects, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading %s: %s", filename, err)
+	}
+
+	result := &BinaryObjects{
+		File: makeFileObject(filepath.Base(filename), data),
+	}
+
+	if peFile, err := pe.NewFile(bytes.NewReader(data)); err == nil {
+		result.Binary, result.Sections, err = makePEObjects(peFile)
+		if err != nil {
+			return nil, err
+		}
+		result.File.AddReference(result.Binary.UUID, "includes")
+	} else if elfFile, err := elf.NewFile(bytes.NewReader(data)); err == nil {
+		result.Binary, result.Sections, err = makeELFObjects(elfFile)
+		if err != nil {
+			return nil, err
+		}
+		result.File.AddReference(result.Binary.UUID, "includes")
+	}
+
+	return result, nil
+}
+
+func makeFileObject(filename string, data []byte) *Object {
+	object := NewObject("file", "file")
+	object.AddAttribute("filename", "filename", filename)
+	object.AddAttribute("size-in-bytes", "size-in-bytes", strconv.Itoa(len(data)))
+	object.AddAttribute("entropy", "float", formatEntropy(data))
+	addHashAttributes(object, data)
+
+	return object
+}
+
+func makePEObjects(f *pe.File) (*Object, []*Object, error) {
+	object := NewObject("pe", "file")
+
+	var entrypoint uint32
+	var subsystem uint16
+	switch header := f.OptionalHeader.(type) {
+	case *pe.OptionalHeader32:
+		entrypoint = header.AddressOfEntryPoint
+		subsystem = header.Subsystem
+	case *pe.OptionalHeader64:
+		entrypoint = header.AddressOfEntryPoint
+		subsystem = header.Subsystem
+	}
+
+	switch {
+	case f.Characteristics&pe.IMAGE_FILE_DLL != 0:
+		object.AddAttribute("type", "text", "dll")
+	case subsystem == pe.IMAGE_SUBSYSTEM_NATIVE:
+		object.AddAttribute("type", "text", "driver")
+	case f.Characteristics&pe.IMAGE_FILE_EXECUTABLE_IMAGE != 0:
+		object.AddAttribute("type", "text", "exe")
+	default:
+		object.AddAttribute("type", "text", "unknown")
+	}
+
+	object.AddAttribute("entrypoint-address", "text", strconv.FormatUint(uint64(entrypoint), 10))
+	object.AddAttribute("compilation-timestamp", "datetime",
+		time.Unix(int64(f.TimeDateStamp), 0).UTC().Format(time.RFC3339))
+	object.AddAttribute("number-sections", "counter", strconv.Itoa(len(f.Sections)))
+
+	imphash, err := peImphash(f)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Error computing imphash: %s", err)
+	}
+	object.AddAttribute("imphash", "imphash", imphash)
+
+	var sections []*Object
+	for i, s := range f.Sections {
+		if entrypoint >= s.VirtualAddress && entrypoint < s.VirtualAddress+s.VirtualSize {
+			object.AddAttribute("entrypoint-section-at-position", "text", fmt.Sprintf("%s|%d", s.Name, i))
+		}
+
+		data, err := s.Data()
+		if err != nil {
+			return nil, nil, fmt.Errorf("Error reading section %s: %s", s.Name, err)
+		}
+
+		section := NewObject("pe-section", "file")
+		section.AddAttribute("name", "text", s.Name)
+		section.AddAttribute("size-in-bytes", "size-in-bytes", strconv.Itoa(len(data)))
+		section.AddAttribute("virtual_address", "hex", fmt.Sprintf("0x%x", s.VirtualAddress))
+		section.AddAttribute("virtual_size", "size-in-bytes", strconv.FormatUint(uint64(s.VirtualSize), 10))
+		if len(data) > 0 {
+			section.AddAttribute("entropy", "float", formatEntropy(data))
+			addHashAttributes(section, data)
+		}
+
+		object.AddReference(section.UUID, "includes")
+		sections = append(sections, section)
+	}
+
+	return object, sections, nil
+}
+
+// peImphash computes the import hash of a PE file the way pefile does. Imports
+// by ordinal are not reported by debug/pe, hence are not part of the hash.
+func peImphash(f *pe.File) (string, error) {
+	symbols, err := f.ImportedSymbols()
+	if err != nil {
+		return "", err
+	}
+	if len(symbols) == 0 {
+		return "", nil
+	}
+
+	imports := make([]string, 0, len(symbols))
+	for _, symbol := range symbols {
+		// debug/pe returns "function:library"
+		parts := strings.SplitN(symbol, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		library := strings.ToLower(parts[1])
+		for _, ext := range []string{".dll", ".ocx", ".sys"} {
+			if strings.HasSuffix(library, ext) {
+				library = strings.TrimSuffix(library, ext)
+				break
+			}
+		}
+		imports = append(imports, library+"."+strings.ToLower(parts[0]))
+	}
+
+	sum := md5.Sum([]byte(strings.Join(imports, ",")))
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func makeELFObjects(f *elf.File) (*Object, []*Object, error) {
+	object := NewObject("elf", "file")
+	object.AddAttribute("type", "text", strings.TrimPrefix(f.Type.String(), "ET_"))
+	object.AddAttribute("entrypoint-address", "text", strconv.FormatUint(f.Entry, 10))
+	object.AddAttribute("arch", "text", strings.TrimPrefix(f.Machine.String(), "EM_"))
+	object.AddAttribute("os_abi", "text", strings.TrimPrefix(f.OSABI.String(), "ELFOSABI_"))
+	object.AddAttribute("number-sections", "counter", strconv.Itoa(len(f.Sections)))
+
+	var sections []*Object
+	for _, s := range f.Sections {
+		if s.Type == elf.SHT_NULL {
+			continue
+		}
+
+		section := NewObject("elf-section", "file")
+		section.AddAttribute("name", "text", s.Name)
+		section.AddAttribute("type", "text", strings.TrimPrefix(s.Type.String(), "SHT_"))
+		section.AddAttribute("size-in-bytes", "size-in-bytes", strconv.FormatUint(s.Size, 10))
+		section.AddAttribute("offset", "hex", fmt.Sprintf("0x%x", s.Offset))
+		section.AddAttribute("virtual_address", "hex", fmt.Sprintf("0x%x", s.Addr))
+
+		if s.Type != elf.SHT_NOBITS && s.Size > 0 {
+			data, err := s.Data()
+			if err != nil {
+				return nil, nil, fmt.Errorf("Error reading section %s: %s", s.Name, err)
+			}
+			section.AddAttribute("entropy", "float", formatEntropy(data))
+			addHashAttributes(section, data)
+		}
+
+		object.AddReference(section.UUID, "includes")
+		sections = append(sections, section)
+	}
+
+	return object, sections, nil
+}
+
+func addHashAttributes(object *Object, data []byte) {
+	md5Sum := md5.Sum(data)
+	sha1Sum := sha1.Sum(data)
+	sha256Sum := sha256.Sum256(data)
+	sha512Sum := sha512.Sum512(data)
+
+	object.AddAttribute("md5", "md5", hex.EncodeToString(md5Sum[:]))
+	object.AddAttribute("sha1", "sha1", hex.EncodeToString(sha1Sum[:]))
+	object.AddAttribute("sha256", "sha256", hex.EncodeToString(sha256Sum[:]))
+	object.AddAttribute("sha512", "sha512", hex.EncodeToString(sha512Sum[:]))
+}
+
+// entropy computes the Shannon entropy of data, in bits per byte
+func entropy(data []byte) float64 {
+	if len(data) == 0 {
+		return 0
+	}
+
+	var counts [256]int
+	for _, b := range data {
+		counts[b]++
+	}
+
+	var result float64
+	for _, count := range counts {
+		if count == 0 {
+			continue
+		}
+		p := float64(count) / float64(len(data))
+		result -= p * math.Log2(p)
+	}
+
+	return result
+}
+
+func formatEntropy(data []byte) string {
+	return strconv.FormatFloat(entropy(data), 'f', -1, 64)
+}
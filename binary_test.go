@@ -0,0 +1,180 @@
+package misp
+
+import (
+	"bytes"
+	"debug/pe"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_Entropy(t *testing.T) {
+	if got := entropy([]byte{0x41, 0x41, 0x41, 0x41}); got != 0 {
+		t.Errorf("entropy of constant data = %v, want 0", got)
+	}
+
+	data := make([]byte, 256)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	if got := entropy(data); got != 8 {
+		t.Errorf("entropy of uniform data = %v, want 8", got)
+	}
+}
+
+func Test_MakeBinaryObjects_ELF(t *testing.T) {
+	// the test binary itself is an ELF file on Linux
+	filename, err := os.Executable()
+	if err != nil {
+		t.Skipf("Cannot locate test binary: %s", err)
+	}
+
+	result, err := MakeBinaryObjects(filename)
+	if err != nil {
+		t.Fatalf("MakeBinaryObjects returned error: %s", err)
+	}
+
+	if result.Binary == nil || result.Binary.Name != "elf" {
+		t.Skipf("Test binary is not an ELF file")
+	}
+
+	if len(result.File.References) != 1 || result.File.References[0].ReferencedUUID != result.Binary.UUID {
+		t.Errorf("file object does not reference the elf object: %+v", result.File.References)
+	}
+
+	if len(result.Sections) == 0 || len(result.Binary.References) != len(result.Sections) {
+		t.Errorf("elf object references %d sections, got %d sections", len(result.Binary.References), len(result.Sections))
+	}
+
+	if len(result.File.GetAttributes("sha256")) != 1 {
+		t.Errorf("file object has no sha256 attribute")
+	}
+
+	if got := len(result.Objects()); got != 2+len(result.Sections) {
+		t.Errorf("Objects() returned %d objects, want %d", got, 2+len(result.Sections))
+	}
+}
+
+// testPEFile builds a PE32 executable with a single .idata section importing
+// CreateFileA and ReadFile from KERNEL32.dll and MessageBoxA from USER32.dll
+func testPEFile() []byte {
+	const sectionRVA, sectionOffset, sectionSize = 0x1000, 0x200, 0x200
+
+	section := make([]byte, sectionSize)
+	put := func(offset int, values ...uint32) {
+		for i, value := range values {
+			binary.LittleEndian.PutUint32(section[offset+4*i:], value)
+		}
+	}
+	// Import descriptors: OriginalFirstThunk, TimeDateStamp, ForwarderChain,
+	// Name, FirstThunk
+	put(0x00, 0x1040, 0, 0, 0x1100, 0x1040)
+	put(0x14, 0x1050, 0, 0, 0x1110, 0x1050)
+	// Thunks, pointing to hint/name entries
+	put(0x40, 0x1120, 0x1130, 0)
+	put(0x50, 0x1140, 0)
+	copy(section[0x100:], "KERNEL32.dll\x00")
+	copy(section[0x110:], "USER32.dll\x00")
+	copy(section[0x122:], "CreateFileA\x00")
+	copy(section[0x132:], "ReadFile\x00")
+	copy(section[0x142:], "MessageBoxA\x00")
+
+	optional := pe.OptionalHeader32{
+		Magic:                 0x10b,
+		SizeOfCode:            sectionSize,
+		AddressOfEntryPoint:   sectionRVA,
+		BaseOfCode:            sectionRVA,
+		ImageBase:             0x400000,
+		SectionAlignment:      0x1000,
+		FileAlignment:         0x200,
+		MajorSubsystemVersion: 4,
+		SizeOfImage:           0x2000,
+		SizeOfHeaders:         sectionOffset,
+		Subsystem:             pe.IMAGE_SUBSYSTEM_WINDOWS_GUI,
+		NumberOfRvaAndSizes:   16,
+	}
+	optional.DataDirectory[pe.IMAGE_DIRECTORY_ENTRY_IMPORT] = pe.DataDirectory{VirtualAddress: sectionRVA, Size: 3 * 20}
+
+	var buf bytes.Buffer
+	dos := make([]byte, 0x40)
+	copy(dos, "MZ")
+	binary.LittleEndian.PutUint32(dos[0x3c:], 0x40)
+	buf.Write(dos)
+	buf.WriteString("PE\x00\x00")
+	binary.Write(&buf, binary.LittleEndian, pe.FileHeader{
+		Machine:              pe.IMAGE_FILE_MACHINE_I386,
+		NumberOfSections:     1,
+		TimeDateStamp:        1500000000,
+		SizeOfOptionalHeader: uint16(binary.Size(optional)),
+		Characteristics:      pe.IMAGE_FILE_EXECUTABLE_IMAGE | pe.IMAGE_FILE_32BIT_MACHINE,
+	})
+	binary.Write(&buf, binary.LittleEndian, optional)
+	header := pe.SectionHeader32{
+		VirtualSize:      sectionSize,
+		VirtualAddress:   sectionRVA,
+		SizeOfRawData:    sectionSize,
+		PointerToRawData: sectionOffset,
+		Characteristics:  0xc0000040,
+	}
+	copy(header.Name[:], ".idata")
+	binary.Write(&buf, binary.LittleEndian, header)
+
+	buf.Write(make([]byte, sectionOffset-buf.Len()))
+	buf.Write(section)
+	return buf.Bytes()
+}
+
+func Test_MakeBinaryObjects_PE(t *testing.T) {
+	dir, err := ioutil.TempDir("", "binary")
+	if err != nil {
+		t.Fatalf("TempDir returned error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "sample.exe")
+	if err = ioutil.WriteFile(filename, testPEFile(), 0644); err != nil {
+		t.Fatalf("WriteFile returned error: %s", err)
+	}
+
+	result, err := MakeBinaryObjects(filename)
+	if err != nil {
+		t.Fatalf("MakeBinaryObjects returned error: %s", err)
+	}
+	if result.Binary == nil || result.Binary.Name != "pe" {
+		t.Fatalf("Binary object is not a pe object: %+v", result.Binary)
+	}
+
+	// md5("kernel32.createfilea,kernel32.readfile,user32.messageboxa")
+	expected := map[string]string{
+		"imphash":                        "3b0c80245d80e6fcf1265302bd2d1164",
+		"type":                           "exe",
+		"entrypoint-address":             "4096",
+		"compilation-timestamp":          "2017-07-14T02:40:00Z",
+		"number-sections":                "1",
+		"entrypoint-section-at-position": ".idata|0",
+	}
+	for relation, value := range expected {
+		if attrs := result.Binary.GetAttributes(relation); len(attrs) != 1 || attrs[0].Value != value {
+			t.Errorf("pe %s = %+v, want %s", relation, attrs, value)
+		}
+	}
+
+	if len(result.Sections) != 1 || result.Sections[0].Name != "pe-section" {
+		t.Fatalf("Unexpected sections: %+v", result.Sections)
+	}
+	section := result.Sections[0]
+	if name := section.GetAttributes("name"); len(name) != 1 || name[0].Value != ".idata" {
+		t.Errorf("Unexpected section name: %+v", name)
+	}
+	if size := section.GetAttributes("size-in-bytes"); len(size) != 1 || size[0].Value != "512" {
+		t.Errorf("Unexpected section size: %+v", size)
+	}
+	if len(section.GetAttributes("sha256")) != 1 {
+		t.Errorf("pe-section object has no sha256 attribute")
+	}
+	if len(result.Binary.References) != 1 || result.Binary.References[0].ReferencedUUID != section.UUID {
+		t.Errorf("pe object does not reference its section: %+v", result.Binary.References)
+	}
+}
@@ -0,0 +1,402 @@
+package misp
+
+import (
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// BlocklistFilter selects the attributes exported to blocklists
+type BlocklistFilter struct {
+	// Only attributes flagged for IDS are exported
+	OnlyIDS bool
+
+	// Only attributes with at least one of these tags are exported. Empty
+	// means no restriction.
+	IncludeTags []string
+
+	// Attributes with any of these tags are not exported
+	ExcludeTags []string
+
+	// Attributes matching these warninglists are not exported
+	Warninglists *Warninglists
+}
+
+func (f *BlocklistFilter) accept(attr *Attribute) bool {
+	if attr.Deleted || f.OnlyIDS && !attr.ToIDS {
+		return false
+	}
+	if hasAnyTag(attr.Tags, f.ExcludeTags) {
+		return false
+	}
+	if len(f.IncludeTags) > 0 && !hasAnyTag(attr.Tags, f.IncludeTags) {
+		return false
+	}
+	if f.Warninglists != nil && len(f.Warninglists.Check(attr)) > 0 {
+		return false
+	}
+	return true
+}
+
+// RPZ policy actions
+const (
+	RPZPolicyNXDOMAIN     = "NXDOMAIN"
+	RPZPolicyNODATA       = "NODATA"
+	RPZPolicyDrop         = "DROP"
+	RPZPolicyPassthru     = "PASSTHRU"
+	RPZPolicyTCPOnly      = "TCP-ONLY"
+	RPZPolicyWalledGarden = "WALLED-GARDEN"
+)
+
+// rpzPolicyTargets are the CNAME targets of the policy actions
+var rpzPolicyTargets = map[string]string{
+	RPZPolicyNXDOMAIN: ".",
+	RPZPolicyNODATA:   "*.",
+	RPZPolicyDrop:     "rpz-drop.",
+	RPZPolicyPassthru: "rpz-passthru.",
+	RPZPolicyTCPOnly:  "rpz-tcp-only.",
+}
+
+// RPZZone writes DNS Response Policy Zones from domain, hostname and IP
+// attributes. Domains are blocked along with their subdomains, hostnames on
+// their own, and IP addresses and networks in DNS answers with rpz-ip
+// triggers. Domains and hostnames which are not made of letter, digit and
+// hyphen labels are skipped.
+type RPZZone struct {
+	BlocklistFilter
+
+	// Zone name, written as $ORIGIN when set
+	Origin string
+
+	// Name server of the zone and mailbox of its administrator, by default
+	// localhost. and root.localhost.
+	NS    string
+	Email string
+
+	// Default TTL and SOA timers, in seconds, by default those of MISP's RPZ
+	// export: 1 hour TTL, 2 hours refresh, 30 minutes retry, 30 days expiry
+	// and 1 hour minimum
+	TTL     int
+	Refresh int
+	Retry   int
+	Expiry  int
+	Minimum int
+
+	// One of the RPZPolicy constants, by default RPZPolicyNXDOMAIN. Walled
+	// gardens redirect to WalledGarden.
+	Policy       string
+	WalledGarden string
+
+	// Serial of the SOA record. By default, the most recent timestamp of the
+	// attributes, so that the serial increases when indicators are updated.
+	Serial uint32
+}
+
+// Write writes the zone of the attributes accepted by the filter
+func (z *RPZZone) Write(w io.Writer, attrs []Attribute) error {
+	policy := defaultString(z.Policy, RPZPolicyNXDOMAIN)
+	target, ok := rpzPolicyTargets[policy]
+	if policy == RPZPolicyWalledGarden {
+		if z.WalledGarden == "" {
+			return fmt.Errorf("Walled garden policy without walled garden host")
+		}
+		garden := strings.TrimSuffix(z.WalledGarden, ".")
+		if !isLDHHostname(garden) {
+			return fmt.Errorf("Invalid walled garden host %q", z.WalledGarden)
+		}
+		target, ok = garden+".", true
+	}
+	if !ok {
+		return fmt.Errorf("Unknown RPZ policy %q", z.Policy)
+	}
+
+	var serial int64
+	seen := make(map[string]bool)
+	var owners []string
+	add := func(owner string) {
+		if !seen[owner] {
+			seen[owner] = true
+			owners = append(owners, owner)
+		}
+	}
+
+	for i := range attrs {
+		attr := &attrs[i]
+		if !z.accept(attr) {
+			continue
+		}
+
+		value := attr.Value
+		if parts, err := attr.Composite(); err == nil {
+			value = parts[0]
+		}
+		value = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(value), "."))
+
+		switch attr.Type {
+		case TypeDomain, TypeDomainIP:
+			if !isLDHHostname(value) {
+				continue
+			}
+			add(value)
+			add("*." + value)
+		case TypeHostname, TypeHostnamePort:
+			if !isLDHHostname(value) {
+				continue
+			}
+			add(value)
+		case TypeIPDst, TypeIPSrc, TypeIPDstPort, TypeIPSrcPort:
+			network, err := parseNetwork(value)
+			if err != nil {
+				continue
+			}
+			add(rpzIPTrigger(network))
+		default:
+			continue
+		}
+
+		if ts, err := strconv.ParseInt(attr.Timestamp, 10, 64); err == nil && ts > serial {
+			serial = ts
+		}
+	}
+	sort.Strings(owners)
+
+	if z.Serial != 0 {
+		serial = int64(z.Serial)
+	} else if serial == 0 {
+		serial = time.Now().Unix()
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "$TTL %d\n", defaultInt(z.TTL, 3600))
+	if z.Origin != "" {
+		fmt.Fprintf(&b, "$ORIGIN %s.\n", strings.TrimSuffix(z.Origin, "."))
+	}
+	fmt.Fprintf(&b, "@ SOA %s %s (\n\t%d ; serial\n\t%d ; refresh\n\t%d ; retry\n\t%d ; expiry\n\t%d ; minimum\n)\n",
+		defaultString(z.NS, "localhost."), defaultString(z.Email, "root.localhost."), uint32(serial),
+		defaultInt(z.Refresh, 7200), defaultInt(z.Retry, 1800), defaultInt(z.Expiry, 2592000), defaultInt(z.Minimum, 3600))
+	fmt.Fprintf(&b, "  NS %s\n\n", defaultString(z.NS, "localhost."))
+
+	for _, owner := range owners {
+		fmt.Fprintf(&b, "%s CNAME %s\n", owner, target)
+	}
+
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		return fmt.Errorf("Could not write RPZ zone: %s", err)
+	}
+	return nil
+}
+
+// isLDHHostname tells whether value is a hostname made of letter, digit and
+// hyphen labels of 1 to 63 characters, which can be written as is in a zone
+func isLDHHostname(value string) bool {
+	if value == "" || len(value) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(value, ".") {
+		if len(label) == 0 || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for i := 0; i < len(label); i++ {
+			c := label[i]
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// rpzIPTrigger returns the owner name of the rpz-ip trigger of a network,
+// e.g. 24.0.113.0.203.rpz-ip for 203.0.113.0/24
+func rpzIPTrigger(network *net.IPNet) string {
+	ip, ones, bits := ipNetworkPrefix(network)
+	labels := []string{strconv.Itoa(ones)}
+
+	if bits == 32 {
+		for i := 3; i >= 0; i-- {
+			labels = append(labels, strconv.Itoa(int(ip[i])))
+		}
+		return strings.Join(labels, ".") + ".rpz-ip"
+	}
+
+	// IPv6 words in reverse order, the longest run of zero words as zz
+	words := make([]string, 8)
+	for i := range words {
+		words[i] = strconv.FormatUint(uint64(ip[2*i])<<8|uint64(ip[2*i+1]), 16)
+	}
+	bestStart, bestLen := -1, 0
+	for i := 0; i < 8; {
+		if words[i] != "0" {
+			i++
+			continue
+		}
+		j := i
+		for j < 8 && words[j] == "0" {
+			j++
+		}
+		if j-i > bestLen && j-i > 1 {
+			bestStart, bestLen = i, j-i
+		}
+		i = j
+	}
+	if bestStart >= 0 {
+		words = append(append(words[:bestStart:bestStart], "zz"), words[bestStart+bestLen:]...)
+	}
+	for i := len(words) - 1; i >= 0; i-- {
+		labels = append(labels, words[i])
+	}
+	return strings.Join(labels, ".") + ".rpz-ip"
+}
+
+// IPList writes flat lists of IP addresses and networks, merging overlapping
+// and adjacent networks into the smallest set of CIDR blocks
+type IPList struct {
+	BlocklistFilter
+}
+
+// Networks returns the aggregated networks of the ip-src, ip-dst, their
+// |port variants and domain|ip attributes accepted by the filter, IPv4 first
+func (l *IPList) Networks(attrs []Attribute) []*net.IPNet {
+	var v4, v6 []ipRange
+	for i := range attrs {
+		attr := &attrs[i]
+		if !l.accept(attr) {
+			continue
+		}
+
+		value := attr.Value
+		switch attr.Type {
+		case TypeIPDst, TypeIPSrc:
+		case TypeIPDstPort, TypeIPSrcPort, TypeDomainIP:
+			parts, err := attr.Composite()
+			if err != nil {
+				continue
+			}
+			value = parts[0]
+			if attr.Type == TypeDomainIP {
+				value = parts[1]
+			}
+		default:
+			continue
+		}
+
+		network, err := parseNetwork(strings.TrimSpace(value))
+		if err != nil {
+			continue
+		}
+		r := newIPRange(network)
+		if r.bits == 32 {
+			v4 = append(v4, r)
+		} else {
+			v6 = append(v6, r)
+		}
+	}
+
+	return append(aggregateIPRanges(v4, 32), aggregateIPRanges(v6, 128)...)
+}
+
+// Write writes the aggregated networks one per line, single addresses
+// without prefix length
+func (l *IPList) Write(w io.Writer, attrs []Attribute) error {
+	var b strings.Builder
+	for _, network := range l.Networks(attrs) {
+		ones, bits := network.Mask.Size()
+		if ones == bits {
+			b.WriteString(network.IP.String() + "\n")
+		} else {
+			b.WriteString(network.String() + "\n")
+		}
+	}
+
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		return fmt.Errorf("Could not write IP list: %s", err)
+	}
+	return nil
+}
+
+// ipRange is the range of addresses of a network
+type ipRange struct {
+	start, end *big.Int
+	bits       int
+}
+
+func newIPRange(network *net.IPNet) ipRange {
+	ip, ones, bits := ipNetworkPrefix(network)
+
+	start := new(big.Int).SetBytes(ip.Mask(net.CIDRMask(ones, bits)))
+	size := new(big.Int).Lsh(big.NewInt(1), uint(bits-ones))
+	end := new(big.Int).Sub(new(big.Int).Add(start, size), big.NewInt(1))
+
+	return ipRange{start: start, end: end, bits: bits}
+}
+
+// ipNetworkPrefix returns the address of a network, its prefix length and its
+// number of bits, 32 for IPv4 networks and 128 for IPv6 ones. IPv4-mapped IPv6
+// networks, such as ::ffff:203.0.113.0/120, are converted to IPv4.
+func ipNetworkPrefix(network *net.IPNet) (net.IP, int, int) {
+	ones, bits := network.Mask.Size()
+	if ip := network.IP.To4(); ip != nil && ones >= bits-32 {
+		return ip, ones - (bits - 32), 32
+	}
+	return network.IP.To16(), ones, 128
+}
+
+// aggregateIPRanges merges overlapping and adjacent ranges and splits the
+// result into CIDR blocks
+func aggregateIPRanges(ranges []ipRange, bits int) []*net.IPNet {
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i].start.Cmp(ranges[j].start) < 0 })
+
+	var merged []ipRange
+	one := big.NewInt(1)
+	for _, r := range ranges {
+		if n := len(merged); n > 0 {
+			last := &merged[n-1]
+			if new(big.Int).Add(last.end, one).Cmp(r.start) >= 0 {
+				if r.end.Cmp(last.end) > 0 {
+					last.end = r.end
+				}
+				continue
+			}
+		}
+		merged = append(merged, r)
+	}
+
+	var networks []*net.IPNet
+	for _, r := range merged {
+		start := new(big.Int).Set(r.start)
+		for start.Cmp(r.end) <= 0 {
+			// Largest block aligned on start and ending before the range end
+			size := bits
+			if start.Sign() != 0 && int(start.TrailingZeroBits()) < size {
+				size = int(start.TrailingZeroBits())
+			}
+			for {
+				last := new(big.Int).Add(start, new(big.Int).Sub(new(big.Int).Lsh(one, uint(size)), one))
+				if last.Cmp(r.end) <= 0 {
+					break
+				}
+				size--
+			}
+
+			ip := make(net.IP, bits/8)
+			start.FillBytes(ip)
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits-size, bits)})
+
+			start.Add(start, new(big.Int).Lsh(one, uint(size)))
+		}
+	}
+
+	return networks
+}
+
+func defaultInt(value, def int) int {
+	if value == 0 {
+		return def
+	}
+	return value
+}
@@ -0,0 +1,120 @@
+package misp
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+var testBlocklistAttributes = []Attribute{
+	{Type: TypeDomain, Value: "Evil.com.", ToIDS: true, Timestamp: "1488553830"},
+	{Type: TypeHostname, Value: "c2.bad.net", ToIDS: true, Timestamp: "1488557887"},
+	{Type: TypeDomainIP, Value: "evil.com|203.0.113.9", ToIDS: true},
+	{Type: TypeDomain, Value: "not-for-ids.com"},
+	{Type: TypeDomain, Value: "excluded.com", ToIDS: true, Tags: []Tag{{Name: "false-positive"}}},
+	{Type: TypeDomain, Value: "google.com", ToIDS: true},
+	{Type: TypeIPDst, Value: "203.0.113.0/25", ToIDS: true},
+	{Type: TypeIPDst, Value: "203.0.113.128/25", ToIDS: true},
+	{Type: TypeIPSrcPort, Value: "198.51.100.7|443", ToIDS: true},
+	{Type: TypeIPDst, Value: "198.51.100.6", ToIDS: true},
+	{Type: TypeIPDst, Value: "2001:db8::1", ToIDS: true},
+	{Type: TypeIPDst, Value: "::ffff:192.0.2.0/120", ToIDS: true},
+	{Type: TypeIPDst, Value: "8.8.8.8", ToIDS: true},
+}
+
+func testBlocklistFilter(t *testing.T) BlocklistFilter {
+	lists, err := NewWarninglists([]Warninglist{{
+		Name: "Known resolvers and domains",
+		Type: "string",
+		List: []string{"google.com", "8.8.8.8"},
+	}})
+	if err != nil {
+		t.Fatalf("NewWarninglists returned error: %s", err)
+	}
+	return BlocklistFilter{OnlyIDS: true, ExcludeTags: []string{"false-positive"}, Warninglists: lists}
+}
+
+func Test_RPZZone(t *testing.T) {
+	zone := &RPZZone{BlocklistFilter: testBlocklistFilter(t), Origin: "rpz.misp.local", Policy: RPZPolicyDrop}
+
+	var buf bytes.Buffer
+	if err := zone.Write(&buf, testBlocklistAttributes); err != nil {
+		t.Fatalf("Write returned error: %s", err)
+	}
+
+	want := `$TTL 3600
+$ORIGIN rpz.misp.local.
+@ SOA localhost. root.localhost. (
+	1488557887 ; serial
+	7200 ; refresh
+	1800 ; retry
+	2592000 ; expiry
+	3600 ; minimum
+)
+  NS localhost.
+
+*.evil.com CNAME rpz-drop.
+128.1.zz.db8.2001.rpz-ip CNAME rpz-drop.
+24.0.2.0.192.rpz-ip CNAME rpz-drop.
+25.0.113.0.203.rpz-ip CNAME rpz-drop.
+25.128.113.0.203.rpz-ip CNAME rpz-drop.
+32.6.100.51.198.rpz-ip CNAME rpz-drop.
+32.7.100.51.198.rpz-ip CNAME rpz-drop.
+c2.bad.net CNAME rpz-drop.
+evil.com CNAME rpz-drop.
+`
+	if buf.String() != want {
+		t.Errorf("Expected:\n%s\ngot:\n%s", want, buf.String())
+	}
+
+	zone.Policy = RPZPolicyWalledGarden
+	zone.WalledGarden = "garden.local\n@ NS evil.com"
+	if err := zone.Write(&buf, testBlocklistAttributes); err == nil {
+		t.Errorf("Write accepted an invalid walled garden host")
+	}
+
+	zone.Policy = "BLOCK"
+	if err := zone.Write(&buf, testBlocklistAttributes); err == nil {
+		t.Errorf("Write accepted an unknown policy")
+	}
+}
+
+func Test_IPList(t *testing.T) {
+	list := &IPList{BlocklistFilter: testBlocklistFilter(t)}
+
+	var buf bytes.Buffer
+	if err := list.Write(&buf, testBlocklistAttributes); err != nil {
+		t.Fatalf("Write returned error: %s", err)
+	}
+
+	want := "192.0.2.0/24\n198.51.100.6/31\n203.0.113.0/24\n2001:db8::1\n"
+	if buf.String() != want {
+		t.Errorf("Expected:\n%s\ngot:\n%s", want, buf.String())
+	}
+}
+
+func Test_RPZZone_InvalidOwners(t *testing.T) {
+	zone := &RPZZone{}
+
+	var buf bytes.Buffer
+	err := zone.Write(&buf, []Attribute{
+		{Type: TypeDomain, Value: "evil.com\nevil.com CNAME rpz-passthru."},
+		{Type: TypeDomain, Value: " "},
+		{Type: TypeHostname, Value: ""},
+		{Type: TypeHostname, Value: "a b"},
+		{Type: TypeHostname, Value: "a..b"},
+		{Type: TypeHostname, Value: "-a.com"},
+		{Type: TypeHostnamePort, Value: "x;y.com|80"},
+		{Type: TypeHostname, Value: strings.Repeat("a", 64) + ".com"},
+		{Type: TypeHostname, Value: "ok-host.example.com"},
+	})
+	if err != nil {
+		t.Fatalf("Write returned error: %s", err)
+	}
+
+	zoneFile := buf.String()
+	records := strings.Split(zoneFile[strings.Index(zoneFile, "  NS localhost.\n\n")+len("  NS localhost.\n\n"):], "\n")
+	if len(records) != 2 || records[0] != "ok-host.example.com CNAME ." {
+		t.Errorf("Unexpected zone:\n%s", zoneFile)
+	}
+}
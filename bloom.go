@@ -0,0 +1,219 @@
+package misp
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"io/ioutil"
+	"math"
+)
+
+// Constants of the double hashing of values into bit positions
+const (
+	bloomModulus    = 18446744073709551557
+	bloomMultiplier = 18446744073709550147
+)
+
+// BloomFilter is a probabilistic set of values, to distribute indicators
+// without disclosing them: membership can be tested, but values cannot be
+// listed. Values which were added are always found, others are found with
+// the false positive rate of the filter.
+//
+// Filters are serialized in the binary layout of the DCSO bloom tool, which
+// MISP's bloomfilter export builds on. All fields are little-endian 64-bit
+// words:
+//
+//	n       capacity, the number of values the filter was sized for
+//	p       false positive rate at capacity, as an IEEE 754 double
+//	k       number of hash functions
+//	m       number of bits
+//	N       number of values added
+//	bits    ceil(m/64) words of bits, bit i being bit i%64 of word i/64
+//	data    optional trailing bytes, up to the end of the file
+//
+// The k bit positions of a value are derived from its 64-bit FNV-1 hash h,
+// h = h mod M, then k times h = (h * G) mod M and position h mod m, M and G
+// being bloomModulus and bloomMultiplier, with 64-bit wrapping products.
+type BloomFilter struct {
+	capacity uint64
+	p        float64
+	k        uint64
+	m        uint64
+	count    uint64
+	bits     []uint64
+
+	// Data stored after the bits, such as a description of the filter
+	Data []byte
+}
+
+// NewBloomFilter returns an empty filter sized for capacity values and the
+// false positive rate p, between 0 and 1
+func NewBloomFilter(capacity uint64, p float64) (*BloomFilter, error) {
+	if capacity == 0 {
+		return nil, fmt.Errorf("Bloom filter capacity must be positive")
+	}
+	if !(p > 0 && p < 1) {
+		return nil, fmt.Errorf("Bloom filter false positive rate must be between 0 and 1")
+	}
+
+	m := uint64(math.Ceil(-float64(capacity) * math.Log(p) / (math.Ln2 * math.Ln2)))
+	k := uint64(math.Ceil(math.Ln2 * float64(m) / float64(capacity)))
+	return &BloomFilter{
+		capacity: capacity,
+		p:        p,
+		k:        k,
+		m:        m,
+		bits:     make([]uint64, (m+63)/64),
+	}, nil
+}
+
+// NewAttributesBloomFilter returns a filter of the values of the attributes,
+// such as SearchAttribute results, sized for their number and the false
+// positive rate p. Each part of composite attributes is added on its own.
+func NewAttributesBloomFilter(attrs []Attribute, p float64) (*BloomFilter, error) {
+	values := attributeValues(attrs)
+	capacity := uint64(len(values))
+	if capacity == 0 {
+		capacity = 1
+	}
+	f, err := NewBloomFilter(capacity, p)
+	if err != nil {
+		return nil, err
+	}
+	for _, value := range values {
+		f.Add(value)
+	}
+	return f, nil
+}
+
+// attributeValues returns the distinct values of the attributes and of the
+// parts of composite attributes
+func attributeValues(attrs []Attribute) []string {
+	seen := make(map[string]bool)
+	var values []string
+	for i := range attrs {
+		if attrs[i].Deleted {
+			continue
+		}
+		parts := []string{attrs[i].Value}
+		if composite, err := attrs[i].Composite(); err == nil {
+			parts = composite
+		}
+		for _, value := range parts {
+			if value != "" && !seen[value] {
+				seen[value] = true
+				values = append(values, value)
+			}
+		}
+	}
+	return values
+}
+
+// Add adds a value to the filter
+func (f *BloomFilter) Add(value string) {
+	for _, bit := range f.positions(value) {
+		f.bits[bit/64] |= 1 << (bit % 64)
+	}
+	f.count++
+}
+
+// Contains tells whether the value may have been added to the filter
+func (f *BloomFilter) Contains(value string) bool {
+	for _, bit := range f.positions(value) {
+		if f.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *BloomFilter) positions(value string) []uint64 {
+	h := fnv.New64()
+	h.Write([]byte(value))
+	hn := h.Sum64() % bloomModulus
+
+	positions := make([]uint64, f.k)
+	for i := range positions {
+		hn = hn * bloomMultiplier % bloomModulus
+		positions[i] = hn % f.m
+	}
+	return positions
+}
+
+// Count returns the number of values added to the filter
+func (f *BloomFilter) Count() uint64 {
+	return f.count
+}
+
+// FalsePositiveRate returns the expected false positive rate of the filter
+// for the number of values added so far
+func (f *BloomFilter) FalsePositiveRate() float64 {
+	return math.Pow(1-math.Exp(-float64(f.k)*float64(f.count)/float64(f.m)), float64(f.k))
+}
+
+// Write writes the filter in binary format
+func (f *BloomFilter) Write(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	buf := make([]byte, 8)
+	for _, word := range append([]uint64{f.capacity, math.Float64bits(f.p), f.k, f.m, f.count}, f.bits...) {
+		binary.LittleEndian.PutUint64(buf, word)
+		bw.Write(buf)
+	}
+	bw.Write(f.Data)
+
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("Could not write Bloom filter: %s", err)
+	}
+	return nil
+}
+
+// ReadBloomFilter reads a filter in binary format
+func ReadBloomFilter(r io.Reader) (*BloomFilter, error) {
+	br := bufio.NewReader(r)
+	header := make([]byte, 5*8)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return nil, fmt.Errorf("Could not read Bloom filter header: %s", err)
+	}
+
+	word := func(i int) uint64 { return binary.LittleEndian.Uint64(header[8*i:]) }
+	f := &BloomFilter{
+		capacity: word(0),
+		p:        math.Float64frombits(word(1)),
+		k:        word(2),
+		m:        word(3),
+		count:    word(4),
+	}
+	if f.m == 0 || f.m > math.MaxUint64-63 || f.k == 0 || f.k > 1024 {
+		return nil, fmt.Errorf("Invalid Bloom filter with %d bits and %d hash functions", f.m, f.k)
+	}
+
+	// Bits are read by chunks, so that truncated input fails before
+	// allocating the size announced by the header
+	words := (f.m + 63) / 64
+	chunk := make([]byte, 8*4096)
+	for remaining := words; remaining > 0; {
+		n := uint64(len(chunk) / 8)
+		if remaining < n {
+			n = remaining
+		}
+		if _, err := io.ReadFull(br, chunk[:8*n]); err != nil {
+			return nil, fmt.Errorf("Could not read Bloom filter bits: %s", err)
+		}
+		for i := uint64(0); i < n; i++ {
+			f.bits = append(f.bits, binary.LittleEndian.Uint64(chunk[8*i:]))
+		}
+		remaining -= n
+	}
+
+	data, err := ioutil.ReadAll(br)
+	if err != nil {
+		return nil, fmt.Errorf("Could not read Bloom filter data: %s", err)
+	}
+	if len(data) > 0 {
+		f.Data = data
+	}
+
+	return f, nil
+}
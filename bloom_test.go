@@ -0,0 +1,121 @@
+package misp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"testing"
+)
+
+func Test_BloomFilter(t *testing.T) {
+	var attrs []Attribute
+	for i := 0; i < 1000; i++ {
+		attrs = append(attrs, Attribute{Type: TypeDomain, Value: fmt.Sprintf("evil%d.com", i)})
+	}
+	attrs = append(attrs,
+		Attribute{Type: TypeFilenameMD5, Value: "invoice.exe|68b329da9893e34099c7d8ad5cb9c940"},
+		Attribute{Type: TypeDomain, Value: "deleted.com", Deleted: true},
+	)
+
+	f, err := NewAttributesBloomFilter(attrs, 0.01)
+	if err != nil {
+		t.Fatalf("NewAttributesBloomFilter returned error: %s", err)
+	}
+	if f.Count() != 1002 {
+		t.Errorf("Expected 1002 values, got %d", f.Count())
+	}
+	for _, value := range []string{"evil0.com", "evil999.com", "invoice.exe", "68b329da9893e34099c7d8ad5cb9c940"} {
+		if !f.Contains(value) {
+			t.Errorf("Filter does not contain %s", value)
+		}
+	}
+
+	falsePositives := 0
+	for i := 0; i < 10000; i++ {
+		if f.Contains(fmt.Sprintf("good%d.org", i)) {
+			falsePositives++
+		}
+	}
+	if falsePositives > 200 {
+		t.Errorf("%d false positives out of 10000 for a rate of 1%%", falsePositives)
+	}
+	if rate := f.FalsePositiveRate(); rate > 0.011 {
+		t.Errorf("Unexpected false positive rate %f", rate)
+	}
+
+	f.Data = []byte("misp indicators")
+	var buf bytes.Buffer
+	if err = f.Write(&buf); err != nil {
+		t.Fatalf("Write returned error: %s", err)
+	}
+	if want := 5*8 + int((f.m+63)/64)*8 + len(f.Data); buf.Len() != want {
+		t.Errorf("Expected %d bytes, got %d", want, buf.Len())
+	}
+	data := buf.Bytes()
+
+	read, err := ReadBloomFilter(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("ReadBloomFilter returned error: %s", err)
+	}
+	if !read.Contains("evil42.com") || read.Count() != f.Count() || string(read.Data) != "misp indicators" {
+		t.Errorf("Filter not read back")
+	}
+
+	if _, err = ReadBloomFilter(bytes.NewReader(data[:100])); err == nil {
+		t.Errorf("ReadBloomFilter accepted a truncated filter")
+	}
+	if _, err = NewBloomFilter(10, 1); err == nil {
+		t.Errorf("NewBloomFilter accepted a false positive rate of 1")
+	}
+}
+
+// testBloomFilter is a filter of capacity 10 and false positive rate 0.01
+// holding "evil.com" and "203.0.113.7", with the data "v1". It was computed
+// with a separate implementation of the hashing and layout documented on
+// BloomFilter.
+const testBloomFilter = "0a00000000000000" + "7b14ae47e17a843f" + "0700000000000000" + "6000000000000000" + "0200000000000000" +
+	"0004000400440000" + "0044004400000000" + "7631"
+
+func Test_BloomFilter_KnownAnswer(t *testing.T) {
+	want, _ := hex.DecodeString(testBloomFilter)
+
+	f, err := NewBloomFilter(10, 0.01)
+	if err != nil {
+		t.Fatalf("NewBloomFilter returned error: %s", err)
+	}
+	f.Add("evil.com")
+	f.Add("203.0.113.7")
+	f.Data = []byte("v1")
+
+	var buf bytes.Buffer
+	if err = f.Write(&buf); err != nil {
+		t.Fatalf("Write returned error: %s", err)
+	}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("Expected %x, got %x", want, buf.Bytes())
+	}
+
+	read, err := ReadBloomFilter(bytes.NewReader(want))
+	if err != nil {
+		t.Fatalf("ReadBloomFilter returned error: %s", err)
+	}
+	if !read.Contains("evil.com") || !read.Contains("203.0.113.7") || read.Count() != 2 || string(read.Data) != "v1" {
+		t.Errorf("Unexpected filter %+v", read)
+	}
+}
+
+func Test_ReadBloomFilter_Invalid(t *testing.T) {
+	header := make([]byte, 5*8)
+	binary.LittleEndian.PutUint64(header[0:], 10)
+	binary.LittleEndian.PutUint64(header[8:], math.Float64bits(0.01))
+	binary.LittleEndian.PutUint64(header[16:], 7)
+
+	for _, m := range []uint64{0, math.MaxUint64, math.MaxUint64 - 62, 1 << 40} {
+		binary.LittleEndian.PutUint64(header[24:], m)
+		if _, err := ReadBloomFilter(bytes.NewReader(header)); err == nil {
+			t.Errorf("ReadBloomFilter accepted a filter of %d bits without data", m)
+		}
+	}
+}
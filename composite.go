@@ -0,0 +1,114 @@
+package misp
+
+import (
+	"fmt"
+	"strings"
+)
+
+// compositePartTypes maps the parts of composite types whose name is not an
+// attribute type on its own
+var compositePartTypes = map[string]string{
+	"ip":    TypeIPDst,
+	"value": TypeText,
+}
+
+// compositeTypeParts holds the parts of the composite types whose name does
+// not list them. Like MISP, malware-sample values are "filename|md5".
+var compositeTypeParts = map[string][]string{
+	TypeMalwareSample: {TypeFilename, TypeMD5},
+}
+
+// IsCompositeType tells whether values of attrType are made of several parts
+// separated by a "|", such as "filename|md5", "ip-dst|port" or
+// "malware-sample", according to DefaultDescribeTypes
+func IsCompositeType(attrType string) bool {
+	return DefaultDescribeTypes.IsCompositeType(attrType)
+}
+
+// CompositePartTypes returns the attribute types of each part of a composite
+// type, e.g. "domain" and "ip-dst" for "domain|ip". It returns nil if attrType
+// is not a composite type.
+func CompositePartTypes(attrType string) []string {
+	if !IsCompositeType(attrType) {
+		return nil
+	}
+	if types, ok := compositeTypeParts[attrType]; ok {
+		return append([]string{}, types...)
+	}
+
+	types := strings.Split(attrType, "|")
+	for i, t := range types {
+		if mapped, ok := compositePartTypes[t]; ok {
+			types[i] = mapped
+		}
+	}
+
+	return types
+}
+
+// Composite splits the value of a composite attribute into its parts
+func (a *Attribute) Composite() ([]string, error) {
+	return splitComposite(a.Type, a.Value)
+}
+
+// NewCompositeAttribute builds an attribute of the composite type attrType
+// from its parts, after validating each of them
+func NewCompositeAttribute(attrType string, parts ...string) (*Attribute, error) {
+	types := CompositePartTypes(attrType)
+	if types == nil {
+		return nil, fmt.Errorf("Attribute type %q is not a composite type", attrType)
+	}
+	if len(parts) != len(types) {
+		return nil, fmt.Errorf("Attribute type %q expects %d parts, got %d", attrType, len(types), len(parts))
+	}
+
+	for i, part := range parts {
+		// Only the last part may contain the separator, see splitComposite
+		if i < len(parts)-1 && strings.Contains(part, "|") {
+			return nil, fmt.Errorf("Invalid %s value %q: contains a \"|\"", types[i], part)
+		}
+		if err := validateValue(types[i], part); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Attribute{
+		Type:  attrType,
+		Value: strings.Join(parts, "|"),
+	}, nil
+}
+
+func splitComposite(attrType, value string) ([]string, error) {
+	types := CompositePartTypes(attrType)
+	if types == nil {
+		return nil, fmt.Errorf("Attribute type %q is not a composite type", attrType)
+	}
+
+	// The last part is allowed to contain the separator, e.g. registry values
+	parts := strings.SplitN(value, "|", len(types))
+	if len(parts) != len(types) {
+		return nil, fmt.Errorf("Invalid %s value %q: expected %d parts", attrType, value, len(types))
+	}
+
+	return parts, nil
+}
+
+// validateComposite checks the format of each part of a composite value
+func validateComposite(attrType, value string) error {
+	parts, err := splitComposite(attrType, value)
+	if err != nil {
+		return err
+	}
+
+	types := CompositePartTypes(attrType)
+	for i, part := range parts {
+		if part == "" {
+			return fmt.Errorf("Invalid %s value %q: empty %s part", attrType, value, types[i])
+		}
+		if err := validateValue(types[i], part); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,54 @@
+package misp
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_CompositeAttribute(t *testing.T) {
+	attr, err := NewCompositeAttribute(TypeIPDstPort, "2001:db8::1", "443")
+	if err != nil {
+		t.Fatalf("NewCompositeAttribute returned error: %s", err)
+	}
+	if attr.Value != "2001:db8::1|443" {
+		t.Errorf("NewCompositeAttribute built value %q", attr.Value)
+	}
+
+	parts, err := attr.Composite()
+	if err != nil || len(parts) != 2 || parts[0] != "2001:db8::1" || parts[1] != "443" {
+		t.Errorf("Composite() returned %v, %v", parts, err)
+	}
+
+	if _, err := NewCompositeAttribute(TypeFilenameMD5, "evil.exe", "not-a-hash"); err == nil {
+		t.Errorf("NewCompositeAttribute accepted an invalid md5 part")
+	}
+	if _, err := NewCompositeAttribute(TypeMD5, "68b329da9893e34099c7d8ad5cb9c940"); err == nil {
+		t.Errorf("NewCompositeAttribute accepted a non composite type")
+	}
+
+	regkey := Attribute{Type: TypeRegkeyValue, Value: `HKLM\Software\Run|C:\evil.exe|--silent`}
+	if parts, err := regkey.Composite(); err != nil || parts[1] != `C:\evil.exe|--silent` {
+		t.Errorf("Composite() returned %v, %v", parts, err)
+	}
+
+	if err := ValidateAttribute(&Attribute{Type: TypeDomainIP, Value: "evil.com|203.0.113"}); err == nil {
+		t.Errorf("ValidateAttribute accepted an invalid ip part")
+	}
+}
+
+func Test_MalwareSampleComposite(t *testing.T) {
+	if !IsCompositeType(TypeMalwareSample) || IsCompositeType(TypeMD5) {
+		t.Errorf("Unexpected composite types")
+	}
+	if types := CompositePartTypes(TypeMalwareSample); !reflect.DeepEqual(types, []string{TypeFilename, TypeMD5}) {
+		t.Errorf("Unexpected part types %v", types)
+	}
+
+	sample := Attribute{Type: TypeMalwareSample, Value: "evil.exe|68b329da9893e34099c7d8ad5cb9c940"}
+	if parts, err := sample.Composite(); err != nil || parts[0] != "evil.exe" || parts[1] != "68b329da9893e34099c7d8ad5cb9c940" {
+		t.Errorf("Composite() returned %v, %v", parts, err)
+	}
+	if err := ValidateAttribute(&Attribute{Type: TypeMalwareSample, Value: "evil.exe"}); err == nil {
+		t.Errorf("ValidateAttribute accepted a malware-sample without md5")
+	}
+}
@@ -0,0 +1,226 @@
+package misp
+
+import (
+	"net"
+	"sort"
+	"strings"
+)
+
+// Kinds of correlations
+const (
+	CorrelationValue  = "value"
+	CorrelationCIDR   = "cidr"
+	CorrelationSSDeep = "ssdeep"
+)
+
+// correlationSkipTypes are the types MISP never correlates
+var correlationSkipTypes = map[string]bool{
+	TypeComment:    true,
+	TypeHTTPMethod: true,
+	TypeABARTN:     true,
+	TypePort:       true,
+	"gender":       true,
+	"counter":      true,
+	"float":        true,
+	"nationality":  true,
+	"cortex":       true,
+	"boolean":      true,
+	"anonymised":   true,
+}
+
+// Correlator finds the attributes events have in common, as MISP correlations
+// do, without a round trip to the server. Attributes correlate when:
+//
+//   - they have the same value, case-insensitive, each part of composite
+//     attributes correlating on its own
+//   - an ip-src or ip-dst network contains the address or network of another
+//     ip-src or ip-dst attribute
+//   - their ssdeep hashes are similar enough, if SSDeepThreshold is set
+//
+// Attributes and events with DisableCorrelation set, deleted attributes and
+// objects, and the types MISP does not correlate, such as comments and ports,
+// are left out.
+type Correlator struct {
+	// Minimum score, from 1 to 100, of ssdeep hashes correlating by
+	// similarity, see SSDeepCompare. Zero disables fuzzy correlation, identical
+	// hashes still correlating by value.
+	SSDeepThreshold int
+}
+
+// EventCorrelation is a pair of correlating events, along with their
+// correlating attributes
+type EventCorrelation struct {
+	A, B       *Event
+	Attributes []AttributeCorrelation
+}
+
+// AttributeCorrelation is a pair of correlating attributes, A belonging to
+// the first event of the correlation and B to the second one
+type AttributeCorrelation struct {
+	A, B *Attribute
+
+	// One of the Correlation constants
+	Kind string
+
+	// ssdeep score of ssdeep correlations, 100 for other kinds
+	Score int
+}
+
+// correlationEntry is a value of an attribute taking part in correlations
+type correlationEntry struct {
+	event   int
+	attr    *Attribute
+	network *net.IPNet
+	ssdeep  *ssdeepHash
+}
+
+// Correlate returns the pairs of correlating events, in the order of events.
+// Correlations refer to the events and attributes of the slice.
+func (c *Correlator) Correlate(events []Event) []EventCorrelation {
+	values := make(map[string][]correlationEntry)
+	// ranges are the networks of more than one address
+	var networks, ranges, hashes []correlationEntry
+
+	for i := range events {
+		event := &events[i]
+		if event.DisableCorrelation {
+			continue
+		}
+
+		var attrs []*Attribute
+		for j := range event.Attribute {
+			attrs = append(attrs, &event.Attribute[j])
+		}
+		for j := range event.Objects {
+			if event.Objects[j].Deleted {
+				continue
+			}
+			for k := range event.Objects[j].Attributes {
+				attrs = append(attrs, &event.Objects[j].Attributes[k])
+			}
+		}
+
+		for _, attr := range attrs {
+			if attr.Deleted || attr.DisableCorrelation || correlationSkipTypes[attr.Type] {
+				continue
+			}
+
+			types := []string{attr.Type}
+			parts := []string{attr.Value}
+			if composite, err := attr.Composite(); err == nil {
+				types = CompositePartTypes(attr.Type)
+				parts = composite
+			}
+
+			for j, attrType := range types {
+				value := strings.TrimSpace(parts[j])
+				if value == "" || correlationSkipTypes[attrType] {
+					continue
+				}
+				// Values are compared case-insensitively, as by the collation
+				// of MISP's database
+				entry := correlationEntry{event: i, attr: attr}
+				key := strings.ToLower(value)
+				values[key] = append(values[key], entry)
+
+				switch attrType {
+				case TypeIPSrc, TypeIPDst:
+					if network, err := parseNetwork(value); err == nil {
+						// IPv4-mapped IPv6 networks are compared as IPv4 ones
+						ip, ones, bits := ipNetworkPrefix(network)
+						entry.network = &net.IPNet{IP: ip.Mask(net.CIDRMask(ones, bits)), Mask: net.CIDRMask(ones, bits)}
+						networks = append(networks, entry)
+						if ones < bits {
+							ranges = append(ranges, entry)
+						}
+					}
+				case TypeSSDeep:
+					if c.SSDeepThreshold > 0 {
+						if hash, err := parseSSDeep(value); err == nil {
+							entry.ssdeep = hash
+							hashes = append(hashes, entry)
+						}
+					}
+				}
+			}
+		}
+	}
+
+	pairs := make(map[[2]int]*EventCorrelation)
+	seen := make(map[[2]*Attribute]bool)
+	add := func(a, b correlationEntry, kind string, score int) {
+		if a.event == b.event {
+			return
+		}
+		if a.event > b.event {
+			a, b = b, a
+		}
+		if seen[[2]*Attribute{a.attr, b.attr}] {
+			return
+		}
+		seen[[2]*Attribute{a.attr, b.attr}] = true
+
+		key := [2]int{a.event, b.event}
+		pair := pairs[key]
+		if pair == nil {
+			pair = &EventCorrelation{A: &events[a.event], B: &events[b.event]}
+			pairs[key] = pair
+		}
+		pair.Attributes = append(pair.Attributes, AttributeCorrelation{A: a.attr, B: b.attr, Kind: kind, Score: score})
+	}
+
+	// Values are visited in a fixed order for deterministic results
+	valueKeys := make([]string, 0, len(values))
+	for value, entries := range values {
+		if len(entries) > 1 {
+			valueKeys = append(valueKeys, value)
+		}
+	}
+	sort.Strings(valueKeys)
+	for _, value := range valueKeys {
+		entries := values[value]
+		for i := range entries {
+			for j := i + 1; j < len(entries); j++ {
+				add(entries[i], entries[j], CorrelationValue, 100)
+			}
+		}
+	}
+
+	for _, outer := range ranges {
+		outerOnes, outerBits := outer.network.Mask.Size()
+		for _, inner := range networks {
+			innerOnes, innerBits := inner.network.Mask.Size()
+			if outer.event != inner.event && innerBits == outerBits && innerOnes >= outerOnes && outer.network.Contains(inner.network.IP) {
+				add(outer, inner, CorrelationCIDR, 100)
+			}
+		}
+	}
+
+	for i := range hashes {
+		for j := i + 1; j < len(hashes); j++ {
+			if hashes[i].event == hashes[j].event {
+				continue
+			}
+			if score := hashes[i].ssdeep.compare(hashes[j].ssdeep); score >= c.SSDeepThreshold {
+				add(hashes[i], hashes[j], CorrelationSSDeep, score)
+			}
+		}
+	}
+
+	pairKeys := make([][2]int, 0, len(pairs))
+	for key := range pairs {
+		pairKeys = append(pairKeys, key)
+	}
+	sort.Slice(pairKeys, func(i, j int) bool {
+		if pairKeys[i][0] != pairKeys[j][0] {
+			return pairKeys[i][0] < pairKeys[j][0]
+		}
+		return pairKeys[i][1] < pairKeys[j][1]
+	})
+
+	result := make([]EventCorrelation, 0, len(pairs))
+	for _, key := range pairKeys {
+		result = append(result, *pairs[key])
+	}
+	return result
+}
@@ -0,0 +1,120 @@
+package misp
+
+import "testing"
+
+func Test_Correlator(t *testing.T) {
+	events := []Event{
+		{UUID: "event-1", Attribute: []Attribute{
+			{UUID: "1a", Type: TypeFilenameMD5, Value: "invoice.exe|68B329DA9893E34099C7D8AD5CB9C940"},
+			{UUID: "1b", Type: TypeIPDst, Value: "203.0.113.0/24"},
+			{UUID: "1c", Type: TypeSSDeep, Value: "3:AXGBicFlgVNhBGcL6wCrFQEv:AXGHsNhxLsr2C"},
+			{UUID: "1d", Type: TypeComment, Value: "shared comment"},
+			{UUID: "1e", Type: TypeDomain, Value: "evil.com", DisableCorrelation: true},
+		}},
+		{UUID: "event-2", Attribute: []Attribute{
+			{UUID: "2a", Type: TypeMD5, Value: "68b329da9893e34099c7d8ad5cb9c940"},
+			{UUID: "2b", Type: TypeIPSrcPort, Value: "203.0.113.9|443"},
+			{UUID: "2c", Type: TypeSSDeep, Value: "3:AXGBicFlIHBGcL6wCrFQEv:AXGH6xLsr2Cx"},
+			{UUID: "2d", Type: TypeComment, Value: "shared comment"},
+			{UUID: "2e", Type: TypeDomain, Value: "evil.com"},
+		}, Objects: []Object{{Attributes: []Attribute{
+			{UUID: "2f", Type: TypeFilename, Value: "invoice.exe"},
+		}}}},
+		{UUID: "event-3", DisableCorrelation: true, Attribute: []Attribute{
+			{UUID: "3a", Type: TypeMD5, Value: "68b329da9893e34099c7d8ad5cb9c940"},
+		}},
+		{UUID: "event-4", Attribute: []Attribute{
+			{UUID: "4a", Type: TypeDomain, Value: "Evil.COM"},
+			{UUID: "4b", Type: TypeIPDst, Value: "203.0.113.9", Deleted: true},
+		}},
+	}
+
+	correlator := &Correlator{SSDeepThreshold: 20}
+	correlations := correlator.Correlate(events)
+
+	if len(correlations) != 2 {
+		t.Fatalf("Expected 2 correlations, got %d: %+v", len(correlations), correlations)
+	}
+
+	c := correlations[0]
+	if c.A.UUID != "event-1" || c.B.UUID != "event-2" {
+		t.Errorf("Unexpected events %s and %s", c.A.UUID, c.B.UUID)
+	}
+	want := []struct {
+		a, b, kind string
+		score      int
+	}{
+		{"1a", "2a", CorrelationValue, 100},
+		{"1a", "2f", CorrelationValue, 100},
+		{"1b", "2b", CorrelationCIDR, 100},
+		{"1c", "2c", CorrelationSSDeep, 22},
+	}
+	if len(c.Attributes) != len(want) {
+		t.Fatalf("Expected %d attribute correlations, got %+v", len(want), c.Attributes)
+	}
+	for i, w := range want {
+		got := c.Attributes[i]
+		if got.A.UUID != w.a || got.B.UUID != w.b || got.Kind != w.kind || got.Score != w.score {
+			t.Errorf("Expected %+v, got %s %s %s %d", w, got.A.UUID, got.B.UUID, got.Kind, got.Score)
+		}
+	}
+
+	c = correlations[1]
+	if c.A.UUID != "event-2" || c.B.UUID != "event-4" || len(c.Attributes) != 1 || c.Attributes[0].B.UUID != "4a" {
+		t.Errorf("Unexpected correlation %+v", c)
+	}
+
+	// Fuzzy correlation is disabled by default
+	for _, c := range (&Correlator{}).Correlate(events) {
+		for _, attr := range c.Attributes {
+			if attr.Kind == CorrelationSSDeep {
+				t.Errorf("Unexpected ssdeep correlation")
+			}
+		}
+	}
+}
+
+func Test_CorrelatorMappedNetworks(t *testing.T) {
+	events := []Event{
+		{UUID: "event-1", Attribute: []Attribute{
+			{UUID: "1a", Type: TypeIPDst, Value: "::ffff:198.51.100.0/120"},
+			{UUID: "1b", Type: TypeIPSrc, Value: "2001:db8::/32"},
+		}},
+		{UUID: "event-2", Attribute: []Attribute{
+			{UUID: "2a", Type: TypeIPDst, Value: "198.51.100.7"},
+			{UUID: "2b", Type: TypeIPDst, Value: "2001:db8::1"},
+			{UUID: "2c", Type: TypeIPDst, Value: "198.51.100.0/24"},
+		}},
+		{UUID: "event-3", Attribute: []Attribute{
+			{UUID: "3a", Type: TypeIPDst, Value: "198.51.100.7"},
+		}},
+	}
+
+	correlations := (&Correlator{}).Correlate(events)
+	if len(correlations) != 3 {
+		t.Fatalf("Expected 3 correlations, got %d: %+v", len(correlations), correlations)
+	}
+
+	got := make(map[string]string)
+	for _, c := range correlations {
+		for _, attr := range c.Attributes {
+			got[attr.A.UUID+"-"+attr.B.UUID] = attr.Kind
+		}
+	}
+	want := map[string]string{
+		"1a-2a": CorrelationCIDR,
+		"1a-2c": CorrelationCIDR,
+		"1b-2b": CorrelationCIDR,
+		"1a-3a": CorrelationCIDR,
+		"2a-3a": CorrelationValue,
+		"2c-3a": CorrelationCIDR,
+	}
+	if len(got) != len(want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+	for pair, kind := range want {
+		if got[pair] != kind {
+			t.Errorf("Expected %s correlation for %s, got %q", kind, pair, got[pair])
+		}
+	}
+}
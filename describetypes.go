@@ -0,0 +1,267 @@
+package misp
+
+import (
+	_ "embed" // bundled describeTypes.json
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/mail"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+//go:embed data/describeTypes.json
+var bundledDescribeTypes []byte
+
+// DefaultDescribeTypes is the attribute type and category matrix used for
+// local validation. It is initialized from a bundled copy of MISP's
+// describeTypes.json and can be replaced by the one of a given server, see
+// Client.GetDescribeTypes.
+var DefaultDescribeTypes *DescribeTypes
+
+func init() {
+	var err error
+	DefaultDescribeTypes, err = ParseDescribeTypes(bundledDescribeTypes)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// TypeDefault holds the default category and IDS flag of an attribute type
+type TypeDefault struct {
+	DefaultCategory string `json:"default_category"`
+	ToIDS           int    `json:"to_ids"`
+}
+
+// DescribeTypes is the matrix of valid attribute types and categories, as
+// returned by /attributes/describeTypes.json
+type DescribeTypes struct {
+	SaneDefaults         map[string]TypeDefault `json:"sane_defaults"`
+	Types                []string               `json:"types"`
+	Categories           []string               `json:"categories"`
+	CategoryTypeMappings map[string][]string    `json:"category_type_mappings"`
+
+	types      map[string]bool
+	composite  map[string]bool
+	categories map[string]map[string]bool
+}
+
+// ParseDescribeTypes decodes the content of describeTypes.json
+func ParseDescribeTypes(data []byte) (*DescribeTypes, error) {
+	var outer struct {
+		Result DescribeTypes `json:"result"`
+	}
+	if err := json.Unmarshal(data, &outer); err != nil {
+		return nil, fmt.Errorf("Could not unmarshal describeTypes: %s", err)
+	}
+
+	d := &outer.Result
+	d.index()
+
+	return d, nil
+}
+
+func (d *DescribeTypes) index() {
+	d.types = make(map[string]bool, len(d.Types))
+	d.composite = make(map[string]bool)
+	for _, t := range d.Types {
+		d.types[t] = true
+		if _, ok := compositeTypeParts[t]; ok || strings.Contains(t, "|") {
+			d.composite[t] = true
+		}
+	}
+
+	d.categories = make(map[string]map[string]bool, len(d.Categories))
+	for _, category := range d.Categories {
+		d.categories[category] = make(map[string]bool)
+		for _, t := range d.CategoryTypeMappings[category] {
+			d.categories[category][t] = true
+		}
+	}
+}
+
+// GetDescribeTypes fetches the attribute type and category matrix of the server
+func (client *Client) GetDescribeTypes() (*DescribeTypes, error) {
+	resp, err := client.Get("/attributes/describeTypes.json", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading describeTypes: %s", err)
+	}
+
+	return ParseDescribeTypes(data)
+}
+
+// IsValidType tells whether attrType is a known attribute type
+func (d *DescribeTypes) IsValidType(attrType string) bool {
+	return d.types[attrType]
+}
+
+// IsCompositeType tells whether values of attrType are made of several parts
+// separated by a "|". As in MISP, these are the types whose name contains a
+// "|", and malware-sample.
+func (d *DescribeTypes) IsCompositeType(attrType string) bool {
+	return d.composite[attrType]
+}
+
+// IsValidCategory tells whether category is a known attribute category
+func (d *DescribeTypes) IsValidCategory(category string) bool {
+	_, ok := d.categories[category]
+	return ok
+}
+
+// IsValidCombination tells whether attributes of type attrType may be
+// filed under category
+func (d *DescribeTypes) IsValidCombination(category, attrType string) bool {
+	return d.categories[category][attrType]
+}
+
+// DefaultCategory returns the category MISP uses for attrType when none is given
+func (d *DescribeTypes) DefaultCategory(attrType string) string {
+	return d.SaneDefaults[attrType].DefaultCategory
+}
+
+// DefaultToIDS tells whether attributes of type attrType are flagged for IDS
+// export by default
+func (d *DescribeTypes) DefaultToIDS(attrType string) bool {
+	return d.SaneDefaults[attrType].ToIDS == 1
+}
+
+// ApplyDefaults sets the default category of the attribute type if the
+// attribute has no category yet. The IDS flag is left as is, as an unset flag
+// cannot be told from a cleared one: see DefaultToIDS.
+func (d *DescribeTypes) ApplyDefaults(attr *Attribute) {
+	if attr.Category == "" {
+		attr.Category = d.DefaultCategory(attr.Type)
+	}
+}
+
+// ValidateAttribute checks the type and category of attr, and that its value
+// has the format expected for its type
+func (d *DescribeTypes) ValidateAttribute(attr *Attribute) error {
+	if !d.IsValidType(attr.Type) {
+		return fmt.Errorf("Unknown attribute type %q", attr.Type)
+	}
+
+	if attr.Category != "" {
+		if !d.IsValidCategory(attr.Category) {
+			return fmt.Errorf("Unknown attribute category %q", attr.Category)
+		}
+		if !d.IsValidCombination(attr.Category, attr.Type) {
+			return fmt.Errorf("Attribute type %q is not allowed in category %q", attr.Type, attr.Category)
+		}
+	}
+
+	if attr.Value == "" {
+		return fmt.Errorf("Empty value for attribute type %q", attr.Type)
+	}
+
+	return validateValue(attr.Type, attr.Value)
+}
+
+// ValidateAttribute checks attr against DefaultDescribeTypes
+func ValidateAttribute(attr *Attribute) error {
+	return DefaultDescribeTypes.ValidateAttribute(attr)
+}
+
+// hexLengths is the length of the hex encoded digests of hash types
+var hexLengths = map[string]int{
+	TypeMD5:                   32,
+	TypeSHA1:                  40,
+	TypeSHA224:                56,
+	TypeSHA256:                64,
+	TypeSHA384:                96,
+	TypeSHA512:                128,
+	TypeSHA512_224:            56,
+	TypeSHA512_256:            64,
+	TypeSHA3_224:              56,
+	TypeSHA3_256:              64,
+	TypeSHA3_384:              96,
+	TypeSHA3_512:              128,
+	TypeImphash:               32,
+	TypeAuthentihash:          64,
+	TypeCDHash:                40,
+	TypeX509FingerprintMD5:    32,
+	TypeX509FingerprintSHA1:   40,
+	TypeX509FingerprintSHA256: 64,
+	TypeJA3FingerprintMD5:     32,
+	TypeHASSHMD5:              32,
+	TypeHASSHServerMD5:        32,
+}
+
+var (
+	hexRegexp      = regexp.MustCompile(`^[0-9a-fA-F]+$`)
+	ssdeepRegexp   = regexp.MustCompile(`^\d+:[0-9A-Za-z/+]*:[0-9A-Za-z/+]*$`)
+	hostnameRegexp = regexp.MustCompile(`^(?i)([a-z0-9_]([a-z0-9_-]{0,61}[a-z0-9_])?\.)+[a-z0-9-]{2,63}\.?$`)
+	asRegexp       = regexp.MustCompile(`^(?i)(AS)?\s*\d+$`)
+	btcRegexp      = regexp.MustCompile(`^([13][1-9A-HJ-NP-Za-km-z]{25,34}|bc1[02-9ac-hj-np-z]{11,71})$`)
+)
+
+// validateValue checks the format of value for the given attribute type,
+// including each part of composite values. Types without a well-defined format
+// are accepted as is.
+func validateValue(attrType, value string) error {
+	if IsCompositeType(attrType) {
+		return validateComposite(attrType, value)
+	}
+
+	if length, ok := hexLengths[attrType]; ok {
+		if len(value) != length || !hexRegexp.MatchString(value) {
+			return fmt.Errorf("Invalid %s value %q: expected %d hexadecimal characters", attrType, value, length)
+		}
+		return nil
+	}
+
+	switch attrType {
+	case TypeIPSrc, TypeIPDst:
+		if net.ParseIP(value) == nil {
+			if _, _, err := net.ParseCIDR(value); err != nil {
+				return fmt.Errorf("Invalid %s value %q: not an IP address or CIDR block", attrType, value)
+			}
+		}
+	case TypeDomain, TypeHostname:
+		if !hostnameRegexp.MatchString(value) {
+			return fmt.Errorf("Invalid %s value %q", attrType, value)
+		}
+	case TypePort:
+		if port, err := strconv.Atoi(value); err != nil || port < 0 || port > 65535 {
+			return fmt.Errorf("Invalid port value %q", value)
+		}
+	case TypeEmail, TypeEmailSrc, TypeEmailDst, TypeTargetEmail, TypeWhoisRegistrantEmail, TypeDNSSOAEmail:
+		if address, err := mail.ParseAddress(value); err != nil || address.Address != value || !strings.Contains(value, "@") {
+			return fmt.Errorf("Invalid %s value %q: not an email address", attrType, value)
+		}
+	case TypeSSDeep:
+		if !ssdeepRegexp.MatchString(value) {
+			return fmt.Errorf("Invalid ssdeep value %q", value)
+		}
+	case TypeMACAddress, TypeMACEUI64:
+		if _, err := net.ParseMAC(value); err != nil {
+			return fmt.Errorf("Invalid %s value %q", attrType, value)
+		}
+	case TypeAS:
+		if !asRegexp.MatchString(value) {
+			return fmt.Errorf("Invalid AS value %q", value)
+		}
+	case TypeBTC:
+		if !btcRegexp.MatchString(value) {
+			return fmt.Errorf("Invalid btc value %q", value)
+		}
+	case TypeCounter, TypeSizeInBytes:
+		if _, err := strconv.ParseUint(value, 10, 64); err != nil {
+			return fmt.Errorf("Invalid %s value %q: not a positive integer", attrType, value)
+		}
+	case TypeFloat:
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			return fmt.Errorf("Invalid float value %q", value)
+		}
+	}
+
+	return nil
+}
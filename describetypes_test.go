@@ -0,0 +1,82 @@
+package misp
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func Test_ValidateAttribute(t *testing.T) {
+	tests := []struct {
+		attr  Attribute
+		valid bool
+	}{
+		{Attribute{Type: TypeMD5, Value: "68b329da9893e34099c7d8ad5cb9c940"}, true},
+		{Attribute{Type: TypeMD5, Value: "68b329da9893e34099c7d8ad5cb9c94"}, false},
+		{Attribute{Type: TypeMD5, Category: CategoryPayloadDelivery, Value: "68b329da9893e34099c7d8ad5cb9c940"}, true},
+		{Attribute{Type: TypeMD5, Category: CategoryFinancialFraud, Value: "68b329da9893e34099c7d8ad5cb9c940"}, false},
+		{Attribute{Type: TypeMD5, Category: "Payload Delivery", Value: "68b329da9893e34099c7d8ad5cb9c940"}, false},
+		{Attribute{Type: "ip-dest", Value: "203.0.113.7"}, false},
+		{Attribute{Type: TypeIPDst, Value: "203.0.113.7"}, true},
+		{Attribute{Type: TypeIPDst, Value: "203.0.113.0/24"}, true},
+		{Attribute{Type: TypeIPDst, Value: "203.0.113.256"}, false},
+		{Attribute{Type: TypeDomain, Value: "evil.example.com"}, true},
+		{Attribute{Type: TypeDomain, Value: "evil..com"}, false},
+		{Attribute{Type: TypeEmailSrc, Value: "evil@example.com"}, true},
+		{Attribute{Type: TypeEmailSrc, Value: "Evil <evil@example.com>"}, false},
+		{Attribute{Type: TypePort, Value: "65536"}, false},
+		{Attribute{Type: TypeText, Value: "anything goes"}, true},
+		{Attribute{Type: TypeText, Value: ""}, false},
+	}
+
+	for _, test := range tests {
+		err := ValidateAttribute(&test.attr)
+		if (err == nil) != test.valid {
+			t.Errorf("ValidateAttribute(%+v) returned %v, want valid=%v", test.attr, err, test.valid)
+		}
+	}
+}
+
+func Test_ApplyDefaults(t *testing.T) {
+	attr := Attribute{Type: TypeIPDst, Value: "203.0.113.7"}
+	DefaultDescribeTypes.ApplyDefaults(&attr)
+	if attr.Category != CategoryNetworkActivity || attr.ToIDS || !DefaultDescribeTypes.DefaultToIDS(attr.Type) {
+		t.Errorf("ApplyDefaults set category=%q to_ids=%v", attr.Category, attr.ToIDS)
+	}
+
+	// The IDS flag set by the caller is kept
+	attr = Attribute{Type: TypeComment, Value: "note", ToIDS: true}
+	DefaultDescribeTypes.ApplyDefaults(&attr)
+	if attr.Category != CategoryOther || !attr.ToIDS {
+		t.Errorf("ApplyDefaults set category=%q to_ids=%v", attr.Category, attr.ToIDS)
+	}
+
+	// every type must have a valid default category
+	for _, attrType := range DefaultDescribeTypes.Types {
+		category := DefaultDescribeTypes.DefaultCategory(attrType)
+		if !DefaultDescribeTypes.IsValidCombination(category, attrType) {
+			t.Errorf("Default category %q of type %q is not valid", category, attrType)
+		}
+	}
+}
+
+func Test_GetDescribeTypes(t *testing.T) {
+	setup()
+
+	mux.HandleFunc("/attributes/describeTypes.json",
+		func(w http.ResponseWriter, r *http.Request) {
+			testMethod(t, r, "GET")
+			testAuthentication(t, r)
+
+			fmt.Fprint(w, `{"result": {"sane_defaults": {"md5": {"default_category": "Payload delivery", "to_ids": 1}}, "types": ["md5"], "categories": ["Payload delivery"], "category_type_mappings": {"Payload delivery": ["md5"]}}}`)
+		})
+
+	d, err := client.GetDescribeTypes()
+	if err != nil {
+		t.Fatalf("GetDescribeTypes returned error: %s", err)
+	}
+
+	if !d.IsValidCombination(CategoryPayloadDelivery, TypeMD5) || d.IsValidType(TypeSHA1) {
+		t.Errorf("GetDescribeTypes returned unexpected matrix: %+v", d)
+	}
+}
@@ -0,0 +1,195 @@
+package misp
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// EmailObjects holds the MISP objects describing an email: the email object
+// itself and one file object per attachment, referenced from the email object
+type EmailObjects struct {
+	Email       *Object
+	Attachments []*Object
+}
+
+// Objects returns all generated objects, ready to be appended to Event.Objects
+func (e *EmailObjects) Objects() []Object {
+	objects := []Object{*e.Email}
+	for _, attachment := range e.Attachments {
+		objects = append(objects, *attachment)
+	}
+	return objects
+}
+
+var (
+	receivedFromRegexp = regexp.MustCompile(`(?i)\bfrom\s+([a-z0-9.-]+\.[a-z]{2,})`)
+	receivedIPRegexp   = regexp.MustCompile(`\[(?i:IPv6:)?([0-9a-fA-F:.]+)\]`)
+)
+
+// MakeEmailObjects parses the given .eml file, see ParseEmail
+func MakeEmailObjects(filename string) (*EmailObjects, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("Error opening %s: %s", filename, err)
+	}
+	defer f.Close()
+
+	return ParseEmail(f)
+}
+
+// ParseEmail reads an RFC 5322 message and generates an email object from its
+// headers. Each attachment is turned into a file object referenced from the
+// email object with an "attachment" relationship.
+func ParseEmail(r io.Reader) (*EmailObjects, error) {
+	msg, err := mail.ReadMessage(r)
+	if err != nil {
+		return nil, fmt.Errorf("Could not parse email: %s", err)
+	}
+
+	email := NewObject("email", "network")
+	result := &EmailObjects{Email: email}
+
+	addEmailAddresses(email, msg.Header, "From", "from", "email-src", "email-src-display-name")
+	addEmailAddresses(email, msg.Header, "To", "to", "email-dst", "email-dst-display-name")
+	addEmailAddresses(email, msg.Header, "Cc", "cc", "email-dst", "email-dst-display-name")
+	addEmailAddresses(email, msg.Header, "Reply-To", "reply-to", "email-reply-to", "")
+	addEmailAddresses(email, msg.Header, "Return-Path", "return-path", "email-src", "")
+
+	email.AddAttribute("subject", "email-subject", decodeEmailHeader(msg.Header.Get("Subject")))
+
+	email.AddAttribute("message-id", "email-message-id", strings.Trim(msg.Header.Get("Message-Id"), "<> "))
+	email.AddAttribute("in-reply-to", "email-message-id", strings.Trim(msg.Header.Get("In-Reply-To"), "<> "))
+	email.AddAttribute("x-mailer", "email-x-mailer", msg.Header.Get("X-Mailer"))
+	email.AddAttribute("user-agent", "text", msg.Header.Get("User-Agent"))
+	email.AddAttribute("thread-index", "email-thread-index", msg.Header.Get("Thread-Index"))
+
+	if date, err := msg.Header.Date(); err == nil {
+		email.AddAttribute("send-date", "datetime", date.UTC().Format(time.RFC3339))
+	}
+
+	for _, received := range msg.Header["Received"] {
+		email.AddAttribute("received-header", "email-header", received)
+		for _, match := range receivedFromRegexp.FindAllStringSubmatch(received, -1) {
+			email.AddAttribute("received-header-hostname", "hostname", strings.ToLower(match[1]))
+		}
+		for _, match := range receivedIPRegexp.FindAllStringSubmatch(received, -1) {
+			if ip := net.ParseIP(match[1]); ip != nil {
+				email.AddAttribute("received-header-ip", "ip-src", ip.String())
+			}
+		}
+	}
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || !strings.HasPrefix(mediaType, "multipart/") {
+		return result, nil
+	}
+
+	email.AddAttribute("mime-boundary", "email-mime-boundary", params["boundary"])
+	if err = result.parseParts(multipart.NewReader(msg.Body, params["boundary"])); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// decodeEmailHeader decodes the RFC 2047 encoded words of value, which is
+// returned as is if they cannot be decoded
+func decodeEmailHeader(value string) string {
+	decoder := new(mime.WordDecoder)
+	decoded, err := decoder.DecodeHeader(value)
+	if err != nil {
+		return value
+	}
+	return decoded
+}
+
+// addEmailAddresses adds one attribute per address of the given header, and
+// their display names if displayType is not empty
+func addEmailAddresses(email *Object, header mail.Header, key, relation, attrType, displayType string) {
+	value := header.Get(key)
+	if value == "" {
+		return
+	}
+
+	addresses, err := mail.ParseAddressList(value)
+	if err != nil {
+		// Keep the raw value rather than losing the header
+		email.AddAttribute(relation, attrType, strings.Trim(value, "<> "))
+		return
+	}
+
+	for _, address := range addresses {
+		email.AddAttribute(relation, attrType, address.Address)
+		if displayType != "" {
+			email.AddAttribute(relation+"-display-name", displayType, address.Name)
+		}
+	}
+}
+
+func (e *EmailObjects) parseParts(reader *multipart.Reader) error {
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("Could not read MIME part: %s", err)
+		}
+
+		mediaType, params, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		if strings.HasPrefix(mediaType, "multipart/") {
+			if err = e.parseParts(multipart.NewReader(part, params["boundary"])); err != nil {
+				return err
+			}
+			continue
+		}
+
+		_, disposition, _ := mime.ParseMediaType(part.Header.Get("Content-Disposition"))
+		filename := defaultString(disposition["filename"], params["name"])
+		if filename == "" {
+			continue
+		}
+		// Many mailers encode non-ASCII file names as RFC 2047 words, whose
+		// base64 text may contain a "/"
+		filename = filepath.Base(decodeEmailHeader(filename))
+
+		data, err := readPartBody(part)
+		if err != nil {
+			return fmt.Errorf("Could not decode attachment %s: %s", filename, err)
+		}
+
+		attachment := makeFileObject(filename, data)
+		e.Email.AddAttribute("attachment", "email-attachment", filename)
+		e.Email.AddReference(attachment.UUID, "attachment")
+		e.Attachments = append(e.Attachments, attachment)
+	}
+}
+
+// readPartBody returns the decoded content of a MIME part. multipart.Reader
+// transparently decodes quoted-printable but not base64.
+func readPartBody(part *multipart.Part) ([]byte, error) {
+	raw, err := ioutil.ReadAll(part)
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.EqualFold(part.Header.Get("Content-Transfer-Encoding"), "base64") {
+		// Line breaks are not part of the base64 alphabet
+		raw = bytes.Join(bytes.Fields(raw), nil)
+		return base64.StdEncoding.DecodeString(string(raw))
+	}
+
+	return raw, nil
+}
@@ -0,0 +1,114 @@
+package misp
+
+import (
+	"strings"
+	"testing"
+)
+
+const testEmail = "Received: from mail.evil.example (mail.evil.example [203.0.113.7])\r\n" +
+	"\tby mx.example.org with ESMTP id 42\r\n" +
+	"From: \"Evil Sender\" <evil@evil.example>\r\n" +
+	"To: victim@example.org, other@example.org\r\n" +
+	"Subject: =?utf-8?q?Invoice_n=C2=B01?=\r\n" +
+	"Message-ID: <1234@evil.example>\r\n" +
+	"Return-Path: <bounce@evil.example>\r\n" +
+	"X-Mailer: EvilMailer 1.0\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/mixed; boundary=\"BOUNDARY\"\r\n" +
+	"\r\n" +
+	"--BOUNDARY\r\n" +
+	"Content-Type: text/plain\r\n" +
+	"\r\n" +
+	"Please find the invoice attached.\r\n" +
+	"--BOUNDARY\r\n" +
+	"Content-Type: application/octet-stream; name=\"invoice.exe\"\r\n" +
+	"Content-Disposition: attachment; filename=\"invoice.exe\"\r\n" +
+	"Content-Transfer-Encoding: base64\r\n" +
+	"\r\n" +
+	"TVqQAAMAAAAEAAAA\r\n" +
+	"--BOUNDARY--\r\n"
+
+const testEmailEncoded = "Received: from [IPv6:2001:DB8::25] (unknown [dead])\r\n" +
+	"\tby mx.example.org ([1.2]) with ESMTP id 43; from relay [198.51.100.1]\r\n" +
+	"From: evil@evil.example\r\n" +
+	"Subject: =?x-unknown?q?Facture?=\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/mixed; boundary=\"BOUNDARY\"\r\n" +
+	"\r\n" +
+	"--BOUNDARY\r\n" +
+	"Content-Type: application/octet-stream\r\n" +
+	"Content-Disposition: attachment; filename=\"=?utf-8?b?ZmFjdHVyZV/DqXTDqS5leGU=?=\"\r\n" +
+	"\r\n" +
+	"MZ\r\n" +
+	"--BOUNDARY--\r\n"
+
+func Test_ParseEmail(t *testing.T) {
+	result, err := ParseEmail(strings.NewReader(testEmail))
+	if err != nil {
+		t.Fatalf("ParseEmail returned error: %s", err)
+	}
+
+	want := map[string][]string{
+		"from":                     {"evil@evil.example"},
+		"from-display-name":        {"Evil Sender"},
+		"to":                       {"victim@example.org", "other@example.org"},
+		"subject":                  {"Invoice n°1"},
+		"message-id":               {"1234@evil.example"},
+		"return-path":              {"bounce@evil.example"},
+		"x-mailer":                 {"EvilMailer 1.0"},
+		"received-header-hostname": {"mail.evil.example"},
+		"received-header-ip":       {"203.0.113.7"},
+		"attachment":               {"invoice.exe"},
+	}
+
+	for relation, values := range want {
+		attrs := result.Email.GetAttributes(relation)
+		if len(attrs) != len(values) {
+			t.Errorf("%s: got %d attributes, want %d", relation, len(attrs), len(values))
+			continue
+		}
+		for i, value := range values {
+			if attrs[i].Value != value {
+				t.Errorf("%s: got %q, want %q", relation, attrs[i].Value, value)
+			}
+		}
+	}
+
+	if len(result.Attachments) != 1 {
+		t.Fatalf("got %d attachments, want 1", len(result.Attachments))
+	}
+
+	attachment := result.Attachments[0]
+	if size := attachment.GetAttributes("size-in-bytes"); len(size) != 1 || size[0].Value != "12" {
+		t.Errorf("attachment was not decoded: %+v", size)
+	}
+
+	if len(result.Email.References) != 1 || result.Email.References[0].ReferencedUUID != attachment.UUID {
+		t.Errorf("email object does not reference its attachment: %+v", result.Email.References)
+	}
+}
+
+func Test_ParseEmailEncoded(t *testing.T) {
+	result, err := ParseEmail(strings.NewReader(testEmailEncoded))
+	if err != nil {
+		t.Fatalf("ParseEmail returned error: %s", err)
+	}
+
+	want := map[string][]string{
+		"received-header-ip": {"2001:db8::25", "198.51.100.1"},
+		"subject":            {"=?x-unknown?q?Facture?="},
+		"attachment":         {"facture_été.exe"},
+	}
+	for relation, values := range want {
+		attrs := result.Email.GetAttributes(relation)
+		if len(attrs) != len(values) {
+			t.Errorf("%s: got %+v, want %q", relation, attrs, values)
+			continue
+		}
+		for i, value := range values {
+			if attrs[i].Value != value {
+				t.Errorf("%s: got %q, want %q", relation, attrs[i].Value, value)
+			}
+		}
+	}
+}
@@ -4,47 +4,182 @@ import (
 	"encoding/json"
 	"fmt"
 	"strconv"
+	"strings"
 )
 
 // Event represents a MISP event
 type Event struct {
-	client    *Client
-	ID        string      `json:"id"`
-	UUID      string      `json:"uuid"`
-	Attribute []Attribute `json:"Attribute"`
-	Tags      []Tag       `json:"Tag"`
-	Objects   []Object    `json:"Object"`
-	Info      string      `json:"Info"`
-	Date      string      `json:"Date"`
-	Org       Org         `json::Org`
-	Orgc      Org         `json::Orgc`
+	client             *Client
+	ID                 string         `json:"id,omitempty"`
+	OrgID              string         `json:"org_id,omitempty"`
+	OrgcID             string         `json:"orgc_id,omitempty"`
+	UUID               string         `json:"uuid"`
+	Info               string         `json:"info"`
+	Date               string         `json:"date"`
+	ThreatLevelID      string         `json:"threat_level_id,omitempty"`
+	Analysis           string         `json:"analysis,omitempty"`
+	Distribution       string         `json:"distribution,omitempty"`
+	SharingGroupID     string         `json:"sharing_group_id,omitempty"`
+	Published          bool           `json:"published"`
+	Timestamp          string         `json:"timestamp,omitempty"`
+	PublishTimestamp   string         `json:"publish_timestamp,omitempty"`
+	AttributeCount     string         `json:"attribute_count,omitempty"`
+	ProposalEmailLock  bool           `json:"proposal_email_lock,omitempty"`
+	Locked             bool           `json:"locked,omitempty"`
+	DisableCorrelation bool           `json:"disable_correlation,omitempty"`
+	ExtendsUUID        string         `json:"extends_uuid,omitempty"`
+	EventCreatorEmail  string         `json:"event_creator_email,omitempty"`
+	Org                Org            `json:"Org"`
+	Orgc               Org            `json:"Orgc"`
+	Attribute          []Attribute    `json:"Attribute,omitempty"`
+	ShadowAttributes   []Attribute    `json:"ShadowAttribute,omitempty"`
+	Objects            []Object       `json:"Object,omitempty"`
+	Tags               []Tag          `json:"Tag,omitempty"`
+	Galaxies           []Galaxy       `json:"Galaxy,omitempty"`
+	RelatedEvents      []RelatedEvent `json:"RelatedEvent,omitempty"`
+	EventReports       []EventReport  `json:"EventReport,omitempty"`
+
+	// Fields unknown to this package, kept by ReadEvent for WriteEvent
+	Extra map[string]json.RawMessage `json:"-"`
 }
 
 // Tag represents an event tag
 type Tag struct {
-	ID         string `json:"id"`
+	ID         string `json:"id,omitempty"`
 	Name       string `json:"name"`
-	Colour     string `json:"colour"`
+	Colour     string `json:"colour,omitempty"`
 	Exportable bool   `json:"exportable"`
+	HideTag    bool   `json:"hide_tag,omitempty"`
+	Local      Flag   `json:"local,omitempty"`
+
+	// Fields unknown to this package, kept when decoding for encoding
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// Flag is a boolean which MISP encodes as true or false, 0 or 1, or "0" or
+// "1" depending on the field and the version
+type Flag bool
+
+// UnmarshalJSON accepts the encodings of Flag
+func (f *Flag) UnmarshalJSON(data []byte) error {
+	switch strings.Trim(string(data), `"`) {
+	case "true", "1":
+		*f = true
+	case "false", "0", "", "null":
+		*f = false
+	default:
+		return fmt.Errorf("Invalid flag %s", data)
+	}
+	return nil
 }
 
 // Org represents an event tag
 type Org struct {
-	ID   string `json:"id"`
+	ID   string `json:"id,omitempty"`
 	Name string `json:"name"`
-	UUID string `json:"uuid"`
+	UUID string `json:"uuid,omitempty"`
+
+	// Fields unknown to this package, kept when decoding for encoding
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// Galaxy is a set of clusters, such as threat actors or ATT&CK techniques,
+// attached to an event or an attribute
+type Galaxy struct {
+	ID             string          `json:"id,omitempty"`
+	UUID           string          `json:"uuid"`
+	Name           string          `json:"name"`
+	Type           string          `json:"type"`
+	Description    string          `json:"description,omitempty"`
+	Version        string          `json:"version,omitempty"`
+	Icon           string          `json:"icon,omitempty"`
+	Namespace      string          `json:"namespace,omitempty"`
+	KillChainOrder json.RawMessage `json:"kill_chain_order,omitempty"`
+	Clusters       []GalaxyCluster `json:"GalaxyCluster,omitempty"`
+
+	// Fields unknown to this package, kept when decoding for encoding
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// GalaxyCluster is an element of a galaxy, attached through its tag name
+type GalaxyCluster struct {
+	ID          string                 `json:"id,omitempty"`
+	UUID        string                 `json:"uuid"`
+	Type        string                 `json:"type"`
+	Value       string                 `json:"value"`
+	TagName     string                 `json:"tag_name"`
+	Description string                 `json:"description,omitempty"`
+	GalaxyID    string                 `json:"galaxy_id,omitempty"`
+	Source      string                 `json:"source,omitempty"`
+	Authors     []string               `json:"authors,omitempty"`
+	Version     string                 `json:"version,omitempty"`
+	Meta        map[string]interface{} `json:"meta,omitempty"`
+
+	// Fields unknown to this package, kept when decoding for encoding
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// RelatedEvent is an event correlating with the current one
+type RelatedEvent struct {
+	Event Event `json:"Event"`
+}
+
+// EventReport is a markdown report attached to an event
+type EventReport struct {
+	ID             string `json:"id,omitempty"`
+	UUID           string `json:"uuid"`
+	EventID        string `json:"event_id,omitempty"`
+	Name           string `json:"name"`
+	Content        string `json:"content"`
+	Distribution   string `json:"distribution,omitempty"`
+	SharingGroupID string `json:"sharing_group_id,omitempty"`
+	Timestamp      string `json:"timestamp,omitempty"`
+	Deleted        bool   `json:"deleted,omitempty"`
+
+	// Fields unknown to this package, kept when decoding for encoding
+	Extra map[string]json.RawMessage `json:"-"`
 }
 
 // Object is a MISP object
 type Object struct {
-	ID           string      `json:"id"`
-	Name         string      `json:"name"`
-	MetaCategory string      `json:"meta-category"`
-	Description  string      `json:"description"`
-	EventID      string      `json:"event_id"`
-	UUID         string      `json:"uuid"`
-	Timestamp    string      `json:"timestamp"`
-	Attributes   []Attribute `json:"Attribute"`
+	ID              string            `json:"id,omitempty"`
+	Name            string            `json:"name"`
+	MetaCategory    string            `json:"meta-category"`
+	Description     string            `json:"description,omitempty"`
+	TemplateUUID    string            `json:"template_uuid,omitempty"`
+	TemplateVersion string            `json:"template_version,omitempty"`
+	EventID         string            `json:"event_id,omitempty"`
+	UUID            string            `json:"uuid"`
+	Timestamp       string            `json:"timestamp,omitempty"`
+	Comment         string            `json:"comment,omitempty"`
+	Distribution    string            `json:"distribution,omitempty"`
+	SharingGroupID  string            `json:"sharing_group_id,omitempty"`
+	Deleted         bool              `json:"deleted,omitempty"`
+	FirstSeen       string            `json:"first_seen,omitempty"`
+	LastSeen        string            `json:"last_seen,omitempty"`
+	Attributes      []Attribute       `json:"Attribute"`
+	References      []ObjectReference `json:"ObjectReference,omitempty"`
+
+	// Fields unknown to this package, kept by ReadEvent for WriteEvent
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// ObjectReference links an object to another object or attribute
+type ObjectReference struct {
+	ID               string `json:"id,omitempty"`
+	UUID             string `json:"uuid,omitempty"`
+	Timestamp        string `json:"timestamp,omitempty"`
+	ObjectID         string `json:"object_id,omitempty"`
+	ObjectUUID       string `json:"object_uuid,omitempty"`
+	ReferencedID     string `json:"referenced_id,omitempty"`
+	ReferencedUUID   string `json:"referenced_uuid,omitempty"`
+	ReferencedType   string `json:"referenced_type,omitempty"`
+	RelationshipType string `json:"relationship_type,omitempty"`
+	Comment          string `json:"comment,omitempty"`
+	Deleted          bool   `json:"deleted,omitempty"`
+
+	// Fields unknown to this package, kept when decoding for encoding
+	Extra map[string]json.RawMessage `json:"-"`
 }
 
 // DownloadResponse represents the response of a DownloadRequest
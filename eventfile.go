@@ -0,0 +1,519 @@
+package misp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// eventFile is the envelope of the MISP core format
+type eventFile struct {
+	Event *fileEvent `json:"Event"`
+}
+
+// fileEvent, fileObject and fileAttribute are the MISP core format of events,
+// objects and attributes. Unlike the API structures, they always carry the
+// to_ids and disable_correlation flags, as MISP applies the defaults of the
+// attribute type to missing flags, and they keep the fields unknown to this
+// package in Extra.
+type fileEvent struct {
+	Event
+	Org              *Org            `json:"Org,omitempty"`
+	Orgc             *Org            `json:"Orgc,omitempty"`
+	Attribute        []fileAttribute `json:"Attribute,omitempty"`
+	ShadowAttributes []fileAttribute `json:"ShadowAttribute,omitempty"`
+	Objects          []fileObject    `json:"Object,omitempty"`
+}
+
+type fileObject struct {
+	Object
+	Attributes []fileAttribute `json:"Attribute"`
+}
+
+type fileAttribute struct {
+	Attribute
+	DisableCorrelation bool `json:"disable_correlation"`
+	ToIDS              bool `json:"to_ids"`
+}
+
+func newFileEvent(event *Event) *fileEvent {
+	f := &fileEvent{
+		Event:            *event,
+		Attribute:        newFileAttributes(event.Attribute),
+		ShadowAttributes: newFileAttributes(event.ShadowAttributes),
+	}
+	if !reflect.DeepEqual(event.Org, Org{}) {
+		f.Org = &event.Org
+	}
+	if !reflect.DeepEqual(event.Orgc, Org{}) {
+		f.Orgc = &event.Orgc
+	}
+	for _, object := range event.Objects {
+		f.Objects = append(f.Objects, fileObject{Object: object, Attributes: newFileAttributes(object.Attributes)})
+	}
+	return f
+}
+
+func newFileAttributes(attrs []Attribute) []fileAttribute {
+	var result []fileAttribute
+	for _, attr := range attrs {
+		result = append(result, fileAttribute{Attribute: attr, DisableCorrelation: attr.DisableCorrelation, ToIDS: attr.ToIDS})
+	}
+	return result
+}
+
+func (f *fileEvent) event() *Event {
+	event := f.Event
+	event.Attribute = fileAttributes(f.Attribute)
+	event.ShadowAttributes = fileAttributes(f.ShadowAttributes)
+	if f.Org != nil {
+		event.Org = *f.Org
+	}
+	if f.Orgc != nil {
+		event.Orgc = *f.Orgc
+	}
+	event.Objects = nil
+	for _, object := range f.Objects {
+		result := object.Object
+		result.Attributes = fileAttributes(object.Attributes)
+		event.Objects = append(event.Objects, result)
+	}
+	return &event
+}
+
+func fileAttributes(attrs []fileAttribute) []Attribute {
+	var result []Attribute
+	for _, attr := range attrs {
+		result = append(result, attr.Attribute)
+		result[len(result)-1].DisableCorrelation = attr.DisableCorrelation
+		result[len(result)-1].ToIDS = attr.ToIDS
+	}
+	return result
+}
+
+func (f *fileEvent) UnmarshalJSON(data []byte) error {
+	type plain fileEvent
+	if err := json.Unmarshal(data, (*plain)(f)); err != nil {
+		return err
+	}
+	f.Event.Extra = unknownFields(data, reflect.TypeOf(f).Elem())
+	return nil
+}
+
+func (f fileEvent) MarshalJSON() ([]byte, error) {
+	type plain fileEvent
+	return marshalWithExtra(plain(f), f.Event.Extra)
+}
+
+func (f *fileObject) UnmarshalJSON(data []byte) error {
+	type plain fileObject
+	if err := json.Unmarshal(data, (*plain)(f)); err != nil {
+		return err
+	}
+	f.Object.Extra = unknownFields(data, reflect.TypeOf(f).Elem())
+	return nil
+}
+
+func (f fileObject) MarshalJSON() ([]byte, error) {
+	type plain fileObject
+	return marshalWithExtra(plain(f), f.Object.Extra)
+}
+
+func (f *fileAttribute) UnmarshalJSON(data []byte) error {
+	type plain fileAttribute
+	if err := json.Unmarshal(data, (*plain)(f)); err != nil {
+		return err
+	}
+	f.Attribute.Extra = unknownFields(data, reflect.TypeOf(f).Elem())
+	return nil
+}
+
+func (f fileAttribute) MarshalJSON() ([]byte, error) {
+	type plain fileAttribute
+	return marshalWithExtra(plain(f), f.Attribute.Extra)
+}
+
+func (t *Tag) UnmarshalJSON(data []byte) error {
+	type plain Tag
+	if err := json.Unmarshal(data, (*plain)(t)); err != nil {
+		return err
+	}
+	t.Extra = unknownFields(data, reflect.TypeOf(t).Elem())
+	return nil
+}
+
+func (t Tag) MarshalJSON() ([]byte, error) {
+	type plain Tag
+	return marshalWithExtra(plain(t), t.Extra)
+}
+
+func (o *Org) UnmarshalJSON(data []byte) error {
+	type plain Org
+	if err := json.Unmarshal(data, (*plain)(o)); err != nil {
+		return err
+	}
+	o.Extra = unknownFields(data, reflect.TypeOf(o).Elem())
+	return nil
+}
+
+func (o Org) MarshalJSON() ([]byte, error) {
+	type plain Org
+	return marshalWithExtra(plain(o), o.Extra)
+}
+
+func (g *Galaxy) UnmarshalJSON(data []byte) error {
+	type plain Galaxy
+	if err := json.Unmarshal(data, (*plain)(g)); err != nil {
+		return err
+	}
+	g.Extra = unknownFields(data, reflect.TypeOf(g).Elem())
+	return nil
+}
+
+func (g Galaxy) MarshalJSON() ([]byte, error) {
+	type plain Galaxy
+	return marshalWithExtra(plain(g), g.Extra)
+}
+
+func (g *GalaxyCluster) UnmarshalJSON(data []byte) error {
+	type plain GalaxyCluster
+	if err := json.Unmarshal(data, (*plain)(g)); err != nil {
+		return err
+	}
+	g.Extra = unknownFields(data, reflect.TypeOf(g).Elem())
+	return nil
+}
+
+func (g GalaxyCluster) MarshalJSON() ([]byte, error) {
+	type plain GalaxyCluster
+	return marshalWithExtra(plain(g), g.Extra)
+}
+
+func (s *Sighting) UnmarshalJSON(data []byte) error {
+	type plain Sighting
+	if err := json.Unmarshal(data, (*plain)(s)); err != nil {
+		return err
+	}
+	s.Extra = unknownFields(data, reflect.TypeOf(s).Elem())
+	return nil
+}
+
+func (s Sighting) MarshalJSON() ([]byte, error) {
+	type plain Sighting
+	return marshalWithExtra(plain(s), s.Extra)
+}
+
+func (e *EventReport) UnmarshalJSON(data []byte) error {
+	type plain EventReport
+	if err := json.Unmarshal(data, (*plain)(e)); err != nil {
+		return err
+	}
+	e.Extra = unknownFields(data, reflect.TypeOf(e).Elem())
+	return nil
+}
+
+func (e EventReport) MarshalJSON() ([]byte, error) {
+	type plain EventReport
+	return marshalWithExtra(plain(e), e.Extra)
+}
+
+func (o *ObjectReference) UnmarshalJSON(data []byte) error {
+	type plain ObjectReference
+	if err := json.Unmarshal(data, (*plain)(o)); err != nil {
+		return err
+	}
+	o.Extra = unknownFields(data, reflect.TypeOf(o).Elem())
+	return nil
+}
+
+func (o ObjectReference) MarshalJSON() ([]byte, error) {
+	type plain ObjectReference
+	return marshalWithExtra(plain(o), o.Extra)
+}
+
+// unknownFields returns the fields of the JSON object data which do not map
+// to a field of the struct type t or of its embedded structs. Like
+// encoding/json, field names are matched case-insensitively.
+func unknownFields(data []byte, t reflect.Type) map[string]json.RawMessage {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil
+	}
+
+	known := knownFields(t)
+	for name := range fields {
+		if known[strings.ToLower(name)] {
+			delete(fields, name)
+		}
+	}
+
+	if len(fields) == 0 {
+		return nil
+	}
+	return fields
+}
+
+// knownFieldsCache maps struct types to their lowercase JSON field names
+var knownFieldsCache sync.Map
+
+func knownFields(t reflect.Type) map[string]bool {
+	if known, ok := knownFieldsCache.Load(t); ok {
+		return known.(map[string]bool)
+	}
+	known := make(map[string]bool)
+	jsonFieldNames(t, known)
+	knownFieldsCache.Store(t, known)
+	return known
+}
+
+func jsonFieldNames(t reflect.Type, names map[string]bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := strings.Split(field.Tag.Get("json"), ",")[0]
+		switch {
+		case field.Anonymous && tag == "":
+			jsonFieldNames(field.Type, names)
+		case field.PkgPath != "" || tag == "-":
+		case tag != "":
+			names[strings.ToLower(tag)] = true
+		default:
+			names[strings.ToLower(field.Name)] = true
+		}
+	}
+}
+
+// marshalWithExtra encodes v, a struct, followed by the extra fields
+func marshalWithExtra(v interface{}, extra map[string]json.RawMessage) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(v); err != nil {
+		return nil, err
+	}
+	data := bytes.TrimSpace(buf.Bytes())
+	if len(extra) == 0 {
+		return data, nil
+	}
+
+	names := make([]string, 0, len(extra))
+	for name := range extra {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	result := append([]byte{}, data[:len(data)-1]...)
+	for i, name := range names {
+		if i > 0 || len(result) > 1 {
+			result = append(result, ',')
+		}
+		key, _ := json.Marshal(name)
+		result = append(append(append(result, key...), ':'), extra[name]...)
+	}
+	return append(result, '}'), nil
+}
+
+// LoadEventFile reads an event stored in the MISP JSON format, see ReadEvent
+func LoadEventFile(filename string) (*Event, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("Error opening %s: %s", filename, err)
+	}
+	defer f.Close()
+
+	return ReadEvent(f)
+}
+
+// ReadEvent decodes an event in the MISP core format, i.e. {"Event": {...}}.
+// Events without the envelope are accepted as well. Fields unknown to this
+// package are kept in the Extra fields of the event, its objects and its
+// attributes, so that WriteEvent writes them back. The event is not
+// validated, see ValidateEvent.
+func ReadEvent(r io.Reader) (*Event, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading event: %s", err)
+	}
+
+	var file eventFile
+	if err = json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("Could not unmarshal event: %s", err)
+	}
+
+	if file.Event == nil {
+		file.Event = &fileEvent{}
+		if err = json.Unmarshal(data, file.Event); err != nil {
+			return nil, fmt.Errorf("Could not unmarshal event: %s", err)
+		}
+	}
+
+	return file.Event.event(), nil
+}
+
+// SaveEventFile writes the event to filename in the MISP JSON format, see
+// WriteEvent
+func SaveEventFile(filename string, event *Event) error {
+	var buf bytes.Buffer
+	if err := WriteEvent(&buf, event); err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(filename, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("Error writing to %s: %s", filename, err)
+	}
+
+	return nil
+}
+
+// WriteEvent encodes the event in the MISP core format. The event is not
+// validated, see ValidateEvent.
+func WriteEvent(w io.Writer, event *Event) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "    ")
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(eventFile{Event: newFileEvent(event)}); err != nil {
+		return fmt.Errorf("Could not marshal event: %s", err)
+	}
+
+	return nil
+}
+
+var uuidRegexp = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// eventValidator collects the errors found while validating an event
+type eventValidator struct {
+	errors []string
+}
+
+func (v *eventValidator) errorf(path, format string, args ...interface{}) {
+	v.errors = append(v.errors, path+": "+fmt.Sprintf(format, args...))
+}
+
+func (v *eventValidator) uuid(path, value string) {
+	if !uuidRegexp.MatchString(value) {
+		v.errorf(path, "invalid uuid %q", value)
+	}
+}
+
+func (v *eventValidator) enum(path, field, value string, max int) {
+	if value == "" {
+		return
+	}
+	if n, err := strconv.Atoi(value); err != nil || n < 0 || n > max {
+		v.errorf(path, "invalid %s %q", field, value)
+	}
+}
+
+func (v *eventValidator) timestamp(path, field, value string) {
+	if value == "" {
+		return
+	}
+	if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+		v.errorf(path, "invalid %s %q", field, value)
+	}
+}
+
+func (v *eventValidator) tags(path string, tags []Tag) {
+	for i, tag := range tags {
+		if tag.Name == "" {
+			v.errorf(fmt.Sprintf("%s.Tag[%d]", path, i), "missing name")
+		}
+	}
+}
+
+func (v *eventValidator) attribute(path string, attr *Attribute, inObject bool) {
+	if attr.UUID != "" || !inObject {
+		v.uuid(path, attr.UUID)
+	}
+	if inObject && attr.ObjectRelation == "" {
+		v.errorf(path, "missing object_relation")
+	}
+	if err := DefaultDescribeTypes.ValidateAttribute(attr); err != nil {
+		v.errorf(path, "%s", err)
+	}
+	v.enum(path, "distribution", attr.Distribution, 5)
+	v.timestamp(path, "timestamp", attr.Timestamp)
+	v.tags(path, attr.Tags)
+}
+
+// ValidateEvent checks that the event complies with the MISP core format: the
+// mandatory fields are present, identifiers are valid UUIDs, enumerations and
+// timestamps are in range, and attributes have valid types, categories and
+// values according to DefaultDescribeTypes. All problems are reported at once.
+func ValidateEvent(event *Event) error {
+	v := &eventValidator{}
+
+	v.uuid("Event", event.UUID)
+	if strings.TrimSpace(event.Info) == "" {
+		v.errorf("Event", "missing info")
+	}
+	if _, err := time.Parse("2006-01-02", event.Date); err != nil {
+		v.errorf("Event", "invalid date %q", event.Date)
+	}
+	v.enum("Event", "threat_level_id", event.ThreatLevelID, 4)
+	v.enum("Event", "analysis", event.Analysis, 2)
+	v.enum("Event", "distribution", event.Distribution, 4)
+	v.timestamp("Event", "timestamp", event.Timestamp)
+	v.timestamp("Event", "publish_timestamp", event.PublishTimestamp)
+	v.tags("Event", event.Tags)
+
+	for i := range event.Attribute {
+		v.attribute(fmt.Sprintf("Event.Attribute[%d]", i), &event.Attribute[i], false)
+	}
+
+	for i, object := range event.Objects {
+		path := fmt.Sprintf("Event.Object[%d]", i)
+		v.uuid(path, object.UUID)
+		if object.Name == "" {
+			v.errorf(path, "missing name")
+		}
+		v.enum(path, "distribution", object.Distribution, 5)
+		for j := range object.Attributes {
+			v.attribute(fmt.Sprintf("%s.Attribute[%d]", path, j), &object.Attributes[j], true)
+		}
+		for j, ref := range object.References {
+			refPath := fmt.Sprintf("%s.ObjectReference[%d]", path, j)
+			if ref.ReferencedUUID == "" && ref.ReferencedID == "" {
+				v.errorf(refPath, "missing referenced_uuid")
+			} else if ref.ReferencedUUID != "" {
+				v.uuid(refPath, ref.ReferencedUUID)
+			}
+			if ref.RelationshipType == "" {
+				v.errorf(refPath, "missing relationship_type")
+			}
+		}
+	}
+
+	for i, galaxy := range event.Galaxies {
+		path := fmt.Sprintf("Event.Galaxy[%d]", i)
+		v.uuid(path, galaxy.UUID)
+		for j, cluster := range galaxy.Clusters {
+			if cluster.TagName == "" {
+				v.errorf(fmt.Sprintf("%s.GalaxyCluster[%d]", path, j), "missing tag_name")
+			}
+		}
+	}
+
+	for i, report := range event.EventReports {
+		path := fmt.Sprintf("Event.EventReport[%d]", i)
+		v.uuid(path, report.UUID)
+		if report.Name == "" {
+			v.errorf(path, "missing name")
+		}
+	}
+
+	if len(v.errors) > 0 {
+		return fmt.Errorf("Invalid event: %s", strings.Join(v.errors, "; "))
+	}
+
+	return nil
+}
@@ -0,0 +1,290 @@
+package misp
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testEventFile = `{
+    "Event": {
+        "id": "6871",
+        "orgc_id": "2",
+        "org_id": "1",
+        "uuid": "58b9864a-b6ec-4fa6-a5e6-4a9a0a3ac101",
+        "info": "Phishing campaign delivering invoice.exe",
+        "date": "2017-03-03",
+        "threat_level_id": "2",
+        "analysis": "1",
+        "distribution": "1",
+        "sharing_group_id": "0",
+        "published": true,
+        "timestamp": "1488557887",
+        "publish_timestamp": "1488557900",
+        "attribute_count": "2",
+        "locked": true,
+        "extends_uuid": "5a1b1d2e-0c54-4e2b-a1c7-1f2e3d4c5b6a",
+        "sighting_timestamp": "1488560000",
+        "Org": {"id": "1", "name": "CIRCL", "uuid": "55f6ea5e-2c60-40e5-964f-47a8950d210f", "local": true},
+        "Orgc": {"id": "2", "name": "Partner", "uuid": "5a1b1d2e-0c54-4e2b-a1c7-000000000002"},
+        "Attribute": [
+            {
+                "id": "610744",
+                "event_id": "6871",
+                "uuid": "58b98766-73cc-437f-a814-4a9a0a3ac101",
+                "category": "Payload delivery",
+                "type": "filename|md5",
+                "value": "invoice.exe|68b329da9893e34099c7d8ad5cb9c940",
+                "to_ids": true,
+                "disable_correlation": false,
+                "distribution": "5",
+                "timestamp": "1488553830",
+                "comment": "dropper",
+                "first_seen": "2017-03-01T10:00:00.000000+00:00",
+                "Tag": [{"id": "5", "name": "tlp:amber", "colour": "#FFC000", "exportable": true, "local": true, "numerical_value": null, "is_galaxy": false, "local_only": false}],
+                "Sighting": [{"uuid": "5a1b1d2e-0c54-4e2b-a1c7-000000000003", "attribute_uuid": "58b98766-73cc-437f-a814-4a9a0a3ac101", "org_id": "1", "date_sighting": "1488560000", "type": "0", "source": "sensor-1", "Organisation": {"name": "CIRCL", "local": true}, "event_id": "6871", "x_confidence": 90}],
+                "decay_score": [{"score": 87.5, "decayed": false}]
+            }
+        ],
+        "Object": [
+            {
+                "id": "12",
+                "name": "domain-ip",
+                "meta-category": "network",
+                "description": "A domain and its IP addresses",
+                "template_uuid": "43b3b146-77eb-4931-b4cc-b66c60f28734",
+                "template_version": "9",
+                "uuid": "5a1b1d2e-0c54-4e2b-a1c7-000000000004",
+                "timestamp": "1488557887",
+                "comment": "C2",
+                "sharing_group_id": "0",
+                "x_template_note": "kept as is",
+                "Attribute": [
+                    {"uuid": "5a1b1d2e-0c54-4e2b-a1c7-000000000005", "object_relation": "domain", "category": "Network activity", "type": "domain", "value": "evil.com", "to_ids": true, "disable_correlation": false},
+                    {"uuid": "5a1b1d2e-0c54-4e2b-a1c7-000000000006", "object_relation": "ip", "category": "Network activity", "type": "ip-dst", "value": "203.0.113.7", "to_ids": false, "disable_correlation": true}
+                ],
+                "ObjectReference": [
+                    {"uuid": "5a1b1d2e-0c54-4e2b-a1c7-000000000007", "object_uuid": "5a1b1d2e-0c54-4e2b-a1c7-000000000004", "referenced_uuid": "58b98766-73cc-437f-a814-4a9a0a3ac101", "relationship_type": "related-to", "source_uuid": "5a1b1d2e-0c54-4e2b-a1c7-000000000004"}
+                ]
+            }
+        ],
+        "Tag": [{"name": "tlp:green", "colour": "#33FF00", "exportable": true, "user_id": "0", "is_custom_galaxy": false}],
+        "Galaxy": [
+            {
+                "uuid": "59f20cce-5420-4084-afd5-0884c0a83832",
+                "name": "Threat Actor",
+                "type": "threat-actor",
+                "namespace": "misp",
+                "local_only": false,
+                "enabled": true,
+                "GalaxyCluster": [
+                    {"uuid": "7cdff317-a673-4474-84ec-4f1754947823", "type": "threat-actor", "value": "APT28", "tag_name": "misp-galaxy:threat-actor=\"APT28\"", "authors": ["MISP Project"], "meta": {"synonyms": ["Sofacy", "Fancy Bear"]}, "tag_id": "12", "collection_uuid": "0a1b2c3d-0000-4000-8000-000000000001", "local": false}
+                ]
+            }
+        ],
+        "EventReport": [
+            {"uuid": "5a1b1d2e-0c54-4e2b-a1c7-000000000008", "name": "Analysis", "content": "The dropper @[attribute](58b98766-73cc-437f-a814-4a9a0a3ac101) <b>beacons</b>.", "distribution": "5", "Event": {"id": "6871"}}
+        ]
+    }
+}`
+
+func Test_ReadWriteEvent(t *testing.T) {
+	event, err := ReadEvent(strings.NewReader(testEventFile))
+	if err != nil {
+		t.Fatalf("ReadEvent returned error: %s", err)
+	}
+
+	if err = ValidateEvent(event); err != nil {
+		t.Errorf("ValidateEvent returned error: %s", err)
+	}
+
+	attr := event.Objects[0].Attributes[1]
+	if attr.ToIDS || !attr.DisableCorrelation {
+		t.Errorf("Unexpected flags of %+v", attr)
+	}
+	sighting := event.Attribute[0].Sightings[0]
+	if sighting.OrgID != "1" || sighting.AttributeUUID != event.Attribute[0].UUID {
+		t.Errorf("Unexpected sighting %+v", sighting)
+	}
+
+	var buf bytes.Buffer
+	if err = WriteEvent(&buf, event); err != nil {
+		t.Fatalf("WriteEvent returned error: %s", err)
+	}
+
+	// Every field of the original file must survive the round trip
+	var want, got interface{}
+	json.Unmarshal([]byte(testEventFile), &want)
+	json.Unmarshal(buf.Bytes(), &got)
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("Round trip changed the event:\n%s", buf.String())
+	}
+}
+
+func Test_ReadEvent_FieldCase(t *testing.T) {
+	// encoding/json matches field names case-insensitively, so differently
+	// cased known fields must not be kept as unknown fields
+	event, err := ReadEvent(strings.NewReader(`{"Event": {"uuid": "58b9864a-b6ec-4fa6-a5e6-4a9a0a3ac101", "Info": "Case", "Tag": [{"Name": "tlp:white", "Numerical_Value": 1}]}}`))
+	if err != nil {
+		t.Fatalf("ReadEvent returned error: %s", err)
+	}
+	if event.Info != "Case" || event.Extra != nil {
+		t.Errorf("Unexpected info %q and extra fields %v", event.Info, event.Extra)
+	}
+	if len(event.Tags) != 1 || event.Tags[0].Name != "tlp:white" || len(event.Tags[0].Extra) != 1 {
+		t.Errorf("Unexpected tags %+v", event.Tags)
+	}
+
+	var buf bytes.Buffer
+	if err = WriteEvent(&buf, event); err != nil {
+		t.Fatalf("WriteEvent returned error: %s", err)
+	}
+	if strings.Count(strings.ToLower(buf.String()), `"info"`) != 1 {
+		t.Errorf("Info written more than once:\n%s", buf.String())
+	}
+}
+
+// testMISPEventOutput is an event as returned by /events/view on MISP 2.4
+const testMISPEventOutput = `{
+    "Event": {
+        "id": "1",
+        "orgc_id": "1",
+        "org_id": "1",
+        "date": "2023-01-10",
+        "threat_level_id": "1",
+        "info": "Test event",
+        "published": false,
+        "uuid": "c99506a6-1255-4b71-afa5-7b8ba48c3b1b",
+        "attribute_count": "1",
+        "analysis": "0",
+        "timestamp": "1673340000",
+        "distribution": "1",
+        "proposal_email_lock": false,
+        "locked": false,
+        "publish_timestamp": "0",
+        "sharing_group_id": "0",
+        "disable_correlation": false,
+        "extends_uuid": "",
+        "protected": null,
+        "event_creator_email": "admin@admin.test",
+        "Org": {"id": "1", "name": "ORGNAME", "uuid": "c5de83b4-36ba-49d6-9530-2a315caeece6", "local": true},
+        "Orgc": {"id": "1", "name": "ORGNAME", "uuid": "c5de83b4-36ba-49d6-9530-2a315caeece6", "local": true},
+        "Attribute": [
+            {
+                "id": "1",
+                "type": "ip-dst",
+                "category": "Network activity",
+                "to_ids": true,
+                "uuid": "5e2a8c4d-64a4-4b1a-9f0e-6a6f2a3b1c01",
+                "event_id": "1",
+                "distribution": "5",
+                "timestamp": "1673340000",
+                "comment": "",
+                "sharing_group_id": "0",
+                "deleted": false,
+                "disable_correlation": false,
+                "object_id": "0",
+                "object_relation": null,
+                "first_seen": null,
+                "last_seen": null,
+                "value": "203.0.113.7",
+                "Galaxy": [],
+                "ShadowAttribute": [],
+                "Tag": [
+                    {"id": "3", "name": "tlp:green", "colour": "#339900", "exportable": true, "user_id": "0", "hide_tag": false, "numerical_value": null, "is_galaxy": false, "is_custom_galaxy": false, "local_only": false, "local": 0}
+                ]
+            }
+        ],
+        "ShadowAttribute": [],
+        "RelatedEvent": [],
+        "Galaxy": [],
+        "Object": [],
+        "EventReport": [],
+        "CryptographicKey": [],
+        "Tag": [
+            {"id": "5", "name": "internal:triage", "colour": "#0088cc", "exportable": true, "user_id": "1", "hide_tag": false, "numerical_value": null, "is_galaxy": false, "is_custom_galaxy": false, "local_only": false, "local": 1}
+        ]
+    }
+}`
+
+func Test_ReadEvent_MISPOutput(t *testing.T) {
+	event, err := ReadEvent(strings.NewReader(testMISPEventOutput))
+	if err != nil {
+		t.Fatalf("ReadEvent returned error: %s", err)
+	}
+	if len(event.Tags) != 1 || !event.Tags[0].Local || event.Attribute[0].Tags[0].Local {
+		t.Errorf("Unexpected tags %+v and %+v", event.Tags, event.Attribute[0].Tags)
+	}
+
+	// As decoded by GetEventByID
+	var response struct {
+		Event Event `json:"Event"`
+	}
+	if err = json.Unmarshal([]byte(testMISPEventOutput), &response); err != nil {
+		t.Fatalf("Unmarshal returned error: %s", err)
+	}
+	if !response.Event.Tags[0].Local {
+		t.Errorf("Unexpected tags %+v", response.Event.Tags)
+	}
+
+	for _, data := range []string{`"1"`, `true`, `1`} {
+		var tag Tag
+		if err = json.Unmarshal([]byte(`{"name": "a", "local": `+data+`}`), &tag); err != nil || !tag.Local {
+			t.Errorf("Local %s decoded as %v, error %v", data, tag.Local, err)
+		}
+	}
+	var tag Tag
+	if err = json.Unmarshal([]byte(`{"name": "a", "local": "yes"}`), &tag); err == nil {
+		t.Errorf("Invalid local flag accepted")
+	}
+}
+
+func Test_WriteEventUnvalidated(t *testing.T) {
+	// Events from the server are written as is, even if ValidateEvent would
+	// reject them
+	event := &Event{
+		UUID: newUUID(),
+		Attribute: []Attribute{
+			{UUID: newUUID(), Type: "new-type", Category: CategoryOther, Value: "value"},
+			{UUID: newUUID(), Type: TypeIPDst, Category: CategoryNetworkActivity, Value: "203.0.113.7"},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := WriteEvent(&buf, event); err != nil {
+		t.Fatalf("WriteEvent returned error: %s", err)
+	}
+	if !strings.Contains(buf.String(), `"to_ids": false`) || strings.Contains(buf.String(), `"Org"`) {
+		t.Errorf("Unexpected event:\n%s", buf.String())
+	}
+}
+
+func Test_ValidateEvent(t *testing.T) {
+	event := &Event{
+		UUID:          "not-a-uuid",
+		Date:          "03/03/2017",
+		ThreatLevelID: "7",
+		Attribute: []Attribute{
+			{UUID: newUUID(), Type: TypeMD5, Category: CategoryPayloadDelivery, Value: "68b329da9893e34099c7d8ad5cb9c940"},
+			{UUID: newUUID(), Type: TypeIPDst, Category: CategoryFinancialFraud, Value: "203.0.113.7"},
+			{UUID: newUUID(), Type: TypeAS, Category: CategoryNetworkActivity, Value: "AS 1234"},
+		},
+	}
+
+	err := ValidateEvent(event)
+	if err == nil {
+		t.Fatalf("ValidateEvent accepted an invalid event")
+	}
+
+	for _, want := range []string{"invalid uuid", "missing info", "invalid date", "threat_level_id", "Event.Attribute[1]"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("ValidateEvent error %q does not mention %q", err, want)
+		}
+	}
+
+	if strings.Contains(err.Error(), "Event.Attribute[0]") || strings.Contains(err.Error(), "Event.Attribute[2]") {
+		t.Errorf("ValidateEvent reported a valid attribute: %s", err)
+	}
+}
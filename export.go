@@ -0,0 +1,119 @@
+package misp
+
+import (
+	"fmt"
+	"io"
+)
+
+// Formats supported by MISP's restSearch for events and attributes
+const (
+	ReturnFormatJSON     = "json"
+	ReturnFormatXML      = "xml"
+	ReturnFormatCSV      = "csv"
+	ReturnFormatText     = "text"
+	ReturnFormatSTIX     = "stix"
+	ReturnFormatSTIX2    = "stix2"
+	ReturnFormatSuricata = "suricata"
+	ReturnFormatSnort    = "snort"
+	ReturnFormatYara     = "yara"
+	ReturnFormatBro      = "bro"
+	ReturnFormatZeek     = "zeek"
+	ReturnFormatRPZ      = "rpz"
+	ReturnFormatOpenIOC  = "openioc"
+	ReturnFormatHashes   = "hashes"
+	ReturnFormatCache    = "cache"
+)
+
+// EventQuery holds the filters of an event restSearch
+type EventQuery struct {
+	// Search for the given value in the attributes' value field.
+	Value string `json:"value,omitempty"`
+
+	// Only return events with attributes of the given type or category.
+	Type     string `json:"type,omitempty"`
+	Category string `json:"category,omitempty"`
+
+	// Search by the creator organisation by supplying the organisation idenfitier.
+	Org string `json:"org,omitempty"`
+
+	// Tags to include, or to exclude when prepended with a '!'. See AttributeQuery.
+	Tags string `json:"tags,omitempty"`
+
+	// Events with their date between from and to (format: 2015-02-15).
+	From string `json:"from,omitempty"`
+	To   string `json:"to,omitempty"`
+
+	// Events published within the last x amount of time, e.g. 5d or 12h.
+	Last string `json:"last,omitempty"`
+
+	// Events modified after the given timestamp, or within the given
+	// amount of time.
+	Timestamp string `json:"timestamp,omitempty"`
+
+	// The events that should be included / excluded from the search
+	EventID string `json:"eventid,omitempty"`
+
+	// Search in the info field of the events
+	EventInfo string `json:"eventinfo,omitempty"`
+
+	// The event or attribute UUID to look for
+	UUID string `json:"uuid,omitempty"`
+
+	// Only return published ("1") or unpublished ("0") events
+	Published string `json:"published,omitempty"`
+
+	// Only export attributes with the IDS flag set ("1") or unset ("0")
+	ToIDS string `json:"to_ids,omitempty"`
+
+	// Include the attachments/encrypted samples in the export
+	WithAttachment string `json:"withAttachments,omitempty"`
+
+	// Only fetch the event metadata (event data, tags, relations) and skip the attributes
+	MetaData string `json:"metadata,omitempty"`
+
+	// Paginate the results, limit being the number of events per page
+	Limit string `json:"limit,omitempty"`
+	Page  string `json:"page,omitempty"`
+}
+
+// ExportEvents runs an event restSearch and writes the result, in the given
+// returnFormat, to w as it is received
+func (client *Client) ExportEvents(format string, q *EventQuery, w io.Writer) error {
+	if q == nil {
+		q = &EventQuery{}
+	}
+
+	return client.export("/events/restSearch", struct {
+		*EventQuery
+		ReturnFormat string `json:"returnFormat"`
+	}{q, format}, w)
+}
+
+// ExportAttributes runs an attribute restSearch and writes the result, in the
+// given returnFormat, to w as it is received
+func (client *Client) ExportAttributes(format string, q *AttributeQuery, w io.Writer) error {
+	if q == nil {
+		q = &AttributeQuery{}
+	}
+
+	return client.export("/attributes/restSearch", struct {
+		*AttributeQuery
+		ReturnFormat string `json:"returnFormat"`
+	}{q, format}, w)
+}
+
+func (client *Client) export(path string, req interface{}, w io.Writer) error {
+	resp, err := client.Post(path, req)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	if err != nil {
+		return err
+	}
+
+	if _, err = io.Copy(w, resp.Body); err != nil {
+		return fmt.Errorf("Error writing export: %s", err)
+	}
+
+	return nil
+}
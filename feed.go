@@ -0,0 +1,373 @@
+package misp
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// FeedManifestEntry is the summary of an event in the manifest.json of a feed
+type FeedManifestEntry struct {
+	Orgc          Org         `json:"Orgc"`
+	Tags          []Tag       `json:"Tag"`
+	Info          string      `json:"info"`
+	Date          string      `json:"date"`
+	Analysis      json.Number `json:"analysis"`
+	ThreatLevelID json.Number `json:"threat_level_id"`
+	Timestamp     json.Number `json:"timestamp"`
+}
+
+// FeedManifest maps event UUIDs to their summary
+type FeedManifest map[string]FeedManifestEntry
+
+// FeedGenerator writes events to a directory in the MISP feed format: a
+// manifest.json listing the events, a hashes.csv holding the MD5 of every
+// attribute value, and one <uuid>.json file per event.
+//
+// Generation is incremental: events already in the feed with the same
+// timestamp are not rewritten, and events published earlier are kept.
+type FeedGenerator struct {
+	Dir string
+
+	// Only events with one of these distribution levels are published, and
+	// attributes and objects with another level than these or "5" (inherit)
+	// are removed. Empty means no restriction.
+	Distributions []string
+
+	// Only events with at least one of these tags are published. Empty means
+	// no restriction.
+	IncludeTags []string
+
+	// Events with any of these tags are not published, and attributes with
+	// any of them are removed
+	ExcludeTags []string
+}
+
+// Generate adds the given events to the feed and returns the number of event
+// files written. Events are written as they are, see ValidateEvent to check
+// them beforehand. Events which cannot be written are skipped and the first
+// error is returned, manifest.json and hashes.csv being updated with the
+// events written.
+func (g *FeedGenerator) Generate(events []Event) (int, error) {
+	if err := os.MkdirAll(g.Dir, 0755); err != nil {
+		return 0, fmt.Errorf("Error creating %s: %s", g.Dir, err)
+	}
+
+	manifest, err := readManifestFile(filepath.Join(g.Dir, "manifest.json"))
+	if err != nil {
+		return 0, err
+	}
+	hashes, err := g.readHashes()
+	if err != nil {
+		return 0, err
+	}
+
+	written := 0
+	var writeErr error
+	for i := range events {
+		if !g.accept(&events[i]) {
+			continue
+		}
+
+		event := g.feedEvent(&events[i])
+		if entry, ok := manifest[event.UUID]; ok && entry.Timestamp.String() == event.Timestamp {
+			continue
+		}
+
+		// The UUID names the event file
+		if !uuidRegexp.MatchString(event.UUID) {
+			if writeErr == nil {
+				writeErr = fmt.Errorf("Event %q: invalid UUID", event.UUID)
+			}
+			continue
+		}
+
+		var buf bytes.Buffer
+		if err = WriteEvent(&buf, event); err != nil {
+			if writeErr == nil {
+				writeErr = fmt.Errorf("Event %s: %s", event.UUID, err)
+			}
+			continue
+		}
+		if err = writeFileAtomic(filepath.Join(g.Dir, event.UUID+".json"), buf.Bytes()); err != nil {
+			if writeErr == nil {
+				writeErr = err
+			}
+			continue
+		}
+
+		manifest[event.UUID] = feedManifestEntry(event)
+		hashes[event.UUID] = feedHashes(event)
+		written++
+	}
+
+	if err = g.writeHashes(hashes); err != nil {
+		return written, err
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "    ")
+	if err != nil {
+		return written, fmt.Errorf("Could not marshal manifest: %s", err)
+	}
+	if err = writeFileAtomic(filepath.Join(g.Dir, "manifest.json"), data); err != nil {
+		return written, err
+	}
+
+	return written, writeErr
+}
+
+func (g *FeedGenerator) accept(event *Event) bool {
+	if len(g.Distributions) > 0 && !containsString(g.Distributions, event.Distribution) {
+		return false
+	}
+	if hasAnyTag(event.Tags, g.ExcludeTags) {
+		return false
+	}
+	if len(g.IncludeTags) > 0 && !hasAnyTag(event.Tags, g.IncludeTags) {
+		return false
+	}
+	return true
+}
+
+func (g *FeedGenerator) acceptDistribution(distribution string) bool {
+	return len(g.Distributions) == 0 || distribution == "" || distribution == "5" ||
+		containsString(g.Distributions, distribution)
+}
+
+// feedEvent returns a copy of the event filtered according to the generator
+// settings, without the identifiers local to this instance and without local
+// tags
+func (g *FeedGenerator) feedEvent(event *Event) *Event {
+	result := *event
+	result.ID, result.OrgID, result.OrgcID, result.SharingGroupID = "", "", "", ""
+	result.Org = Org{}
+	result.Orgc.ID = ""
+	result.Tags = feedTags(event.Tags)
+	result.ShadowAttributes = nil
+	result.RelatedEvents = nil
+
+	result.Attribute = g.feedAttributes(event.Attribute)
+
+	result.Objects = nil
+	for _, object := range event.Objects {
+		if !g.acceptDistribution(object.Distribution) {
+			continue
+		}
+		object.ID, object.EventID, object.SharingGroupID = "", "", ""
+		object.Attributes = g.feedAttributes(object.Attributes)
+
+		references := make([]ObjectReference, len(object.References))
+		for i, ref := range object.References {
+			ref.ID, ref.ObjectID, ref.ReferencedID = "", "", ""
+			references[i] = ref
+		}
+		object.References = references
+
+		result.Objects = append(result.Objects, object)
+	}
+
+	result.EventReports = nil
+	for _, report := range event.EventReports {
+		if !g.acceptDistribution(report.Distribution) {
+			continue
+		}
+		report.ID, report.EventID, report.SharingGroupID = "", "", ""
+		result.EventReports = append(result.EventReports, report)
+	}
+
+	return &result
+}
+
+func (g *FeedGenerator) feedAttributes(attrs []Attribute) []Attribute {
+	var result []Attribute
+	for _, attr := range attrs {
+		if !g.acceptDistribution(attr.Distribution) || hasAnyTag(attr.Tags, g.ExcludeTags) {
+			continue
+		}
+		attr.ID, attr.EventID, attr.ObjectID, attr.SharingGroupID = "", "", "", ""
+		attr.Tags = feedTags(attr.Tags)
+		attr.Sightings = nil
+		result = append(result, attr)
+	}
+	return result
+}
+
+func feedTags(tags []Tag) []Tag {
+	var result []Tag
+	for _, tag := range tags {
+		if tag.Local {
+			continue
+		}
+		tag.ID = ""
+		result = append(result, tag)
+	}
+	return result
+}
+
+func feedManifestEntry(event *Event) FeedManifestEntry {
+	tags := make([]Tag, len(event.Tags))
+	for i, tag := range event.Tags {
+		tags[i] = Tag{Name: tag.Name, Colour: tag.Colour}
+	}
+
+	return FeedManifestEntry{
+		Orgc:          Org{Name: event.Orgc.Name, UUID: event.Orgc.UUID},
+		Tags:          tags,
+		Info:          event.Info,
+		Date:          event.Date,
+		Analysis:      json.Number(defaultString(event.Analysis, "0")),
+		ThreatLevelID: json.Number(defaultString(event.ThreatLevelID, "4")),
+		Timestamp:     json.Number(defaultString(event.Timestamp, "0")),
+	}
+}
+
+// feedHashes returns the MD5 of the values of the event attributes, composite
+// values being hashed part by part
+func feedHashes(event *Event) []string {
+	var hashes []string
+	add := func(attr *Attribute) {
+		values := []string{attr.Value}
+		if parts, err := attr.Composite(); err == nil {
+			values = parts
+		}
+		for _, value := range values {
+			sum := md5.Sum([]byte(value))
+			hashes = append(hashes, hex.EncodeToString(sum[:]))
+		}
+	}
+
+	for i := range event.Attribute {
+		add(&event.Attribute[i])
+	}
+	for _, object := range event.Objects {
+		for i := range object.Attributes {
+			add(&object.Attributes[i])
+		}
+	}
+
+	return hashes
+}
+
+// readHashes loads hashes.csv, indexed by event UUID
+func (g *FeedGenerator) readHashes() (map[string][]string, error) {
+	hashes := make(map[string][]string)
+
+	data, err := ioutil.ReadFile(filepath.Join(g.Dir, "hashes.csv"))
+	if os.IsNotExist(err) {
+		return hashes, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Error reading hashes.csv: %s", err)
+	}
+
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = 2
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("Could not parse hashes.csv: %s", err)
+	}
+	for _, record := range records {
+		hashes[record[1]] = append(hashes[record[1]], record[0])
+	}
+
+	return hashes, nil
+}
+
+func (g *FeedGenerator) writeHashes(hashes map[string][]string) error {
+	uuids := make([]string, 0, len(hashes))
+	for uuid := range hashes {
+		uuids = append(uuids, uuid)
+	}
+	sort.Strings(uuids)
+
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	for _, uuid := range uuids {
+		for _, hash := range hashes[uuid] {
+			writer.Write([]string{hash, uuid})
+		}
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("Could not write hashes.csv: %s", err)
+	}
+
+	return writeFileAtomic(filepath.Join(g.Dir, "hashes.csv"), buf.Bytes())
+}
+
+func readManifestFile(filename string) (FeedManifest, error) {
+	manifest := make(FeedManifest)
+
+	data, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return manifest, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Error reading %s: %s", filename, err)
+	}
+
+	if err = json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("Could not unmarshal %s: %s", filename, err)
+	}
+
+	return manifest, nil
+}
+
+// writeFileAtomic writes data to a temporary file renamed to filename, so
+// that readers never see a partially written file
+func writeFileAtomic(filename string, data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(filename), "."+filepath.Base(filename))
+	if err != nil {
+		return fmt.Errorf("Error creating temporary file: %s", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("Error writing to %s: %s", tmp.Name(), err)
+	}
+	if err = tmp.Close(); err != nil {
+		return fmt.Errorf("Error writing to %s: %s", tmp.Name(), err)
+	}
+	if err = os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+
+	if err = os.Rename(tmp.Name(), filename); err != nil {
+		return fmt.Errorf("Error writing to %s: %s", filename, err)
+	}
+
+	return nil
+}
+
+func hasAnyTag(tags []Tag, names []string) bool {
+	for _, tag := range tags {
+		if containsString(names, tag.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func defaultString(value, def string) string {
+	if value == "" {
+		return def
+	}
+	return value
+}
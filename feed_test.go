@@ -0,0 +1,145 @@
+package misp
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testFeedEvents() []Event {
+	return []Event{
+		{
+			ID: "1", UUID: "5a1b1d2e-0c54-4e2b-a1c7-000000000001", Info: "Shared", Date: "2017-03-03",
+			Distribution: "3", Timestamp: "1488557887",
+			Orgc: Org{ID: "2", Name: "CIRCL", UUID: "55f6ea5e-2c60-40e5-964f-47a8950d210f"},
+			Tags: []Tag{{Name: "tlp:green"}, {Name: "internal:triage", Local: true}},
+			Attribute: []Attribute{
+				{ID: "10", UUID: newUUID(), Type: TypeDomainIP, Category: CategoryNetworkActivity, Value: "evil.com|203.0.113.7"},
+				{ID: "11", UUID: newUUID(), Type: TypeMD5, Category: CategoryPayloadDelivery, Value: "68b329da9893e34099c7d8ad5cb9c940", Distribution: "0"},
+			},
+		},
+		{
+			UUID: "5a1b1d2e-0c54-4e2b-a1c7-000000000002", Info: "Not shared", Date: "2017-03-03",
+			Distribution: "0", Timestamp: "1488557887",
+		},
+		{
+			UUID: "5a1b1d2e-0c54-4e2b-a1c7-000000000003", Info: "Red", Date: "2017-03-03",
+			Distribution: "3", Timestamp: "1488557887", Tags: []Tag{{Name: "tlp:red"}},
+		},
+	}
+}
+
+func Test_FeedGenerator(t *testing.T) {
+	dir, err := ioutil.TempDir("", "feed")
+	if err != nil {
+		t.Fatalf("TempDir returned error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	g := &FeedGenerator{Dir: dir, Distributions: []string{"1", "2", "3"}, ExcludeTags: []string{"tlp:red"}}
+
+	events := testFeedEvents()
+	written, err := g.Generate(events)
+	if err != nil {
+		t.Fatalf("Generate returned error: %s", err)
+	}
+	if written != 1 {
+		t.Errorf("Generate wrote %d events, want 1", written)
+	}
+
+	manifest, err := readManifestFile(filepath.Join(dir, "manifest.json"))
+	if err != nil {
+		t.Fatalf("Cannot read manifest: %s", err)
+	}
+	entry, ok := manifest[events[0].UUID]
+	if len(manifest) != 1 || !ok || entry.Timestamp.String() != "1488557887" || len(entry.Tags) != 1 {
+		t.Errorf("Unexpected manifest: %+v", manifest)
+	}
+
+	hashes, err := ioutil.ReadFile(filepath.Join(dir, "hashes.csv"))
+	if err != nil {
+		t.Fatalf("Cannot read hashes.csv: %s", err)
+	}
+	// md5("evil.com") and md5("203.0.113.7"), the md5 attribute has distribution 0
+	if lines := strings.Split(strings.TrimSpace(string(hashes)), "\n"); len(lines) != 2 {
+		t.Errorf("Unexpected hashes.csv:\n%s", hashes)
+	}
+
+	event, err := LoadEventFile(filepath.Join(dir, events[0].UUID+".json"))
+	if err != nil {
+		t.Fatalf("LoadEventFile returned error: %s", err)
+	}
+	if event.ID != "" || len(event.Attribute) != 1 || event.Attribute[0].ID != "" || len(event.Tags) != 1 {
+		t.Errorf("Event was not filtered: %+v", event)
+	}
+	if events[0].ID != "1" || len(events[0].Attribute) != 2 {
+		t.Errorf("Generate modified its input")
+	}
+
+	// Unchanged events are not rewritten, updated ones are
+	if written, _ = g.Generate(events); written != 0 {
+		t.Errorf("Generate rewrote %d unchanged events", written)
+	}
+	events[0].Timestamp = "1488560000"
+	events[0].Attribute = events[0].Attribute[:1]
+	events[0].Attribute[0].Value = "evil.com|203.0.113.8"
+	if written, _ = g.Generate(events); written != 1 {
+		t.Errorf("Generate wrote %d events, want 1", written)
+	}
+
+	hashes, _ = ioutil.ReadFile(filepath.Join(dir, "hashes.csv"))
+	if lines := strings.Split(strings.TrimSpace(string(hashes)), "\n"); len(lines) != 2 {
+		t.Errorf("Hashes of the previous version were kept:\n%s", hashes)
+	}
+}
+
+func Test_FeedGenerator_Error(t *testing.T) {
+	dir, err := ioutil.TempDir("", "feed")
+	if err != nil {
+		t.Fatalf("TempDir returned error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// A non-empty directory in place of the first event file
+	events := testFeedEvents()
+	blocked := filepath.Join(dir, events[0].UUID+".json")
+	if err = os.MkdirAll(filepath.Join(blocked, "x"), 0755); err != nil {
+		t.Fatalf("MkdirAll returned error: %s", err)
+	}
+
+	g := &FeedGenerator{Dir: dir, ExcludeTags: []string{"tlp:red"}}
+	written, err := g.Generate(events)
+	if err == nil {
+		t.Errorf("Generate did not return an error")
+	}
+	if written != 1 {
+		t.Errorf("Generate wrote %d events, want 1", written)
+	}
+
+	manifest, err := readManifestFile(filepath.Join(dir, "manifest.json"))
+	if err != nil {
+		t.Fatalf("Cannot read manifest: %s", err)
+	}
+	if _, ok := manifest[events[1].UUID]; len(manifest) != 1 || !ok {
+		t.Errorf("Unexpected manifest: %+v", manifest)
+	}
+	if _, err = os.Stat(filepath.Join(dir, "hashes.csv")); err != nil {
+		t.Errorf("hashes.csv was not written: %s", err)
+	}
+
+	// Events whose UUID is not a UUID would be written outside of the feed
+	for _, uuid := range []string{"", "../../5a1b1d2e-0c54-4e2b-a1c7-000000000009", "a/b"} {
+		event := Event{UUID: uuid, Info: "Bad", Date: "2017-03-03", Timestamp: "1488557887"}
+		if written, err = g.Generate([]Event{event}); err == nil || written != 0 {
+			t.Errorf("Generate wrote event %q", uuid)
+		}
+	}
+	files, _ := ioutil.ReadDir(dir)
+	for _, file := range files {
+		if name := file.Name(); name != "manifest.json" && name != "hashes.csv" && !uuidRegexp.MatchString(strings.TrimSuffix(name, ".json")) {
+			t.Errorf("Unexpected file %s", name)
+		}
+	}
+}
@@ -0,0 +1,332 @@
+package misp
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Feed formats, as named in MISP's feed settings
+const (
+	FeedFormatMISP     = "misp"
+	FeedFormatFreetext = "freetext"
+	FeedFormatCSV      = "csv"
+)
+
+// feedContentKey is the state entry holding the hash of freetext and CSV feeds
+const feedContentKey = "content"
+
+// FeedReader consumes a feed from an HTTP(S) URL or a local directory or file,
+// remembering between runs what it has already read
+type FeedReader struct {
+	// Base URL or directory of MISP feeds, URL or file of freetext and CSV feeds
+	URL string
+
+	// One of FeedFormatMISP (default), FeedFormatFreetext or FeedFormatCSV
+	Format string
+
+	// File in which the state of the feed is persisted between runs. When
+	// empty, every run reads the whole feed.
+	StateFile string
+
+	// HTTP client and headers used for remote feeds. A nil Client means
+	// http.DefaultClient.
+	Client  *http.Client
+	Headers map[string]string
+
+	// CSV feeds only: the 1-based columns holding values, by default the
+	// first one, and the field delimiter, by default a comma. Lines starting
+	// with a '#' are ignored.
+	CSVValueColumns []int
+	CSVDelimiter    rune
+}
+
+// Manifest fetches the manifest.json of a MISP feed
+func (r *FeedReader) Manifest() (FeedManifest, error) {
+	data, err := r.fetch("manifest.json")
+	if err != nil {
+		return nil, err
+	}
+
+	var manifest FeedManifest
+	if err = json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("Could not unmarshal manifest: %s", err)
+	}
+
+	return manifest, nil
+}
+
+// Changed returns the UUIDs of the events of the manifest that are new or
+// whose timestamp changed since the last run, oldest first. Manifest keys
+// which are not UUIDs are ignored, as they do not name event files.
+func (r *FeedReader) Changed(manifest FeedManifest) ([]string, error) {
+	state, err := r.loadState()
+	if err != nil {
+		return nil, err
+	}
+
+	var uuids []string
+	for uuid, entry := range manifest {
+		if !uuidRegexp.MatchString(uuid) {
+			continue
+		}
+		if state[uuid] != entry.Timestamp.String() {
+			uuids = append(uuids, uuid)
+		}
+	}
+
+	sort.Slice(uuids, func(i, j int) bool {
+		ti, _ := manifest[uuids[i]].Timestamp.Int64()
+		tj, _ := manifest[uuids[j]].Timestamp.Int64()
+		if ti != tj {
+			return ti < tj
+		}
+		return uuids[i] < uuids[j]
+	})
+
+	return uuids, nil
+}
+
+// GetEvent fetches an event of a MISP feed
+func (r *FeedReader) GetEvent(uuid string) (*Event, error) {
+	if !uuidRegexp.MatchString(uuid) {
+		return nil, fmt.Errorf("Invalid event UUID %q", uuid)
+	}
+
+	data, err := r.fetch(uuid + ".json")
+	if err != nil {
+		return nil, err
+	}
+
+	return ReadEvent(bytes.NewReader(data))
+}
+
+// Update reads what changed in the feed since the last run and calls fn with
+// each new or updated event. Freetext and CSV feeds yield a single event
+// holding the indicators of the feed, and only when its content changed.
+//
+// The state is saved after the events successfully handled by fn, so that a
+// failing run resumes where it stopped.
+func (r *FeedReader) Update(fn func(event *Event) error) error {
+	state, err := r.loadState()
+	if err != nil {
+		return err
+	}
+
+	switch r.Format {
+	case "", FeedFormatMISP:
+		err = r.updateMISP(state, fn)
+	case FeedFormatFreetext, FeedFormatCSV:
+		err = r.updateIndicators(state, fn)
+	default:
+		return fmt.Errorf("Unknown feed format %q", r.Format)
+	}
+
+	if saveErr := r.saveState(state); saveErr != nil && err == nil {
+		err = saveErr
+	}
+
+	return err
+}
+
+func (r *FeedReader) updateMISP(state map[string]string, fn func(event *Event) error) error {
+	manifest, err := r.Manifest()
+	if err != nil {
+		return err
+	}
+
+	uuids, err := r.Changed(manifest)
+	if err != nil {
+		return err
+	}
+
+	for _, uuid := range uuids {
+		event, err := r.GetEvent(uuid)
+		if err != nil {
+			return fmt.Errorf("Event %s: %s", uuid, err)
+		}
+		if err = fn(event); err != nil {
+			return err
+		}
+		state[uuid] = manifest[uuid].Timestamp.String()
+	}
+
+	return nil
+}
+
+func (r *FeedReader) updateIndicators(state map[string]string, fn func(event *Event) error) error {
+	data, err := r.fetch("")
+	if err != nil {
+		return err
+	}
+
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+	if state[feedContentKey] == hash {
+		return nil
+	}
+
+	var attrs []Attribute
+	if r.Format == FeedFormatCSV {
+		attrs, err = r.parseCSV(data)
+		if err != nil {
+			return err
+		}
+	} else {
+		attrs = ExtractIndicators(string(data))
+	}
+
+	event := &Event{
+		UUID:      newUUID(),
+		Info:      r.URL,
+		Attribute: attrs,
+	}
+	if err = fn(event); err != nil {
+		return err
+	}
+	state[feedContentKey] = hash
+
+	return nil
+}
+
+// parseCSV extracts the indicators found in the value columns of a CSV feed
+func (r *FeedReader) parseCSV(data []byte) ([]Attribute, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	if r.CSVDelimiter != 0 {
+		reader.Comma = r.CSVDelimiter
+	}
+
+	columns := r.CSVValueColumns
+	if len(columns) == 0 {
+		columns = []int{1}
+	}
+
+	var attrs []Attribute
+	seen := make(map[string]bool)
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Could not parse CSV feed: %s", err)
+		}
+
+		for _, column := range columns {
+			if column < 1 || column > len(record) {
+				continue
+			}
+			for _, attr := range ExtractIndicators(record[column-1]) {
+				if key := attr.Type + "|" + attr.Value; !seen[key] {
+					seen[key] = true
+					attrs = append(attrs, attr)
+				}
+			}
+		}
+	}
+
+	return attrs, nil
+}
+
+// isRemote tells whether the feed is fetched over HTTP
+func (r *FeedReader) isRemote() bool {
+	return strings.HasPrefix(r.URL, "http://") || strings.HasPrefix(r.URL, "https://")
+}
+
+// fetch returns the content of the given file of the feed, or of the feed
+// itself if name is empty
+func (r *FeedReader) fetch(name string) ([]byte, error) {
+	if !r.isRemote() {
+		filename := r.URL
+		if name != "" {
+			filename = filepath.Join(r.URL, name)
+		}
+		data, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return nil, fmt.Errorf("Error reading %s: %s", filename, err)
+		}
+		return data, nil
+	}
+
+	url := r.URL
+	if name != "" {
+		url = strings.TrimSuffix(r.URL, "/") + "/" + name
+	}
+
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range r.Headers {
+		req.Header.Set(key, value)
+	}
+
+	httpClient := r.Client
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("Error fetching %s: %s", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Feed server replied status=%d for %s", resp.StatusCode, url)
+	}
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("Error fetching %s: %s", url, err)
+	}
+
+	return data, nil
+}
+
+func (r *FeedReader) loadState() (map[string]string, error) {
+	state := make(map[string]string)
+	if r.StateFile == "" {
+		return state, nil
+	}
+
+	data, err := ioutil.ReadFile(r.StateFile)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Error reading %s: %s", r.StateFile, err)
+	}
+
+	if err = json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("Could not unmarshal %s: %s", r.StateFile, err)
+	}
+
+	return state, nil
+}
+
+func (r *FeedReader) saveState(state map[string]string) error {
+	if r.StateFile == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(state, "", "    ")
+	if err != nil {
+		return fmt.Errorf("Could not marshal feed state: %s", err)
+	}
+
+	return writeFileAtomic(r.StateFile, data)
+}
@@ -0,0 +1,188 @@
+package misp
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_FeedReader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "feed")
+	if err != nil {
+		t.Fatalf("TempDir returned error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	events := testFeedEvents()
+	g := &FeedGenerator{Dir: filepath.Join(dir, "feed")}
+	if _, err = g.Generate(events); err != nil {
+		t.Fatalf("Generate returned error: %s", err)
+	}
+
+	server := httptest.NewServer(http.FileServer(http.Dir(g.Dir)))
+	defer server.Close()
+
+	for _, url := range []string{g.Dir, server.URL} {
+		r := &FeedReader{URL: url, StateFile: filepath.Join(dir, "state.json")}
+		os.Remove(r.StateFile)
+
+		var read []string
+		collect := func(event *Event) error {
+			read = append(read, event.UUID)
+			return nil
+		}
+
+		if err = r.Update(collect); err != nil {
+			t.Fatalf("Update(%s) returned error: %s", url, err)
+		}
+		if len(read) != len(events) {
+			t.Errorf("Update(%s) read %d events, want %d", url, len(read), len(events))
+		}
+
+		read = nil
+		if err = r.Update(collect); err != nil || len(read) != 0 {
+			t.Errorf("Update(%s) read %d unchanged events, error %v", url, len(read), err)
+		}
+	}
+
+	// Only the updated event is read again
+	r := &FeedReader{URL: g.Dir, StateFile: filepath.Join(dir, "state.json")}
+	events[1].Timestamp = "1488560000"
+	g.Generate(events)
+
+	var read []string
+	r.Update(func(event *Event) error {
+		read = append(read, event.UUID)
+		return nil
+	})
+	if len(read) != 1 || read[0] != events[1].UUID {
+		t.Errorf("Update read %v, want [%s]", read, events[1].UUID)
+	}
+}
+
+func Test_FeedReader_CSV(t *testing.T) {
+	dir, err := ioutil.TempDir("", "feed")
+	if err != nil {
+		t.Fatalf("TempDir returned error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "feed.csv")
+	ioutil.WriteFile(filename, []byte("# first_seen;dst_ip;url\n2017-03-03;203.0.113.7;hxxp://evil[.]com/gate.php\n2017-03-04;203.0.113.7;http://evil.com/x\n"), 0644)
+
+	r := &FeedReader{
+		URL:             filename,
+		Format:          FeedFormatCSV,
+		StateFile:       filepath.Join(dir, "state.json"),
+		CSVValueColumns: []int{2, 3},
+		CSVDelimiter:    ';',
+	}
+
+	var attrs []Attribute
+	collect := func(event *Event) error {
+		attrs = append(attrs, event.Attribute...)
+		return nil
+	}
+
+	if err = r.Update(collect); err != nil {
+		t.Fatalf("Update returned error: %s", err)
+	}
+	if len(attrs) != 3 || attrs[0].Value != "203.0.113.7" || attrs[1].Value != "http://evil.com/gate.php" {
+		t.Errorf("Update returned %+v", attrs)
+	}
+
+	attrs = nil
+	if err = r.Update(collect); err != nil || attrs != nil {
+		t.Errorf("Update read an unchanged feed: %+v, %v", attrs, err)
+	}
+}
+
+func Test_FeedReader_Freetext(t *testing.T) {
+	dir, err := ioutil.TempDir("", "feed")
+	if err != nil {
+		t.Fatalf("TempDir returned error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	content := "# Blocklist\nevil[.]com\n203.0.113.7\n"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "key" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Write([]byte(content))
+	}))
+	defer server.Close()
+
+	r := &FeedReader{
+		URL:       server.URL + "/list.txt",
+		Format:    FeedFormatFreetext,
+		StateFile: filepath.Join(dir, "state.json"),
+		Headers:   map[string]string{"Authorization": "key"},
+	}
+
+	var events []*Event
+	collect := func(event *Event) error {
+		events = append(events, event)
+		return nil
+	}
+
+	if err = r.Update(collect); err != nil {
+		t.Fatalf("Update returned error: %s", err)
+	}
+	if len(events) != 1 || events[0].Info != r.URL || len(events[0].Attribute) != 2 ||
+		events[0].Attribute[0].Value != "evil.com" || events[0].Attribute[1].Value != "203.0.113.7" {
+		t.Errorf("Update returned %+v", events)
+	}
+
+	// The feed is only read again when its content changes
+	events = nil
+	if err = r.Update(collect); err != nil || events != nil {
+		t.Errorf("Update read an unchanged feed: %+v, %v", events, err)
+	}
+	content += "198.51.100.1\n"
+	if err = r.Update(collect); err != nil || len(events) != 1 || len(events[0].Attribute) != 3 {
+		t.Errorf("Update did not read the changed feed: %+v, %v", events, err)
+	}
+
+	r.Headers = nil
+	if err = r.Update(collect); err == nil || !strings.Contains(err.Error(), "status=403") {
+		t.Errorf("Update returned %v for a forbidden feed", err)
+	}
+}
+
+func Test_FeedReader_InvalidUUID(t *testing.T) {
+	dir, err := ioutil.TempDir("", "feed")
+	if err != nil {
+		t.Fatalf("TempDir returned error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// A hostile manifest pointing outside of the feed
+	feed := filepath.Join(dir, "feed")
+	os.MkdirAll(feed, 0755)
+	ioutil.WriteFile(filepath.Join(dir, "secret.json"), []byte(`{"Event": {"uuid": "x", "info": "secret"}}`), 0644)
+	manifest, _ := json.Marshal(map[string]interface{}{
+		"../secret": map[string]interface{}{"timestamp": 1488557887},
+		"":          map[string]interface{}{"timestamp": 1488557887},
+	})
+	ioutil.WriteFile(filepath.Join(feed, "manifest.json"), manifest, 0644)
+
+	r := &FeedReader{URL: feed}
+	err = r.Update(func(event *Event) error {
+		t.Errorf("Update read %+v", event)
+		return nil
+	})
+	if err != nil {
+		t.Errorf("Update returned error: %s", err)
+	}
+
+	if _, err = r.GetEvent("../secret"); err == nil || !strings.Contains(err.Error(), "Invalid event UUID") {
+		t.Errorf("GetEvent returned %v", err)
+	}
+}
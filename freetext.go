@@ -0,0 +1,270 @@
+package misp
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	htmlRegexp      = regexp.MustCompile(`(?i)<(html|body|p|div|br|a|span|table|td|li|pre)\b`)
+	htmlTagRegexp   = regexp.MustCompile(`(?s)<[^>]*>`)
+	htmlDropRegexp  = regexp.MustCompile(`(?is)<(script|style)\b.*?</(script|style)>`)
+	htmlBlockRegexp = regexp.MustCompile(`(?i)<(br|/p|/div|/li|/tr|/td|/pre)\b[^>]*>`)
+)
+
+// indicatorPattern associates a regular expression with the attribute type of
+// its matches. The first capture group, if any, holds the value.
+type indicatorPattern struct {
+	attrType string
+	regexp   *regexp.Regexp
+}
+
+// indicatorPatterns are applied in order, each match being masked from the
+// text before the next patterns run, so that e.g. the domain of a URL or the
+// hex digits of a SHA-256 are not extracted on their own
+var indicatorPatterns = []indicatorPattern{
+	{TypeURL, regexp.MustCompile(`(?i)\b(?:https?|ftp)://[^\s"'<>()\[\]{}]+`)},
+	{TypeEmailSrc, regexp.MustCompile(`(?i)\b[a-z0-9._%+-]+@(?:[a-z0-9-]+\.)+[a-z]{2,63}\b`)},
+	{TypeVulnerability, regexp.MustCompile(`(?i)\bCVE-\d{4}-\d{4,}\b`)},
+	{TypeRegkey, regexp.MustCompile(`(?i)\b(?:HKLM|HKCU|HKCR|HKU|HKCC|HKEY_[A-Z_]+)\\[^\s"'<>|]+`)},
+	{TypeSSDeep, regexp.MustCompile(`\b\d+:[0-9A-Za-z/+]{3,}:[0-9A-Za-z/+]{3,}`)},
+	{TypeSHA512, regexp.MustCompile(`\b[0-9a-fA-F]{128}\b`)},
+	{TypeSHA256, regexp.MustCompile(`\b[0-9a-fA-F]{64}\b`)},
+	{TypeSHA1, regexp.MustCompile(`\b[0-9a-fA-F]{40}\b`)},
+	{TypeMD5, regexp.MustCompile(`\b[0-9a-fA-F]{32}\b`)},
+	{TypeBTC, regexp.MustCompile(`\b(?:[13][1-9A-HJ-NP-Za-km-z]{25,34}|bc1[02-9ac-hj-np-z]{11,71})\b`)},
+	{TypeIPDst, regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}(?:/\d{1,2})?\b`)},
+	{TypeIPDst, regexp.MustCompile(`(?i)(?:^|[^0-9a-f:])((?:[0-9a-f]{0,4}:){2,7}[0-9a-f]{0,4}(?:/\d{1,3})?)`)},
+	{TypeDomain, regexp.MustCompile(`(?i)\b(?:[a-z0-9_](?:[a-z0-9_-]{0,61}[a-z0-9])?\.)+[a-z][a-z0-9-]{1,62}\b`)},
+}
+
+// ExtractIndicators finds indicators in plain text or HTML and returns them as
+// draft attributes, in order of appearance: URLs, email addresses, CVE
+// identifiers, registry keys, hashes (md5, sha1, sha256, sha512, ssdeep),
+// bitcoin addresses, IP addresses and CIDR blocks, domains and hostnames.
+//
+// Defanged indicators are refanged, values are canonicalized and duplicates
+// removed. Attributes get the default category and IDS flag of their type from
+// DefaultDescribeTypes. Domains are only reported when their TLD is listed in
+// DefaultPublicSuffixList, which keeps file names out of the results.
+func ExtractIndicators(text string) []Attribute {
+	if htmlRegexp.MatchString(text) {
+		text = htmlDropRegexp.ReplaceAllString(text, " ")
+		text = htmlBlockRegexp.ReplaceAllString(text, "\n")
+		text = html.UnescapeString(htmlTagRegexp.ReplaceAllString(text, " "))
+	}
+	text = Refang(text)
+
+	type match struct {
+		offset int
+		attr   Attribute
+	}
+
+	var matches []match
+	seen := make(map[string]bool)
+	masked := []byte(text)
+
+	for _, pattern := range indicatorPatterns {
+		for _, loc := range pattern.regexp.FindAllSubmatchIndex(masked, -1) {
+			start, end := loc[0], loc[1]
+			if len(loc) > 2 {
+				start, end = loc[2], loc[3]
+			}
+
+			attr, ok := draftAttribute(pattern.attrType, text[start:end])
+			if !ok {
+				continue
+			}
+
+			for i := start; i < end; i++ {
+				masked[i] = ' '
+			}
+
+			key := attr.Type + "|" + attr.Value
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+
+			matches = append(matches, match{offset: start, attr: attr})
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].offset < matches[j].offset
+	})
+
+	attrs := make([]Attribute, len(matches))
+	for i, m := range matches {
+		attrs[i] = m.attr
+	}
+
+	return attrs
+}
+
+// draftAttribute builds the attribute for a match, refining its type, and
+// tells whether the match is a valid indicator
+func draftAttribute(attrType, value string) (Attribute, bool) {
+	switch attrType {
+	case TypeURL, TypeRegkey:
+		// Trailing punctuation belongs to the sentence, not to the URL
+		value = strings.TrimRight(value, ".,;:!?'\"")
+	case TypeIPDst:
+		ip := value
+		if i := strings.Index(ip, "/"); i >= 0 {
+			ip = ip[:i]
+		}
+		if parsed := net.ParseIP(ip); parsed == nil || parsed.IsUnspecified() {
+			return Attribute{}, false
+		}
+	case TypeDomain:
+		value = strings.ToLower(value)
+		if !DefaultPublicSuffixList.IsListed(value) {
+			return Attribute{}, false
+		}
+		registered := DefaultPublicSuffixList.RegisteredDomain(value)
+		if registered == "" {
+			return Attribute{}, false
+		}
+		if registered != value {
+			attrType = TypeHostname
+		}
+	}
+
+	attr := Attribute{Type: attrType, Value: value}
+	attr.Normalize()
+	if validateValue(attr.Type, attr.Value) != nil {
+		return Attribute{}, false
+	}
+	DefaultDescribeTypes.ApplyDefaults(&attr)
+	attr.ToIDS = DefaultDescribeTypes.DefaultToIDS(attr.Type)
+
+	return attr, true
+}
+
+// FreeTextImport is a request to MISP's server-side freetext import
+type FreeTextImport struct {
+	// The text to extract attributes from
+	Value string `json:"value"`
+
+	// Only return the proposed attributes instead of adding them to the event
+	ReturnMetaAttributes bool `json:"returnMetaAttributes,omitempty"`
+
+	// How to deal with values matching an enabled warninglist: "soft" adds
+	// them without the IDS flag, "1" drops them
+	AdhereToWarninglists string `json:"adhereToWarninglists,omitempty"`
+
+	// Distribution of the created attributes
+	Distribution string `json:"distribution,omitempty"`
+}
+
+// FreeTextAttribute is an attribute proposed or created by the freetext
+// import, along with the types MISP considers possible for its value
+type FreeTextAttribute struct {
+	Attribute
+	DefaultType   string   `json:"default_type,omitempty"`
+	Types         []string `json:"types,omitempty"`
+	OriginalValue string   `json:"original_value,omitempty"`
+}
+
+// FreeTextImport submits text to the freetext import of the given event. When
+// req.ReturnMetaAttributes is set the attributes are only proposed, and can be
+// reviewed then added with ConfirmFreeText; otherwise MISP adds them directly.
+func (client *Client) FreeTextImport(eventID string, req *FreeTextImport) ([]FreeTextAttribute, error) {
+	path := fmt.Sprintf("/events/freeTextImport/%s", eventID)
+
+	resp, err := client.Post(path, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var attrs []FreeTextAttribute
+	decoder := json.NewDecoder(resp.Body)
+	if err = decoder.Decode(&attrs); err != nil {
+		return nil, fmt.Errorf("Could not unmarshal freetext attributes: %s", err)
+	}
+
+	return attrs, nil
+}
+
+// freeTextEntry is an attribute of a saveFreeText request, in the format of
+// MISP's freetext import results form
+type freeTextEntry struct {
+	Value              string `json:"value"`
+	Category           string `json:"category"`
+	Type               string `json:"type"`
+	ToIDS              bool   `json:"to_ids"`
+	DisableCorrelation bool   `json:"disable_correlation"`
+	Comment            string `json:"comment"`
+	Distribution       string `json:"distribution"`
+	SharingGroupID     string `json:"sharing_group_id,omitempty"`
+}
+
+// ConfirmFreeText adds attributes proposed by FreeTextImport to the event,
+// through MISP's saveFreeText endpoint as the freetext import form does.
+// Proposed attributes without a type get their default type, and those
+// without distribution inherit the distribution of the event.
+func (client *Client) ConfirmFreeText(eventID string, proposed []FreeTextAttribute) error {
+	entries := make([]freeTextEntry, len(proposed))
+	for i, p := range proposed {
+		entries[i] = freeTextEntry{
+			Value:              p.Value,
+			Category:           p.Category,
+			Type:               p.Type,
+			ToIDS:              p.ToIDS,
+			DisableCorrelation: p.DisableCorrelation,
+			Comment:            p.Comment,
+			Distribution:       p.Distribution,
+			SharingGroupID:     p.SharingGroupID,
+		}
+		if entries[i].Type == "" {
+			entries[i].Type = p.DefaultType
+		}
+		if entries[i].Distribution == "" {
+			entries[i].Distribution = "5"
+		}
+	}
+
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return fmt.Errorf("Could not marshal freetext attributes: %s", err)
+	}
+
+	type saveFreeTextType struct {
+		JSONObject     string `json:"JsonObject"`
+		DefaultComment string `json:"default_comment"`
+		Force          bool   `json:"force"`
+	}
+	req := map[string]saveFreeTextType{"Attribute": {JSONObject: string(data)}}
+
+	resp, err := client.Post(fmt.Sprintf("/events/saveFreeText/%s", eventID), req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Saved   bool            `json:"saved"`
+		Errors  json.RawMessage `json:"errors"`
+		Message string          `json:"message"`
+	}
+	decoder := json.NewDecoder(resp.Body)
+	if err = decoder.Decode(&result); err != nil {
+		return fmt.Errorf("Could not unmarshal response: %s", err)
+	}
+
+	if !result.Saved {
+		if len(result.Errors) == 0 || string(result.Errors) == "null" {
+			return fmt.Errorf("MISP returned an error: %s", result.Message)
+		}
+		return fmt.Errorf("MISP returned an error: %s", result.Errors)
+	}
+
+	return nil
+}
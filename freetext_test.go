@@ -0,0 +1,49 @@
+package misp
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_ExtractIndicators(t *testing.T) {
+	text := `<html><body><p>The dropper (invoice.exe, MD5 68B329DA9893E34099C7D8AD5CB9C940)
+exploits CVE-2017-11882 and downloads hxxp://cdn.evil[.]com/payload.bin from 203.0.113[.]7.</p>
+<p>It beacons to c2.evil.co.uk and 2001:db8::dead:beef, and persists in
+HKCU\Software\Microsoft\Windows\CurrentVersion\Run. Contact: admin[@]evil.com.
+Ransom goes to 1BoatSLRHtKNngkdXEeobR76b53LETtpyT.</p>
+<p>Once more: 68b329da9893e34099c7d8ad5cb9c940 and sha256
+e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855</p>
+<script>var ignored = "http://in.script.com";</script></body></html>`
+
+	want := []Attribute{
+		{Type: TypeMD5, Category: CategoryPayloadDelivery, ToIDS: true, Value: "68b329da9893e34099c7d8ad5cb9c940"},
+		{Type: TypeVulnerability, Category: CategoryExternalAnalysis, Value: "CVE-2017-11882"},
+		{Type: TypeURL, Category: CategoryNetworkActivity, ToIDS: true, Value: "http://cdn.evil.com/payload.bin"},
+		{Type: TypeIPDst, Category: CategoryNetworkActivity, ToIDS: true, Value: "203.0.113.7"},
+		{Type: TypeHostname, Category: CategoryNetworkActivity, ToIDS: true, Value: "c2.evil.co.uk"},
+		{Type: TypeIPDst, Category: CategoryNetworkActivity, ToIDS: true, Value: "2001:db8::dead:beef"},
+		{Type: TypeRegkey, Category: CategoryPersistenceMechanism, ToIDS: true, Value: `HKCU\Software\Microsoft\Windows\CurrentVersion\Run`},
+		{Type: TypeEmailSrc, Category: CategoryPayloadDelivery, ToIDS: true, Value: "admin@evil.com"},
+		{Type: TypeBTC, Category: CategoryFinancialFraud, ToIDS: true, Value: "1BoatSLRHtKNngkdXEeobR76b53LETtpyT"},
+		{Type: TypeSHA256, Category: CategoryPayloadDelivery, ToIDS: true, Value: "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"},
+	}
+
+	got := ExtractIndicators(text)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ExtractIndicators returned:")
+		for _, attr := range got {
+			t.Errorf("\t%+v", attr)
+		}
+	}
+}
+
+func Test_ExtractIndicators_NewTLDs(t *testing.T) {
+	var values []string
+	for _, attr := range ExtractIndicators("Landing pages on login.evil.sbs, x.cfd and update.zip") {
+		values = append(values, attr.Type+" "+attr.Value)
+	}
+	want := []string{"hostname login.evil.sbs", "domain x.cfd", "domain update.zip"}
+	if !reflect.DeepEqual(values, want) {
+		t.Errorf("Expected %v, got %v", want, values)
+	}
+}
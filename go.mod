@@ -1 +1,3 @@
 module github.com/citronneur/mispgo
+
+go 1.16
@@ -0,0 +1,260 @@
+package misp
+
+import (
+	"net"
+	"sort"
+	"strings"
+	"sync/atomic"
+)
+
+// matcherFoldTypes are the types whose values match case-insensitively
+var matcherFoldTypes = map[string]bool{
+	TypeMD5: true, TypeSHA1: true, TypeSHA224: true, TypeSHA256: true, TypeSHA384: true, TypeSHA512: true,
+	TypeSHA512_224: true, TypeSHA512_256: true, TypeSHA3_224: true, TypeSHA3_256: true, TypeSHA3_384: true,
+	TypeSHA3_512: true, TypeImphash: true, TypeAuthentihash: true, TypeCDHash: true, TypePEHash: true,
+	TypeTLSH: true, TypeJA3FingerprintMD5: true, TypeX509FingerprintMD5: true, TypeX509FingerprintSHA1: true,
+	TypeX509FingerprintSHA256: true, TypeHostname: true, TypeEmail: true, TypeEmailSrc: true, TypeEmailDst: true,
+	TypeEmailReplyTo: true, TypeTargetEmail: true, TypeMACAddress: true, TypeRegkey: true,
+}
+
+// matcherSkipTypes are the types whose values are too generic to be matched
+var matcherSkipTypes = map[string]bool{
+	TypePort:    true,
+	TypeComment: true,
+	TypeText:    true,
+	TypeOther:   true,
+}
+
+// Matcher matches values, such as log fields, against a set of attributes
+// held in memory. Values match attributes of the same value, case-insensitive
+// for hashes, hostnames and email addresses, as well as:
+//
+//   - IP addresses match the ip-src and ip-dst attributes of the networks
+//     containing them, indexed in a radix tree
+//   - Hostnames match the domain attributes of their parent domains
+//   - URLs match the url attributes they start with, on a path, query or
+//     fragment boundary and whatever their scheme
+//
+// Parts of composite attributes are matched on their own, e.g. the hash of
+// filename|md5 attributes. Matchers are safe for concurrent use, and Reload
+// atomically replaces the attributes while matching goes on.
+type Matcher struct {
+	index atomic.Value // *matcherIndex
+}
+
+// matcherIndex is an immutable index of attributes, replaced on reload
+type matcherIndex struct {
+	attrs   []Attribute
+	exact   map[string][]int
+	folded  map[string][]int
+	domains map[string][]int
+	urls    map[string][]int
+	ipv4    *ipTrieNode
+	ipv6    *ipTrieNode
+}
+
+// ipTrieNode is a node of a binary radix tree of networks, indexed by the
+// bits of their prefix
+type ipTrieNode struct {
+	children [2]*ipTrieNode
+	attrs    []int
+}
+
+// NewMatcher returns a matcher of the attributes, such as SearchAttribute
+// results
+func NewMatcher(attrs []Attribute) *Matcher {
+	m := &Matcher{}
+	m.Reload(attrs)
+	return m
+}
+
+// Reload replaces the attributes of the matcher. The new index is built
+// before being swapped in, so that matching is never blocked nor sees
+// partially loaded attributes.
+func (m *Matcher) Reload(attrs []Attribute) {
+	m.index.Store(newMatcherIndex(attrs))
+}
+
+// Len returns the number of attributes of the matcher
+func (m *Matcher) Len() int {
+	return len(m.load().attrs)
+}
+
+func (m *Matcher) load() *matcherIndex {
+	index, _ := m.index.Load().(*matcherIndex)
+	if index == nil {
+		return &matcherIndex{}
+	}
+	return index
+}
+
+func newMatcherIndex(attrs []Attribute) *matcherIndex {
+	index := &matcherIndex{
+		exact:   make(map[string][]int),
+		folded:  make(map[string][]int),
+		domains: make(map[string][]int),
+		urls:    make(map[string][]int),
+		ipv4:    &ipTrieNode{},
+		ipv6:    &ipTrieNode{},
+	}
+
+	for _, attr := range attrs {
+		if attr.Deleted {
+			continue
+		}
+		i := len(index.attrs)
+		index.attrs = append(index.attrs, attr)
+
+		types := []string{attr.Type}
+		values := []string{attr.Value}
+		if parts, err := attr.Composite(); err == nil {
+			types = CompositePartTypes(attr.Type)
+			values = parts
+		}
+
+		for j, attrType := range types {
+			value := strings.TrimSpace(values[j])
+			if value == "" || matcherSkipTypes[attrType] {
+				continue
+			}
+
+			switch attrType {
+			case TypeIPSrc, TypeIPDst:
+				if network, err := parseNetwork(value); err == nil {
+					index.addNetwork(network, i)
+					continue
+				}
+			case TypeDomain:
+				addIndex(index.domains, strings.ToLower(strings.TrimSuffix(value, ".")), i)
+				continue
+			case TypeHostname:
+				value = strings.TrimSuffix(value, ".")
+			case TypeURL:
+				addIndex(index.urls, matcherURL(value), i)
+				continue
+			}
+
+			if matcherFoldTypes[attrType] {
+				addIndex(index.folded, strings.ToLower(value), i)
+			} else {
+				addIndex(index.exact, value, i)
+			}
+		}
+	}
+
+	return index
+}
+
+func addIndex(index map[string][]int, key string, i int) {
+	attrs := index[key]
+	if n := len(attrs); n == 0 || attrs[n-1] != i {
+		index[key] = append(attrs, i)
+	}
+}
+
+func (index *matcherIndex) addNetwork(network *net.IPNet, i int) {
+	node := index.ipv6
+	ip, ones, bits := ipNetworkPrefix(network)
+	if bits == 32 {
+		node = index.ipv4
+	}
+
+	for bit := 0; bit < ones; bit++ {
+		b := ip[bit/8] >> (7 - uint(bit%8)) & 1
+		if node.children[b] == nil {
+			node.children[b] = &ipTrieNode{}
+		}
+		node = node.children[b]
+	}
+	if n := len(node.attrs); n == 0 || node.attrs[n-1] != i {
+		node.attrs = append(node.attrs, i)
+	}
+}
+
+// matcherURL normalizes a URL for prefix matching: without scheme, with a
+// lowercase host
+func matcherURL(value string) string {
+	if i := strings.Index(value, "://"); i >= 0 {
+		value = value[i+3:]
+	}
+	host := strings.IndexAny(value, "/?#")
+	if host < 0 {
+		host = len(value)
+	}
+	return strings.ToLower(value[:host]) + value[host:]
+}
+
+// Match returns the attributes matching the value, in the order they were
+// loaded
+func (m *Matcher) Match(value string) []Attribute {
+	index := m.load()
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil
+	}
+
+	var matches []int
+	matches = append(matches, index.exact[value]...)
+	lower := strings.ToLower(value)
+	matches = append(matches, index.folded[strings.TrimSuffix(lower, ".")]...)
+
+	if ip := net.ParseIP(value); ip != nil {
+		matches = append(matches, index.matchIP(ip)...)
+	} else if !strings.ContainsAny(value, "/?#:@ ") {
+		// Parent domains, up to the domain itself
+		domain := strings.TrimSuffix(lower, ".")
+		for {
+			matches = append(matches, index.domains[domain]...)
+			dot := strings.IndexByte(domain, '.')
+			if dot < 0 {
+				break
+			}
+			domain = domain[dot+1:]
+		}
+	}
+
+	if len(index.urls) > 0 {
+		url := matcherURL(value)
+		for i := 0; i < len(url); i++ {
+			switch url[i] {
+			case '/':
+				matches = append(matches, index.urls[url[:i]]...)
+				matches = append(matches, index.urls[url[:i+1]]...)
+			case '?', '#', '&':
+				matches = append(matches, index.urls[url[:i]]...)
+			}
+		}
+		matches = append(matches, index.urls[url]...)
+	}
+
+	if len(matches) == 0 {
+		return nil
+	}
+
+	sort.Ints(matches)
+	result := make([]Attribute, 0, len(matches))
+	for i, match := range matches {
+		if i == 0 || match != matches[i-1] {
+			result = append(result, index.attrs[match])
+		}
+	}
+	return result
+}
+
+// matchIP returns the attributes of the networks containing ip
+func (index *matcherIndex) matchIP(ip net.IP) []int {
+	node := index.ipv6
+	if ip4 := ip.To4(); ip4 != nil {
+		node, ip = index.ipv4, ip4
+	}
+
+	var matches []int
+	for bit := 0; node != nil; bit++ {
+		matches = append(matches, node.attrs...)
+		if bit == len(ip)*8 {
+			break
+		}
+		node = node.children[ip[bit/8]>>(7-uint(bit%8))&1]
+	}
+	return matches
+}
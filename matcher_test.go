@@ -0,0 +1,88 @@
+package misp
+
+import (
+	"sync"
+	"testing"
+)
+
+func Test_Matcher(t *testing.T) {
+	m := NewMatcher([]Attribute{
+		{ID: "1", Type: TypeIPDst, Value: "203.0.113.0/24"},
+		{ID: "2", Type: TypeIPSrcPort, Value: "203.0.113.9|443"},
+		{ID: "3", Type: TypeIPDst, Value: "2001:db8::/32"},
+		{ID: "4", Type: TypeDomain, Value: "Evil.com"},
+		{ID: "5", Type: TypeHostname, Value: "c2.bad.net."},
+		{ID: "6", Type: TypeURL, Value: "https://Evil.com/gate"},
+		{ID: "7", Type: TypeFilenameMD5, Value: "invoice.exe|68B329DA9893E34099C7D8AD5CB9C940"},
+		{ID: "8", Type: TypeMutex, Value: "Global\\Evil"},
+		{ID: "9", Type: TypeDomain, Value: "deleted.com", Deleted: true},
+		{ID: "10", Type: TypeIPDst, Value: "8.8.8.8"},
+		{ID: "11", Type: TypeIPDst, Value: "::ffff:192.0.2.0/120"},
+	})
+	if m.Len() != 10 {
+		t.Errorf("Expected 10 attributes, got %d", m.Len())
+	}
+
+	for _, test := range []struct {
+		value string
+		ids   []string
+	}{
+		{"203.0.113.9", []string{"1", "2"}},
+		{"203.0.113.200", []string{"1"}},
+		{"203.0.114.1", nil},
+		{"2001:db8:1::1", []string{"3"}},
+		{"8.8.8.8", []string{"10"}},
+		{"8.8.8.9", nil},
+		{"192.0.2.7", []string{"11"}},
+		{"::ffff:192.0.2.7", []string{"11"}},
+		{"192.0.3.1", nil},
+		{"evil.com", []string{"4"}},
+		{"www.EVIL.com.", []string{"4"}},
+		{"notevil.com", nil},
+		{"C2.bad.net", []string{"5"}},
+		{"sub.c2.bad.net", nil},
+		{"http://evil.com/gate?id=1", []string{"6"}},
+		{"https://EVIL.COM/gate/2", []string{"6"}},
+		{"https://evil.com/gateway", nil},
+		{"68b329da9893e34099c7d8ad5cb9c940", []string{"7"}},
+		{"invoice.exe", []string{"7"}},
+		{"Global\\Evil", []string{"8"}},
+		{"global\\evil", nil},
+		{"deleted.com", nil},
+	} {
+		matches := m.Match(test.value)
+		var ids []string
+		for _, attr := range matches {
+			ids = append(ids, attr.ID)
+		}
+		if len(ids) != len(test.ids) {
+			t.Errorf("%s: expected %v, got %v", test.value, test.ids, ids)
+			continue
+		}
+		for i := range ids {
+			if ids[i] != test.ids[i] {
+				t.Errorf("%s: expected %v, got %v", test.value, test.ids, ids)
+				break
+			}
+		}
+	}
+
+	// Matching goes on while indicators are reloaded
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			m.Match("www.evil.com")
+		}
+	}()
+	m.Reload([]Attribute{{Type: TypeDomain, Value: "other.org"}})
+	wg.Wait()
+
+	if len(m.Match("evil.com")) != 0 || len(m.Match("a.other.org")) != 1 {
+		t.Errorf("Attributes were not reloaded")
+	}
+	if len((&Matcher{}).Match("evil.com")) != 0 {
+		t.Errorf("Empty matcher matched")
+	}
+}
@@ -27,6 +27,20 @@ type Misp interface {
 	Get(path string, req interface{}) (*http.Response, error)
 	Post(path string, req interface{}) (*http.Response, error)
 	SearchAttribute(q *AttributeQuery) ([]Attribute, error)
+	AddObject(eventID string, object *Object) (*Object, error)
+	AddObjectReference(ref *ObjectReference) (*ObjectReference, error)
+	AddObjects(eventID string, objects []Object) error
+	GetDescribeTypes() (*DescribeTypes, error)
+	AddAttribute(eventID string, attr *Attribute) (*Attribute, error)
+	AddAttributes(eventID string, attrs []Attribute) ([]Attribute, error)
+	FreeTextImport(eventID string, req *FreeTextImport) ([]FreeTextAttribute, error)
+	ConfirmFreeText(eventID string, proposed []FreeTextAttribute) error
+	GetWarninglists() ([]Warninglist, error)
+	GetWarninglist(warninglistID string) (*Warninglist, error)
+	EnableWarninglist(warninglistID string, enabled bool) error
+	CheckWarninglistValues(values []string) (map[string][]WarninglistMatch, error)
+	ExportEvents(format string, q *EventQuery, w io.Writer) error
+	ExportAttributes(format string, q *AttributeQuery, w io.Writer) error
 	Do(method, path string, req interface{}) (*http.Response, error)
 }
 
@@ -41,11 +55,22 @@ type Client struct {
 
 // Sighting ... XXX
 type Sighting struct {
-	ID        string   `json:"id,omitempty"`
-	UUID      string   `json:"uuid,omitempty"`
-	Value     string   `json:"value,omitempty"`
-	Values    []string `json:"values,omitempty"`
-	Timestamp int      `json:"timestamp,omitempty"`
+	ID            string   `json:"id,omitempty"`
+	UUID          string   `json:"uuid,omitempty"`
+	Value         string   `json:"value,omitempty"`
+	Values        []string `json:"values,omitempty"`
+	Timestamp     int      `json:"timestamp,omitempty"`
+	AttributeID   string   `json:"attribute_id,omitempty"`
+	AttributeUUID string   `json:"attribute_uuid,omitempty"`
+	EventID       string   `json:"event_id,omitempty"`
+	OrgID         string   `json:"org_id,omitempty"`
+	DateSighting  string   `json:"date_sighting,omitempty"`
+	Type          string   `json:"type,omitempty"` // 0 for a sighting, 1 for a false positive, 2 for an expiration
+	Source        string   `json:"source,omitempty"`
+	Org           *Org     `json:"Organisation,omitempty"`
+
+	// Fields unknown to this package, kept when decoding for encoding
+	Extra map[string]json.RawMessage `json:"-"`
 }
 
 // Request ... XXX
@@ -138,6 +163,13 @@ type AttributeQuery struct {
 	// The returned events must include an attribute with the given UUID, or
 	// alternatively the event's UUID must match the value(s) passed.
 	UUID string `json:"uuid,omitempty"`
+
+	// Only return attributes with the IDS flag set ("1") or unset ("0")
+	ToIDS string `json:"to_ids,omitempty"`
+
+	// Paginate the results, limit being the number of results per page
+	Limit string `json:"limit,omitempty"`
+	Page  string `json:"page,omitempty"`
 }
 
 // Search ... XXX
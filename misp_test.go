@@ -10,6 +10,7 @@ import (
 	"net/url"
 	"os"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -279,3 +280,147 @@ func Test_DownloadSample(t *testing.T) {
 		t.Errorf("Wrong download:\n\texpected %#v\n\tgot %#v", expected, result)
 	}
 }
+
+func Test_AddObjects(t *testing.T) {
+	setup()
+
+	file := NewObject("file", "file")
+	file.AddAttribute("filename", "filename", "foo.exe")
+	pe := NewObject("pe", "file")
+	file.AddReference(pe.UUID, "includes")
+
+	var added []string
+	mux.HandleFunc("/objects/add/42",
+		func(w http.ResponseWriter, r *http.Request) {
+			testMethod(t, r, "POST")
+
+			var got struct {
+				Object Object `json:"Object"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+				t.Errorf("Cannot decode json Object request: %s", err)
+			}
+			added = append(added, got.Object.UUID)
+
+			json.NewEncoder(w).Encode(got)
+		})
+
+	mux.HandleFunc("/objectReferences/add/"+file.UUID,
+		func(w http.ResponseWriter, r *http.Request) {
+			testMethod(t, r, "POST")
+			if len(added) != 2 {
+				t.Errorf("Reference added before all objects were created")
+			}
+
+			fmt.Fprint(w, `{"ObjectReference": {"id": "1", "relationship_type": "includes"}}`)
+		})
+
+	if err := client.AddObjects("42", []Object{*file, *pe}); err != nil {
+		t.Errorf("AddObjects returned error: %s", err)
+	}
+
+	if !reflect.DeepEqual(added, []string{file.UUID, pe.UUID}) {
+		t.Errorf("AddObjects added %v, want %v", added, []string{file.UUID, pe.UUID})
+	}
+}
+
+func Test_FreeTextImport(t *testing.T) {
+	setup()
+
+	mux.HandleFunc("/events/freeTextImport/42",
+		func(w http.ResponseWriter, r *http.Request) {
+			testMethod(t, r, "POST")
+
+			var got FreeTextImport
+			if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+				t.Errorf("Cannot decode json FreeTextImport request: %s", err)
+			}
+			want := FreeTextImport{Value: "evil.com 203.0.113.7", ReturnMetaAttributes: true}
+			if got != want {
+				t.Errorf("FreeTextImport sent %+v, want %+v", got, want)
+			}
+
+			fmt.Fprint(w, `[{"value": "evil.com", "category": "Network activity", "to_ids": true, "default_type": "domain", "types": ["domain", "hostname"]}, {"value": "203.0.113.7", "category": "Network activity", "type": "ip-src", "to_ids": true, "default_type": "ip-dst", "types": ["ip-dst", "ip-src"]}]`)
+		})
+
+	mux.HandleFunc("/events/saveFreeText/42",
+		func(w http.ResponseWriter, r *http.Request) {
+			testMethod(t, r, "POST")
+
+			var req struct {
+				Attribute struct {
+					JSONObject string `json:"JsonObject"`
+				} `json:"Attribute"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				t.Errorf("Cannot decode json saveFreeText request: %s", err)
+			}
+			var got []map[string]interface{}
+			if err := json.Unmarshal([]byte(req.Attribute.JSONObject), &got); err != nil {
+				t.Errorf("Cannot decode json JsonObject: %s", err)
+			}
+			if len(got) != 2 || got[0]["type"] != "domain" || got[1]["type"] != "ip-src" ||
+				got[0]["to_ids"] != true || got[0]["distribution"] != "5" {
+				t.Errorf("ConfirmFreeText sent %+v", got)
+			}
+
+			fmt.Fprint(w, `{"saved": true, "success": true, "name": "Freetext import", "message": "2 attributes created."}`)
+		})
+
+	proposed, err := client.FreeTextImport("42", &FreeTextImport{Value: "evil.com 203.0.113.7", ReturnMetaAttributes: true})
+	if err != nil {
+		t.Fatalf("FreeTextImport returned error: %s", err)
+	}
+	if len(proposed) != 2 || proposed[0].DefaultType != "domain" || len(proposed[1].Types) != 2 {
+		t.Errorf("FreeTextImport returned %+v", proposed)
+	}
+
+	if err = client.ConfirmFreeText("42", proposed); err != nil {
+		t.Errorf("ConfirmFreeText returned error: %s", err)
+	}
+}
+
+func Test_ConfirmFreeTextNotSaved(t *testing.T) {
+	setup()
+
+	mux.HandleFunc("/events/saveFreeText/43",
+		func(w http.ResponseWriter, r *http.Request) {
+			testMethod(t, r, "POST")
+			fmt.Fprint(w, `{"saved": false, "name": "Failed", "message": "Failed", "url": "/events/saveFreeText/43", "errors": ["Attribute could not be saved"]}`)
+		})
+
+	err := client.ConfirmFreeText("43", []FreeTextAttribute{{Attribute: Attribute{Value: "evil.com"}, DefaultType: TypeDomain}})
+	if err == nil || !strings.Contains(err.Error(), "Attribute could not be saved") {
+		t.Errorf("Expected error, got %v", err)
+	}
+}
+
+func Test_ExportAttributes(t *testing.T) {
+	setup()
+
+	mux.HandleFunc("/attributes/restSearch",
+		func(w http.ResponseWriter, r *http.Request) {
+			testMethod(t, r, "POST")
+
+			var got map[string]string
+			if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+				t.Errorf("Cannot decode json restSearch request: %s", err)
+			}
+			want := map[string]string{"returnFormat": "csv", "type": "ip-dst", "to_ids": "1"}
+			if !reflect.DeepEqual(want, got) {
+				t.Errorf("ExportAttributes sent %+v, want %+v", got, want)
+			}
+
+			fmt.Fprint(w, "uuid,event_id,category,type,value\n58b98766-73cc-437f-a814-4a9a0a3ac101,6871,Network activity,ip-dst,203.0.113.7\n")
+		})
+
+	var buf bytes.Buffer
+	err := client.ExportAttributes(ReturnFormatCSV, &AttributeQuery{Type: TypeIPDst, ToIDS: "1"}, &buf)
+	if err != nil {
+		t.Errorf("ExportAttributes returned error: %s", err)
+	}
+
+	if want := "uuid,event_id,category,type,value\n58b98766-73cc-437f-a814-4a9a0a3ac101,6871,Network activity,ip-dst,203.0.113.7\n"; buf.String() != want {
+		t.Errorf("ExportAttributes wrote %q, want %q", buf.String(), want)
+	}
+}
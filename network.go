@@ -0,0 +1,112 @@
+package misp
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+var urlSchemeRegexp = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9+.-]*://`)
+
+// NormalizeURL parses a raw URL and normalizes it: surrounding whitespace is
+// removed, a missing scheme defaults to http, scheme and host are lowercased,
+// the trailing dot of the host and the default port of the scheme are removed.
+func NormalizeURL(raw string) (*url.URL, error) {
+	raw = strings.TrimSpace(raw)
+	if !urlSchemeRegexp.MatchString(raw) {
+		raw = "http://" + raw
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("Could not parse URL: %s", err)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("Could not parse URL: no host in %s", raw)
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	port := u.Port()
+	if (u.Scheme == "http" && port == "80") || (u.Scheme == "https" && port == "443") {
+		port = ""
+	}
+
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	if port != "" {
+		host = host + ":" + port
+	}
+	u.Host = host
+
+	return u, nil
+}
+
+// NewURLObject builds a url object from a raw URL, see NormalizeURL. The
+// domain is split using DefaultPublicSuffixList.
+func NewURLObject(raw string) (*Object, error) {
+	u, err := NormalizeURL(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	object := NewObject("url", "network")
+	object.AddAttribute("url", "url", u.String())
+	object.AddAttribute("scheme", "text", u.Scheme)
+	object.AddAttribute("port", "port", u.Port())
+	object.AddAttribute("resource_path", "text", u.EscapedPath())
+	object.AddAttribute("query_string", "text", u.RawQuery)
+	object.AddAttribute("fragment", "text", u.Fragment)
+	if u.User != nil {
+		object.AddAttribute("credential", "text", u.User.String())
+	}
+
+	host := u.Hostname()
+	if net.ParseIP(host) != nil {
+		object.AddAttribute("ip", "ip-dst", host)
+		return object, nil
+	}
+
+	object.AddAttribute("host", "hostname", host)
+
+	subdomain, label, tld := DefaultPublicSuffixList.SplitDomain(host)
+	if label != "" {
+		object.AddAttribute("domain", "domain", label+"."+tld)
+	}
+	object.AddAttribute("domain_without_tld", "text", label)
+	object.AddAttribute("subdomain", "text", subdomain)
+	object.AddAttribute("tld", "text", tld)
+
+	return object, nil
+}
+
+// NewDomainIPObject builds a domain-ip object from a domain and the IP
+// addresses it resolved to
+func NewDomainIPObject(domain string, ips []net.IP) (*Object, error) {
+	domain = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(domain)), ".")
+	if domain == "" {
+		return nil, fmt.Errorf("Empty domain")
+	}
+
+	object := NewObject("domain-ip", "network")
+
+	// Only registered domains go in the domain relation, FQDNs are hostnames
+	if registered := DefaultPublicSuffixList.RegisteredDomain(domain); registered == domain {
+		object.AddAttribute("domain", "domain", domain)
+	} else {
+		object.AddAttribute("hostname", "hostname", domain)
+		object.AddAttribute("domain", "domain", registered)
+	}
+
+	for _, ip := range ips {
+		if ip == nil {
+			continue
+		}
+		object.AddAttribute("ip", "ip-dst", ip.String())
+	}
+
+	return object, nil
+}
@@ -0,0 +1,99 @@
+package misp
+
+import (
+	"net"
+	"testing"
+)
+
+func Test_PublicSuffix(t *testing.T) {
+	tests := []struct {
+		domain, subdomain, label, suffix string
+	}{
+		{"www.evil.com", "www", "evil", "com"},
+		{"a.b.evil.co.uk.", "a.b", "evil", "co.uk"},
+		{"co.uk", "", "", "co.uk"},
+		{"foo.bar.kawasaki.jp", "", "foo", "bar.kawasaki.jp"},
+		{"www.city.kawasaki.jp", "www", "city", "kawasaki.jp"},
+		{"evil.unknowntld", "", "evil", "unknowntld"},
+		{"phish.github.io", "", "phish", "github.io"},
+		{"login.evil.sbs", "login", "evil", "sbs"},
+		{"x.cfd", "", "x", "cfd"},
+	}
+
+	for _, test := range tests {
+		subdomain, label, suffix := DefaultPublicSuffixList.SplitDomain(test.domain)
+		if subdomain != test.subdomain || label != test.label || suffix != test.suffix {
+			t.Errorf("SplitDomain(%q) = %q, %q, %q, want %q, %q, %q", test.domain,
+				subdomain, label, suffix, test.subdomain, test.label, test.suffix)
+		}
+	}
+}
+
+func Test_NewURLObject(t *testing.T) {
+	object, err := NewURLObject(" HTTPS://Login.Evil.CO.UK.:443/path/index.php?a=1#top ")
+	if err != nil {
+		t.Fatalf("NewURLObject returned error: %s", err)
+	}
+
+	want := map[string]string{
+		"url":                "https://login.evil.co.uk/path/index.php?a=1#top",
+		"scheme":             "https",
+		"host":               "login.evil.co.uk",
+		"domain":             "evil.co.uk",
+		"domain_without_tld": "evil",
+		"subdomain":          "login",
+		"tld":                "co.uk",
+		"resource_path":      "/path/index.php",
+		"query_string":       "a=1",
+		"fragment":           "top",
+	}
+
+	for relation, value := range want {
+		attrs := object.GetAttributes(relation)
+		if len(attrs) != 1 || attrs[0].Value != value {
+			t.Errorf("%s: got %+v, want %q", relation, attrs, value)
+		}
+	}
+
+	if attrs := object.GetAttributes("port"); len(attrs) != 0 {
+		t.Errorf("default port was not removed: %+v", attrs)
+	}
+}
+
+func Test_NewDomainIPObject(t *testing.T) {
+	object, err := NewDomainIPObject("Mail.Evil.com.", []net.IP{net.ParseIP("203.0.113.7"), net.ParseIP("2001:db8::1")})
+	if err != nil {
+		t.Fatalf("NewDomainIPObject returned error: %s", err)
+	}
+
+	if attrs := object.GetAttributes("hostname"); len(attrs) != 1 || attrs[0].Value != "mail.evil.com" {
+		t.Errorf("hostname: got %+v", attrs)
+	}
+	if attrs := object.GetAttributes("domain"); len(attrs) != 1 || attrs[0].Value != "evil.com" {
+		t.Errorf("domain: got %+v", attrs)
+	}
+	if attrs := object.GetAttributes("ip"); len(attrs) != 2 || attrs[1].Value != "2001:db8::1" {
+		t.Errorf("ip: got %+v", attrs)
+	}
+}
+
+func Test_NormalizeURL(t *testing.T) {
+	tests := map[string]string{
+		"evil.com/r?u=http://x":   "http://evil.com/r?u=http://x",
+		"HXXP://evil.com":         "hxxp://evil.com",
+		"svn+ssh://Evil.com/repo": "svn+ssh://evil.com/repo",
+		"https://evil.com:443/a":  "https://evil.com/a",
+		"evil.com:8080/login.php": "http://evil.com:8080/login.php",
+	}
+
+	for raw, want := range tests {
+		u, err := NormalizeURL(raw)
+		if err != nil {
+			t.Errorf("NormalizeURL(%q) returned error: %s", raw, err)
+			continue
+		}
+		if u.String() != want {
+			t.Errorf("NormalizeURL(%q) = %q, want %q", raw, u.String(), want)
+		}
+	}
+}
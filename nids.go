@@ -0,0 +1,367 @@
+package misp
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// NIDS rule formats
+const (
+	NIDSFormatSuricata = "suricata"
+	NIDSFormatSnort    = "snort"
+)
+
+// NIDSGenerator turns the attributes flagged for IDS into Suricata or Snort
+// rules. Supported types are ip-src, ip-dst and their |port variants, domain,
+// hostname, url, user-agent, ja3-fingerprint-md5 (Suricata only) and snort,
+// each rule of which, one per line, is given a SID from the configured range.
+// Other types are skipped, as are invalid IP addresses and ports.
+//
+// SIDs are allocated sequentially across calls, so a generator should be used
+// for a single rule file.
+type NIDSGenerator struct {
+	// NIDSFormatSuricata (default) or NIDSFormatSnort
+	Format string
+
+	// Range of SIDs of the generated rules, by default from 1000000 with no
+	// upper bound
+	SIDStart int
+	SIDEnd   int
+
+	// Template of the msg option, where {event_id}, {event_info}, {type},
+	// {category}, {value} and {uuid} are replaced with the attribute and
+	// event fields. The default is "MISP e{event_id} [{type}] {value}".
+	MsgTemplate string
+
+	// Classtype of the rules, by default trojan-activity
+	Classtype string
+
+	// Metadata added to every rule, along with the attribute UUID
+	Metadata map[string]string
+
+	// Base URL of the MISP instance. When set, rules reference the event.
+	BaseURL string
+
+	nextSID int
+}
+
+// nidsRule is the header and the specific options of a rule, the options
+// common to all rules being added when it is formatted
+type nidsRule struct {
+	header  string
+	options []string
+}
+
+const defaultNIDSMsgTemplate = "MISP e{event_id} [{type}] {value}"
+
+// nidsSIDRegexp matches the sid and rev options of the rules of snort
+// attributes
+var nidsSIDRegexp = regexp.MustCompile(`\s*\b(sid|rev)\s*:\s*\d+\s*;`)
+
+// nidsContinuationRegexp matches the line continuations of snort rules
+var nidsContinuationRegexp = regexp.MustCompile(`\s*\\\r?\n\s*`)
+
+// EventRules returns the rules of the attributes of the event flagged for
+// IDS, including those of its objects
+func (g *NIDSGenerator) EventRules(event *Event) ([]string, error) {
+	var rules []string
+	add := func(attr *Attribute) error {
+		attrRules, err := g.rules(attr, event)
+		rules = append(rules, attrRules...)
+		return err
+	}
+
+	for i := range event.Attribute {
+		if err := add(&event.Attribute[i]); err != nil {
+			return rules, err
+		}
+	}
+	for _, object := range event.Objects {
+		if object.Deleted {
+			continue
+		}
+		for i := range object.Attributes {
+			if err := add(&object.Attributes[i]); err != nil {
+				return rules, err
+			}
+		}
+	}
+
+	return rules, nil
+}
+
+// Rules returns the rules of the attributes flagged for IDS, such as
+// SearchAttribute results. The event info is not known and is left empty in
+// messages.
+func (g *NIDSGenerator) Rules(attrs []Attribute) ([]string, error) {
+	var rules []string
+	for i := range attrs {
+		attrRules, err := g.rules(&attrs[i], &Event{ID: attrs[i].EventID})
+		rules = append(rules, attrRules...)
+		if err != nil {
+			return rules, err
+		}
+	}
+	return rules, nil
+}
+
+func (g *NIDSGenerator) rules(attr *Attribute, event *Event) ([]string, error) {
+	if !attr.ToIDS || attr.Deleted {
+		return nil, nil
+	}
+
+	suricata := g.Format != NIDSFormatSnort
+	value := strings.TrimSpace(attr.Value)
+
+	var rules []nidsRule
+
+	switch attr.Type {
+	case TypeIPDst, TypeIPSrc, TypeIPDstPort, TypeIPSrcPort:
+		protocol, ip, port := "ip", value, "any"
+		if attr.Type == TypeIPDstPort || attr.Type == TypeIPSrcPort {
+			parts, err := attr.Composite()
+			if err != nil {
+				return nil, nil
+			}
+			number, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+			if err != nil || number < 1 || number > 65535 {
+				return nil, nil
+			}
+			protocol, ip, port = "tcp", parts[0], strconv.Itoa(number)
+		}
+
+		// The address goes in the rule header, where anything else than an
+		// address or network would change the meaning of the rule
+		network, err := parseNetwork(strings.TrimSpace(ip))
+		if err != nil {
+			return nil, nil
+		}
+		ip = network.String()
+		if ones, bits := network.Mask.Size(); ones == bits {
+			ip = network.IP.String()
+		}
+		header := fmt.Sprintf("%s $HOME_NET any -> %s %s", protocol, ip, port)
+		if attr.Type == TypeIPSrc || attr.Type == TypeIPSrcPort {
+			header = fmt.Sprintf("%s %s %s -> $HOME_NET any", protocol, ip, port)
+		}
+		rules = append(rules, nidsRule{header, nil})
+
+	case TypeDomain, TypeHostname:
+		domain := strings.ToLower(strings.TrimSuffix(value, "."))
+		if suricata {
+			options := []string{"dns.query", "content:" + nidsContent(domain), "nocase", fmt.Sprintf("bsize:%d", len(domain))}
+			if attr.Type == TypeDomain {
+				// Match the domain and its subdomains
+				options = []string{"dns.query", "dotprefix", "content:" + nidsContent("."+domain), "nocase", "endswith"}
+			}
+			rules = append(rules, nidsRule{"dns $HOME_NET any -> any any", options})
+		} else {
+			rules = append(rules, nidsRule{"udp $HOME_NET any -> any 53", []string{
+				`content:"|01 00 00 01 00 00 00 00 00 00|"`, "depth:10", "offset:2",
+				"content:" + nidsDNSLabels(domain), "fast_pattern", "nocase",
+			}})
+		}
+		if attr.Type == TypeHostname {
+			rules = append(rules, g.hostRule(domain))
+		}
+
+	case TypeURL:
+		u, err := url.Parse(value)
+		if err != nil || u.Host == "" {
+			return nil, nil
+		}
+		uri := u.RequestURI()
+		var r nidsRule
+		if suricata {
+			r = nidsRule{"http $HOME_NET any -> $EXTERNAL_NET any", []string{
+				"flow:to_server,established", "http.host", "content:" + nidsContent(strings.ToLower(u.Hostname())), "nocase",
+			}}
+			if uri != "/" {
+				r.options = append(r.options, "http.uri", "content:"+nidsContent(uri))
+			}
+		} else {
+			r = nidsRule{"tcp $HOME_NET any -> $EXTERNAL_NET $HTTP_PORTS", []string{
+				"flow:to_server,established", "content:" + nidsContent("Host: "+strings.ToLower(u.Hostname())), "http_header", "nocase",
+			}}
+			if uri != "/" {
+				r.options = append(r.options, "content:"+nidsContent(uri), "http_uri")
+			}
+		}
+		rules = append(rules, r)
+
+	case TypeUserAgent:
+		if suricata {
+			rules = append(rules, nidsRule{"http $HOME_NET any -> $EXTERNAL_NET any", []string{
+				"flow:to_server,established", "http.user_agent", "content:" + nidsContent(value), fmt.Sprintf("bsize:%d", len(value)),
+			}})
+		} else {
+			rules = append(rules, nidsRule{"tcp $HOME_NET any -> $EXTERNAL_NET $HTTP_PORTS", []string{
+				"flow:to_server,established", "content:" + nidsContent("User-Agent: "+value+"\r\n"), "http_header",
+			}})
+		}
+
+	case TypeJA3FingerprintMD5:
+		if !suricata {
+			return nil, nil
+		}
+		rules = append(rules, nidsRule{"tls $HOME_NET any -> $EXTERNAL_NET any", []string{
+			"ja3.hash", "content:" + nidsContent(strings.ToLower(value)),
+		}})
+
+	case TypeSnort:
+		// The value may hold several rules, one per line, each getting its
+		// own sid
+		var result []string
+		for _, line := range strings.Split(nidsContinuationRegexp.ReplaceAllString(value, " "), "\n") {
+			body := nidsSIDRegexp.ReplaceAllString(strings.TrimSpace(line), "")
+			end := strings.LastIndex(body, ")")
+			if end < 0 || strings.HasPrefix(body, "#") {
+				continue
+			}
+			options := strings.TrimSpace(body[:end])
+			if !strings.HasSuffix(options, ";") && !strings.HasSuffix(options, "(") {
+				options += ";"
+			}
+			if !strings.Contains(options, "msg:") && !strings.Contains(options, "msg :") {
+				options += fmt.Sprintf(" msg:%s;", g.msg(attr, event))
+			}
+
+			sid, err := g.allocSID()
+			if err != nil {
+				return result, err
+			}
+			result = append(result, fmt.Sprintf("%s sid:%d; rev:1;)", options, sid))
+		}
+		return result, nil
+
+	default:
+		return nil, nil
+	}
+
+	result := make([]string, 0, len(rules))
+	for _, r := range rules {
+		sid, err := g.allocSID()
+		if err != nil {
+			return result, err
+		}
+
+		options := append([]string{"msg:" + g.msg(attr, event)}, r.options...)
+		options = append(options, "classtype:"+defaultString(g.Classtype, "trojan-activity"))
+		if g.BaseURL != "" && event.ID != "" {
+			reference := strings.TrimPrefix(strings.TrimPrefix(strings.TrimSuffix(g.BaseURL, "/"), "https://"), "http://")
+			options = append(options, fmt.Sprintf("reference:url,%s/events/view/%s", reference, event.ID))
+		}
+		options = append(options, fmt.Sprintf("sid:%d", sid), "rev:1")
+		if metadata := g.metadata(attr); metadata != "" {
+			options = append(options, "metadata:"+metadata)
+		}
+
+		result = append(result, fmt.Sprintf("alert %s (%s;)", r.header, strings.Join(options, "; ")))
+	}
+
+	return result, nil
+}
+
+// hostRule matches the HTTP requests to a host
+func (g *NIDSGenerator) hostRule(host string) nidsRule {
+	if g.Format != NIDSFormatSnort {
+		return nidsRule{"http $HOME_NET any -> $EXTERNAL_NET any", []string{
+			"flow:to_server,established", "http.host", "content:" + nidsContent(host), "nocase", fmt.Sprintf("bsize:%d", len(host)),
+		}}
+	}
+	return nidsRule{"tcp $HOME_NET any -> $EXTERNAL_NET $HTTP_PORTS", []string{
+		"flow:to_server,established", "content:" + nidsContent("Host: "+host), "http_header", "nocase",
+	}}
+}
+
+func (g *NIDSGenerator) allocSID() (int, error) {
+	if g.nextSID == 0 {
+		g.nextSID = g.SIDStart
+		if g.nextSID == 0 {
+			g.nextSID = 1000000
+		}
+	}
+	if g.SIDEnd != 0 && g.nextSID > g.SIDEnd {
+		return 0, fmt.Errorf("SID range exhausted at %d", g.SIDEnd)
+	}
+	sid := g.nextSID
+	g.nextSID++
+	return sid, nil
+}
+
+// msg returns the quoted msg option of the rules of an attribute
+func (g *NIDSGenerator) msg(attr *Attribute, event *Event) string {
+	msg := strings.NewReplacer(
+		"{event_id}", defaultString(event.ID, attr.EventID),
+		"{event_info}", event.Info,
+		"{type}", attr.Type,
+		"{category}", attr.Category,
+		"{value}", attr.Value,
+		"{uuid}", attr.UUID,
+	).Replace(defaultString(g.MsgTemplate, defaultNIDSMsgTemplate))
+
+	msg = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `;`, `\;`, "\n", " ", "\r", " ").Replace(msg)
+	return `"` + msg + `"`
+}
+
+// metadata returns the metadata option of the rules of an attribute
+func (g *NIDSGenerator) metadata(attr *Attribute) string {
+	keys := make([]string, 0, len(g.Metadata))
+	for key := range g.Metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var entries []string
+	for _, key := range keys {
+		entries = append(entries, nidsMetadataWord(key)+" "+nidsMetadataWord(g.Metadata[key]))
+	}
+	if attr.UUID != "" {
+		entries = append(entries, "misp_uuid "+attr.UUID)
+	}
+	return strings.Join(entries, ", ")
+}
+
+// nidsMetadataWord removes the characters not allowed in metadata keys and
+// values
+func nidsMetadataWord(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ',', ';', '"', ' ', '\t':
+			return '_'
+		}
+		return r
+	}, s)
+}
+
+// nidsContent returns s as the quoted argument of a content option, the
+// characters with a special meaning being escaped in hexadecimal
+func nidsContent(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == '"' || c == ';' || c == '\\' || c == '|' || c < 0x20 || c >= 0x7f {
+			fmt.Fprintf(&b, "|%02X|", c)
+			continue
+		}
+		b.WriteByte(c)
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// nidsDNSLabels returns the quoted content matching a domain name in the
+// wire format of DNS queries, e.g. "|04|evil|03|com|00|"
+func nidsDNSLabels(domain string) string {
+	var b strings.Builder
+	for _, label := range strings.Split(domain, ".") {
+		content := nidsContent(label)
+		fmt.Fprintf(&b, "|%02X|%s", len(label), content[1:len(content)-1])
+	}
+	return `"` + b.String() + `|00|"`
+}
@@ -0,0 +1,129 @@
+package misp
+
+import (
+	"strings"
+	"testing"
+)
+
+func Test_NIDSGenerator(t *testing.T) {
+	event := &Event{
+		ID:   "42",
+		Info: `Phishing "invoice"; wave 2`,
+		Attribute: []Attribute{
+			{UUID: "5a1b1d2e-0c54-4e2b-a1c7-000000000001", Type: TypeIPDst, Value: "203.0.113.7", ToIDS: true},
+			{Type: TypeIPSrcPort, Value: "198.51.100.1|8080", ToIDS: true},
+			{Type: TypeDomain, Value: "evil.com", ToIDS: true},
+			{Type: TypeHostname, Value: "www.evil.com", ToIDS: true},
+			{Type: TypeURL, Value: "http://evil.com/gate.php?id=1", ToIDS: true},
+			{Type: TypeUserAgent, Value: "Mozilla/4.0 (evil; bot)", ToIDS: true},
+			{Type: TypeJA3FingerprintMD5, Value: "E7D705A3286E19EA42F587B344EE6865", ToIDS: true},
+			{Type: TypeSnort, Value: `alert tcp any any -> any any (msg:"custom"; content:"x"; sid:1; rev:3;)`, ToIDS: true},
+			{Type: TypeDomain, Value: "not-for-ids.com"},
+			{Type: TypeComment, Value: "skipped", ToIDS: true},
+		},
+	}
+
+	g := &NIDSGenerator{
+		SIDStart:    5000,
+		MsgTemplate: "MISP e{event_id} {event_info} [{type}]",
+		Metadata:    map[string]string{"source": "misp"},
+		BaseURL:     "https://misp.local/",
+	}
+	rules, err := g.EventRules(event)
+	if err != nil {
+		t.Fatalf("EventRules returned error: %s", err)
+	}
+
+	want := []string{
+		`alert ip $HOME_NET any -> 203.0.113.7 any (msg:"MISP e42 Phishing \"invoice\"\; wave 2 [ip-dst]"; classtype:trojan-activity; reference:url,misp.local/events/view/42; sid:5000; rev:1; metadata:source misp, misp_uuid 5a1b1d2e-0c54-4e2b-a1c7-000000000001;)`,
+		`alert tcp 198.51.100.1 8080 -> $HOME_NET any (`,
+		`alert dns $HOME_NET any -> any any (msg:"MISP e42 Phishing \"invoice\"\; wave 2 [domain]"; dns.query; dotprefix; content:".evil.com"; nocase; endswith; classtype:trojan-activity; reference:url,misp.local/events/view/42; sid:5002; rev:1; metadata:source misp;)`,
+		`dns.query; content:"www.evil.com"; nocase; bsize:12;`,
+		`http.host; content:"www.evil.com"; nocase; bsize:12;`,
+		`http.host; content:"evil.com"; nocase; http.uri; content:"/gate.php?id=1";`,
+		`http.user_agent; content:"Mozilla/4.0 (evil|3B| bot)"; bsize:23;`,
+		`alert tls $HOME_NET any -> $EXTERNAL_NET any (msg:"MISP e42 Phishing \"invoice\"\; wave 2 [ja3-fingerprint-md5]"; ja3.hash; content:"e7d705a3286e19ea42f587b344ee6865";`,
+		`alert tcp any any -> any any (msg:"custom"; content:"x"; sid:5008; rev:1;)`,
+	}
+	if len(rules) != len(want) {
+		t.Fatalf("Expected %d rules, got %d:\n%s", len(want), len(rules), strings.Join(rules, "\n"))
+	}
+	for i, rule := range rules {
+		if !strings.Contains(rule, want[i]) {
+			t.Errorf("Rule %d: expected %s, got %s", i, want[i], rule)
+		}
+	}
+
+	snort := &NIDSGenerator{Format: NIDSFormatSnort, SIDEnd: 1000001}
+	rules, err = snort.Rules([]Attribute{
+		{Type: TypeDomain, Value: "evil.com", ToIDS: true, EventID: "7"},
+		{Type: TypeJA3FingerprintMD5, Value: "e7d705a3286e19ea42f587b344ee6865", ToIDS: true},
+		{Type: TypeHostname, Value: "www.evil.com", ToIDS: true},
+	})
+	if err == nil {
+		t.Errorf("Rules did not report the exhausted SID range")
+	}
+	if len(rules) != 2 || !strings.Contains(rules[0], `msg:"MISP e7 [domain] evil.com"; content:"|01 00 00 01 00 00 00 00 00 00|"; depth:10; offset:2; content:"|04|evil|03|com|00|";`) ||
+		!strings.Contains(rules[1], "sid:1000001;") {
+		t.Errorf("Unexpected Snort rules:\n%s", strings.Join(rules, "\n"))
+	}
+}
+
+func Test_NIDSGenerator_SnortAttribute(t *testing.T) {
+	g := &NIDSGenerator{SIDStart: 100}
+	rules, err := g.Rules([]Attribute{{
+		Type: TypeSnort,
+		Value: "alert tcp any any -> any any (msg:\"first\"; content:\"x\"; sid:1; rev:2;)\r\n" +
+			"# disabled rule\n" +
+			"alert udp any any -> any 53 (msg:\"second\"; \\\n content:\"y\")\n",
+		ToIDS: true,
+	}})
+	if err != nil {
+		t.Fatalf("Rules returned error: %s", err)
+	}
+
+	want := []string{
+		`alert tcp any any -> any any (msg:"first"; content:"x"; sid:100; rev:1;)`,
+		`alert udp any any -> any 53 (msg:"second"; content:"y"; sid:101; rev:1;)`,
+	}
+	if len(rules) != len(want) {
+		t.Fatalf("Expected %d rules, got %d:\n%s", len(want), len(rules), strings.Join(rules, "\n"))
+	}
+	for i, rule := range rules {
+		if rule != want[i] {
+			t.Errorf("Rule %d: expected %s, got %s", i, want[i], rule)
+		}
+	}
+}
+
+func Test_NIDSGenerator_InvalidAddresses(t *testing.T) {
+	g := &NIDSGenerator{}
+	rules, err := g.Rules([]Attribute{
+		{Type: TypeIPDst, Value: "any", ToIDS: true},
+		{Type: TypeIPDst, Value: "203.0.113.7 any -> any any (msg:\"x\"; sid:1;)", ToIDS: true},
+		{Type: TypeIPSrc, Value: "[203.0.113.7]", ToIDS: true},
+		{Type: TypeIPDstPort, Value: "203.0.113.7|any", ToIDS: true},
+		{Type: TypeIPDstPort, Value: "203.0.113.7|0", ToIDS: true},
+		{Type: TypeIPDstPort, Value: "203.0.113.7|65536", ToIDS: true},
+		{Type: TypeIPDstPort, Value: "203.0.113.7|80;", ToIDS: true},
+		{Type: TypeIPDstPort, Value: "203.0.113.7", ToIDS: true},
+		{Type: TypeIPDst, Value: "2001:db8::/32", ToIDS: true},
+		{Type: TypeIPDstPort, Value: "203.0.113.7|443", ToIDS: true},
+	})
+	if err != nil {
+		t.Fatalf("Rules returned error: %s", err)
+	}
+
+	want := []string{
+		"alert ip $HOME_NET any -> 2001:db8::/32 any (",
+		"alert tcp $HOME_NET any -> 203.0.113.7 443 (",
+	}
+	if len(rules) != len(want) {
+		t.Fatalf("Expected %d rules, got %d:\n%s", len(want), len(rules), strings.Join(rules, "\n"))
+	}
+	for i, rule := range rules {
+		if !strings.HasPrefix(rule, want[i]) {
+			t.Errorf("Rule %d: expected %s, got %s", i, want[i], rule)
+		}
+	}
+}
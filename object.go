@@ -0,0 +1,145 @@
+package misp
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+)
+
+// NewObject creates an empty MISP object with a fresh UUID
+func NewObject(name, metaCategory string) *Object {
+	return &Object{
+		Name:         name,
+		MetaCategory: metaCategory,
+		UUID:         newUUID(),
+	}
+}
+
+// AddAttribute appends an attribute to the object under the given object
+// relation and returns a pointer to it, to set its other fields. The pointer
+// is only valid until the next attribute is added, which may move the
+// attributes. Empty values are ignored and nil is returned, so that optional
+// fields can be added unconditionally.
+func (o *Object) AddAttribute(relation, attrType, value string) *Attribute {
+	if value == "" {
+		return nil
+	}
+
+	o.Attributes = append(o.Attributes, Attribute{
+		UUID:           newUUID(),
+		ObjectRelation: relation,
+		Type:           attrType,
+		Value:          value,
+	})
+
+	return &o.Attributes[len(o.Attributes)-1]
+}
+
+// AddReference links this object to the object or attribute identified by
+// referencedUUID
+func (o *Object) AddReference(referencedUUID, relationshipType string) {
+	o.References = append(o.References, ObjectReference{
+		UUID:             newUUID(),
+		ObjectUUID:       o.UUID,
+		ReferencedUUID:   referencedUUID,
+		RelationshipType: relationshipType,
+	})
+}
+
+// GetAttributes returns the attributes of the object stored under the given
+// object relation
+func (o *Object) GetAttributes(relation string) []Attribute {
+	var attrs []Attribute
+	for _, attr := range o.Attributes {
+		if attr.ObjectRelation == relation {
+			attrs = append(attrs, attr)
+		}
+	}
+	return attrs
+}
+
+// newUUID returns a random (version 4) UUID
+func newUUID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(fmt.Sprintf("Could not generate UUID: %s", err))
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// AddObject creates the given object in the event identified by eventID and
+// returns the object as stored by MISP. References are not created, see
+// AddObjectReference and AddObjects.
+func (client *Client) AddObject(eventID string, object *Object) (*Object, error) {
+	type objectType struct {
+		Object Object `json:"Object"`
+	}
+
+	path := fmt.Sprintf("/objects/add/%s", eventID)
+
+	resp, err := client.Post(path, objectType{Object: *object})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result objectType
+	decoder := json.NewDecoder(resp.Body)
+	if err = decoder.Decode(&result); err != nil {
+		return nil, fmt.Errorf("Could not unmarshal object: %s", err)
+	}
+
+	return &result.Object, nil
+}
+
+// AddObjectReference creates a reference between an existing object and
+// another object or attribute
+func (client *Client) AddObjectReference(ref *ObjectReference) (*ObjectReference, error) {
+	type referenceType struct {
+		ObjectReference ObjectReference `json:"ObjectReference"`
+	}
+
+	objectID := ref.ObjectID
+	if objectID == "" {
+		objectID = ref.ObjectUUID
+	}
+	path := fmt.Sprintf("/objectReferences/add/%s", objectID)
+
+	resp, err := client.Post(path, referenceType{ObjectReference: *ref})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result referenceType
+	decoder := json.NewDecoder(resp.Body)
+	if err = decoder.Decode(&result); err != nil {
+		return nil, fmt.Errorf("Could not unmarshal object reference: %s", err)
+	}
+
+	return &result.ObjectReference, nil
+}
+
+// AddObjects creates all the given objects in the event identified by
+// eventID, then their references, so that objects may reference each other
+func (client *Client) AddObjects(eventID string, objects []Object) error {
+	for i := range objects {
+		if _, err := client.AddObject(eventID, &objects[i]); err != nil {
+			return fmt.Errorf("Could not add object %s: %s", objects[i].Name, err)
+		}
+	}
+
+	for _, object := range objects {
+		for _, ref := range object.References {
+			ref.ObjectUUID = object.UUID
+			if _, err := client.AddObjectReference(&ref); err != nil {
+				return fmt.Errorf("Could not add reference from object %s: %s", object.UUID, err)
+			}
+		}
+	}
+
+	return nil
+}
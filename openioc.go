@@ -0,0 +1,425 @@
+package misp
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"time"
+)
+
+const openIOCNamespace = "http://openioc.org/schemas/OpenIOC_1.1"
+
+// openIOC is an OpenIOC document. The OpenIOC 1.0 layout, with an ioc root
+// element and a definition instead of criteria, is accepted when reading.
+type openIOC struct {
+	XMLName       xml.Name
+	Xmlns         string            `xml:"xmlns,attr,omitempty"`
+	ID            string            `xml:"id,attr"`
+	LastModified  string            `xml:"last-modified,attr,omitempty"`
+	PublishedDate string            `xml:"published-date,attr,omitempty"`
+	Metadata      openIOCMetadata   `xml:"metadata"`
+	Criteria      *openIOCIndicator `xml:"criteria>Indicator"`
+
+	// OpenIOC 1.0
+	ShortDescription string            `xml:"short_description,omitempty"`
+	Description      string            `xml:"description,omitempty"`
+	AuthoredBy       string            `xml:"authored_by,omitempty"`
+	AuthoredDate     string            `xml:"authored_date,omitempty"`
+	Definition       *openIOCIndicator `xml:"definition>Indicator"`
+}
+
+type openIOCMetadata struct {
+	ShortDescription string `xml:"short_description"`
+	Description      string `xml:"description,omitempty"`
+	AuthoredBy       string `xml:"authored_by,omitempty"`
+	AuthoredDate     string `xml:"authored_date,omitempty"`
+}
+
+// openIOCIndicator is a group of items and nested groups joined with the AND
+// or OR operator
+type openIOCIndicator struct {
+	ID         string             `xml:"id,attr"`
+	Operator   string             `xml:"operator,attr"`
+	Items      []OpenIOCItem      `xml:"IndicatorItem"`
+	Indicators []openIOCIndicator `xml:"Indicator"`
+}
+
+// OpenIOCItem is a condition of an OpenIOC document on a field of an item,
+// e.g. FileItem/Md5sum is 68b329da9893e34099c7d8ad5cb9c940
+type OpenIOCItem struct {
+	ID           string         `xml:"id,attr"`
+	Condition    string         `xml:"condition,attr"`
+	PreserveCase bool           `xml:"preserve-case,attr"`
+	Negate       bool           `xml:"negate,attr"`
+	Context      OpenIOCContext `xml:"Context"`
+	Content      OpenIOCContent `xml:"Content"`
+}
+
+// OpenIOCContext is the item field an OpenIOC condition applies to
+type OpenIOCContext struct {
+	Document string `xml:"document,attr"`
+	Search   string `xml:"search,attr"`
+	Type     string `xml:"type,attr"`
+}
+
+// OpenIOCContent is the value of an OpenIOC condition
+type OpenIOCContent struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+// openIOCSearch is the MISP equivalent of an OpenIOC search
+type openIOCSearch struct {
+	search      string
+	contentType string
+	attrType    string
+	relation    string
+}
+
+// openIOCSearches maps OpenIOC searches to MISP attribute types and object
+// relations. When several searches have the same type, the first one is used
+// for exports.
+var openIOCSearches = []openIOCSearch{
+	{"FileItem/Md5sum", "md5", TypeMD5, "md5"},
+	{"FileItem/Sha1sum", "sha1", TypeSHA1, "sha1"},
+	{"FileItem/Sha256sum", "sha256", TypeSHA256, "sha256"},
+	{"FileItem/FileName", "string", TypeFilename, "filename"},
+	{"FileItem/FullPath", "string", TypeFilename, "filename"},
+	{"FileItem/SizeInBytes", "int", TypeSizeInBytes, "size-in-bytes"},
+	{"PortItem/remoteIP", "IP", TypeIPDst, "ip-dst"},
+	{"PortItem/localIP", "IP", TypeIPSrc, "ip-src"},
+	{"PortItem/remotePort", "int", TypePort, "dst-port"},
+	{"PortItem/localPort", "int", TypePort, "src-port"},
+	{"RouteEntryItem/Destination", "IP", TypeIPDst, "ip-dst"},
+	{"Network/DNS", "string", TypeDomain, "domain"},
+	{"DnsEntryItem/Host", "string", TypeHostname, "hostname"},
+	{"DnsEntryItem/RecordName", "string", TypeHostname, "hostname"},
+	{"Network/URI", "string", TypeURL, "url"},
+	{"UrlHistoryItem/URL", "string", TypeURL, "url"},
+	{"Network/UserAgent", "string", TypeUserAgent, "user-agent"},
+	{"Email/From", "string", TypeEmailSrc, "from"},
+	{"Email/To", "string", TypeEmailDst, "to"},
+	{"Email/Subject", "string", TypeEmailSubject, "subject"},
+	{"Email/Attachment/Name", "string", TypeEmailAttachment, "attachment"},
+	{"ProcessItem/HandleList/Handle/Name", "string", TypeMutex, "mutex"},
+	{"RegistryItem/Path", "string", TypeRegkey, "key"},
+	{"RegistryItem/KeyPath", "string", TypeRegkey, "key"},
+	{"RegistryItem/Value", "string", TypeText, "data"},
+	{"ServiceItem/name", "string", TypeWindowsServiceName, "name"},
+	{"ServiceItem/descriptiveName", "string", TypeWindowsServiceDisplayName, "display-name"},
+	{"Snort/Snort", "string", TypeSnort, "snort"},
+	{"Yara/Yara", "string", TypeYara, "yara"},
+}
+
+// openIOCComposites maps the relations of two items joined with AND to the
+// composite type holding both values
+var openIOCComposites = map[string]string{
+	"filename|md5":    TypeFilenameMD5,
+	"filename|sha1":   TypeFilenameSHA1,
+	"filename|sha256": TypeFilenameSHA256,
+	"ip-dst|dst-port": TypeIPDstPort,
+	"ip-src|src-port": TypeIPSrcPort,
+	"domain|ip-dst":   TypeDomainIP,
+	"key|data":        TypeRegkeyValue,
+}
+
+// openIOCObjectNames maps OpenIOC documents to the MISP object templates
+// used for groups of items joined with AND
+var openIOCObjectNames = map[string]string{
+	"FileItem":       "file",
+	"RegistryItem":   "registry-key",
+	"Email":          "email",
+	"PortItem":       "ip-port",
+	"RouteEntryItem": "ip-port",
+	"Network":        "domain-ip",
+	"DnsEntryItem":   "domain-ip",
+	"UrlHistoryItem": "url",
+	"ServiceItem":    "windows-service",
+}
+
+// openIOCObjectName returns the MISP object template of an OpenIOC document
+func openIOCObjectName(document string) string {
+	if name, ok := openIOCObjectNames[document]; ok {
+		return name
+	}
+	return strings.ToLower(document)
+}
+
+func lookupOpenIOCSearch(search string) (openIOCSearch, bool) {
+	for _, s := range openIOCSearches {
+		if strings.EqualFold(s.search, search) {
+			return s, true
+		}
+	}
+	return openIOCSearch{}, false
+}
+
+// ReadOpenIOC converts an OpenIOC 1.1 (or 1.0) document to an event. Items
+// of OR groups become attributes flagged for IDS. Groups of two items joined
+// with AND which MISP expresses as a composite type, like a file name and its
+// MD5, become composite attributes, other AND groups become objects.
+//
+// Items with unknown searches, negated items and items with other conditions
+// than "is" are returned along with the event.
+func ReadOpenIOC(r io.Reader) (*Event, []OpenIOCItem, error) {
+	var ioc openIOC
+	decoder := xml.NewDecoder(r)
+	decoder.CharsetReader = openIOCCharsetReader
+	if err := decoder.Decode(&ioc); err != nil {
+		return nil, nil, fmt.Errorf("Could not unmarshal OpenIOC: %s", err)
+	}
+
+	metadata := ioc.Metadata
+	if metadata.ShortDescription == "" {
+		metadata = openIOCMetadata{ioc.ShortDescription, ioc.Description, ioc.AuthoredBy, ioc.AuthoredDate}
+	}
+	criteria := ioc.Criteria
+	if criteria == nil {
+		criteria = ioc.Definition
+	}
+	if criteria == nil {
+		return nil, nil, fmt.Errorf("OpenIOC document %q has no criteria", ioc.ID)
+	}
+
+	event := &Event{
+		UUID: ioc.ID,
+		Info: metadata.ShortDescription,
+		Date: time.Now().UTC().Format("2006-01-02"),
+	}
+	if !uuidRegexp.MatchString(event.UUID) {
+		event.UUID = newUUID()
+	}
+	if event.Info == "" {
+		event.Info = metadata.Description
+	}
+	if metadata.AuthoredBy != "" {
+		event.Orgc = Org{Name: metadata.AuthoredBy}
+	}
+	for _, date := range []string{metadata.AuthoredDate, ioc.LastModified} {
+		if t, err := time.Parse("2006-01-02T15:04:05", strings.TrimSuffix(date, "Z")); err == nil {
+			event.Date = t.Format("2006-01-02")
+			break
+		}
+	}
+
+	var unmapped []OpenIOCItem
+	readOpenIOCIndicator(event, criteria, &unmapped)
+
+	return event, unmapped, nil
+}
+
+// openIOCCharsetReader decodes the ASCII and Latin-1 documents written by
+// the Mandiant IOC editor
+func openIOCCharsetReader(charset string, input io.Reader) (io.Reader, error) {
+	switch strings.ToLower(charset) {
+	case "us-ascii", "ascii", "utf-8":
+		return input, nil
+	case "iso-8859-1", "latin1", "windows-1252":
+		data, err := ioutil.ReadAll(input)
+		if err != nil {
+			return nil, err
+		}
+		runes := make([]rune, len(data))
+		for i, b := range data {
+			runes[i] = rune(b)
+		}
+		return strings.NewReader(string(runes)), nil
+	}
+	return nil, fmt.Errorf("Unsupported charset %q", charset)
+}
+
+func readOpenIOCIndicator(event *Event, indicator *openIOCIndicator, unmapped *[]OpenIOCItem) {
+	var items []OpenIOCItem
+	var searches []openIOCSearch
+	for _, item := range indicator.Items {
+		search, ok := lookupOpenIOCSearch(item.Context.Search)
+		if !ok || item.Negate || !strings.EqualFold(item.Condition, "is") {
+			*unmapped = append(*unmapped, item)
+			continue
+		}
+		items = append(items, item)
+		searches = append(searches, search)
+	}
+
+	newAttribute := func(item OpenIOCItem, attrType, value string) Attribute {
+		attr := Attribute{
+			UUID:  item.ID,
+			Type:  attrType,
+			Value: value,
+		}
+		if !uuidRegexp.MatchString(attr.UUID) {
+			attr.UUID = newUUID()
+		}
+		DefaultDescribeTypes.ApplyDefaults(&attr)
+		attr.ToIDS = true
+		return attr
+	}
+
+	switch {
+	case len(items) == 0:
+	case !strings.EqualFold(indicator.Operator, "AND") || len(items) == 1:
+		for i, item := range items {
+			event.Attribute = append(event.Attribute, newAttribute(item, searches[i].attrType, strings.TrimSpace(item.Content.Value)))
+		}
+	case len(items) == 2 && openIOCComposites[searches[0].relation+"|"+searches[1].relation] != "":
+		value := strings.TrimSpace(items[0].Content.Value) + "|" + strings.TrimSpace(items[1].Content.Value)
+		event.Attribute = append(event.Attribute, newAttribute(items[0], openIOCComposites[searches[0].relation+"|"+searches[1].relation], value))
+	default:
+		object := NewObject(openIOCObjectName(strings.SplitN(searches[0].search, "/", 2)[0]), "")
+		if uuidRegexp.MatchString(indicator.ID) {
+			object.UUID = indicator.ID
+		}
+		for i, item := range items {
+			if attr := object.AddAttribute(searches[i].relation, searches[i].attrType, strings.TrimSpace(item.Content.Value)); attr != nil {
+				DefaultDescribeTypes.ApplyDefaults(attr)
+				attr.ToIDS = true
+			}
+		}
+		event.Objects = append(event.Objects, *object)
+	}
+
+	for i := range indicator.Indicators {
+		readOpenIOCIndicator(event, &indicator.Indicators[i], unmapped)
+	}
+}
+
+// WriteOpenIOC encodes the attributes of an event flagged for IDS as an
+// OpenIOC 1.1 document. Attributes become items of the top-level OR group,
+// composite attributes and objects groups of items joined with AND.
+// Attributes of types without OpenIOC equivalent are left out, as are objects
+// with such an attribute flagged for IDS, since the group would match more
+// than the object describes.
+func WriteOpenIOC(w io.Writer, event *Event) error {
+	criteria := &openIOCIndicator{ID: newUUID(), Operator: "OR"}
+
+	for i := range event.Attribute {
+		attr := &event.Attribute[i]
+		if !attr.ToIDS || attr.Deleted {
+			continue
+		}
+
+		if parts, err := attr.Composite(); err == nil {
+			group := openIOCIndicator{ID: newUUID(), Operator: "AND"}
+			for relations, compositeType := range openIOCComposites {
+				if compositeType != attr.Type {
+					continue
+				}
+				for j, relation := range strings.Split(relations, "|") {
+					if item, ok := openIOCRelationItem("", relation, parts[j]); ok {
+						group.Items = append(group.Items, item)
+					}
+				}
+			}
+			if len(group.Items) == 2 {
+				group.Items[0].ID = attr.UUID
+				criteria.Indicators = append(criteria.Indicators, group)
+			}
+			continue
+		}
+
+		if item, ok := openIOCTypeItem(attr.Type, attr.Value); ok {
+			item.ID = attr.UUID
+			criteria.Items = append(criteria.Items, item)
+		}
+	}
+
+	for _, object := range event.Objects {
+		if object.Deleted {
+			continue
+		}
+		group := openIOCIndicator{ID: object.UUID, Operator: "AND"}
+		complete := true
+		for _, attr := range object.Attributes {
+			if !attr.ToIDS || attr.Deleted {
+				continue
+			}
+			item, ok := openIOCRelationItem(object.Name, attr.ObjectRelation, attr.Value)
+			if !ok {
+				item, ok = openIOCTypeItem(attr.Type, attr.Value)
+			}
+			if !ok {
+				complete = false
+				break
+			}
+			item.ID = attr.UUID
+			group.Items = append(group.Items, item)
+		}
+		if complete && len(group.Items) > 0 {
+			criteria.Indicators = append(criteria.Indicators, group)
+		}
+	}
+
+	modified := time.Now().UTC().Format("2006-01-02T15:04:05")
+	ioc := openIOC{
+		XMLName:      xml.Name{Local: "OpenIOC"},
+		Xmlns:        openIOCNamespace,
+		ID:           event.UUID,
+		LastModified: modified,
+		Metadata: openIOCMetadata{
+			ShortDescription: event.Info,
+			AuthoredBy:       event.Orgc.Name,
+		},
+		Criteria: criteria,
+	}
+	if event.Date != "" {
+		ioc.Metadata.AuthoredDate = event.Date + "T00:00:00"
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return fmt.Errorf("Could not write OpenIOC: %s", err)
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(ioc); err != nil {
+		return fmt.Errorf("Could not marshal OpenIOC: %s", err)
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// openIOCTypeItem returns the item matching a value of the given attribute
+// type, using the first search with this type
+func openIOCTypeItem(attrType, value string) (OpenIOCItem, bool) {
+	// Ports and free text have no meaning on their own
+	if attrType == TypePort || attrType == TypeText {
+		return OpenIOCItem{}, false
+	}
+	for _, search := range openIOCSearches {
+		if search.attrType == attrType {
+			return newOpenIOCItem(search, value), true
+		}
+	}
+	return OpenIOCItem{}, false
+}
+
+// openIOCRelationItem returns the item matching a value stored under the
+// given relation of an object of the template name, or of a composite
+// attribute if name is empty. Relations only have a meaning within their
+// template: the subject of an x509 object is not an email subject.
+func openIOCRelationItem(name, relation, value string) (OpenIOCItem, bool) {
+	for _, search := range openIOCSearches {
+		if search.relation != relation {
+			continue
+		}
+		if name != "" && openIOCObjectName(strings.SplitN(search.search, "/", 2)[0]) != name {
+			continue
+		}
+		return newOpenIOCItem(search, value), true
+	}
+	return OpenIOCItem{}, false
+}
+
+func newOpenIOCItem(search openIOCSearch, value string) OpenIOCItem {
+	return OpenIOCItem{
+		ID:        newUUID(),
+		Condition: "is",
+		Context: OpenIOCContext{
+			Document: strings.SplitN(search.search, "/", 2)[0],
+			Search:   search.search,
+			Type:     "mir",
+		},
+		Content: OpenIOCContent{Type: search.contentType, Value: value},
+	}
+}
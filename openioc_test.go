@@ -0,0 +1,156 @@
+package misp
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+const testOpenIOC = `<?xml version="1.0" encoding="us-ascii"?>
+<OpenIOC xmlns="http://openioc.org/schemas/OpenIOC_1.1" id="2e693d07-5b94-4b47-b4a5-ba0a9e1b8a1c" last-modified="2017-03-02T10:00:00">
+  <metadata>
+    <short_description>Invoice dropper</short_description>
+    <authored_by>IR vendor</authored_by>
+    <authored_date>2017-03-01T09:00:00</authored_date>
+  </metadata>
+  <criteria>
+    <Indicator id="1b1c5bd8-1d6b-4d2c-9b6e-1a2b3c4d5e00" operator="OR">
+      <IndicatorItem id="1b1c5bd8-1d6b-4d2c-9b6e-1a2b3c4d5e01" condition="is">
+        <Context document="Network" search="Network/DNS" type="mir" />
+        <Content type="string">evil.com</Content>
+      </IndicatorItem>
+      <IndicatorItem id="1b1c5bd8-1d6b-4d2c-9b6e-1a2b3c4d5e02" condition="is" negate="true">
+        <Context document="PortItem" search="PortItem/remoteIP" type="mir" />
+        <Content type="IP">10.0.0.1</Content>
+      </IndicatorItem>
+      <IndicatorItem id="1b1c5bd8-1d6b-4d2c-9b6e-1a2b3c4d5e03" condition="contains">
+        <Context document="ProcessItem" search="ProcessItem/path" type="mir" />
+        <Content type="string">temp</Content>
+      </IndicatorItem>
+      <Indicator id="1b1c5bd8-1d6b-4d2c-9b6e-1a2b3c4d5e04" operator="AND">
+        <IndicatorItem id="1b1c5bd8-1d6b-4d2c-9b6e-1a2b3c4d5e05" condition="is">
+          <Context document="FileItem" search="FileItem/FileName" type="mir" />
+          <Content type="string">invoice.exe</Content>
+        </IndicatorItem>
+        <IndicatorItem id="1b1c5bd8-1d6b-4d2c-9b6e-1a2b3c4d5e06" condition="is">
+          <Context document="FileItem" search="FileItem/Md5sum" type="mir" />
+          <Content type="md5">68b329da9893e34099c7d8ad5cb9c940</Content>
+        </IndicatorItem>
+      </Indicator>
+      <Indicator id="1b1c5bd8-1d6b-4d2c-9b6e-1a2b3c4d5e07" operator="AND">
+        <IndicatorItem id="1b1c5bd8-1d6b-4d2c-9b6e-1a2b3c4d5e08" condition="is">
+          <Context document="FileItem" search="FileItem/FileName" type="mir" />
+          <Content type="string">payload.dll</Content>
+        </IndicatorItem>
+        <IndicatorItem id="1b1c5bd8-1d6b-4d2c-9b6e-1a2b3c4d5e09" condition="is">
+          <Context document="FileItem" search="FileItem/SizeInBytes" type="mir" />
+          <Content type="int">4096</Content>
+        </IndicatorItem>
+        <IndicatorItem id="1b1c5bd8-1d6b-4d2c-9b6e-1a2b3c4d5e10" condition="is">
+          <Context document="FileItem" search="FileItem/Sha1sum" type="mir" />
+          <Content type="sha1">da39a3ee5e6b4b0d3255bfef95601890afd80709</Content>
+        </IndicatorItem>
+      </Indicator>
+    </Indicator>
+  </criteria>
+  <parameters />
+</OpenIOC>`
+
+func checkOpenIOCEvent(t *testing.T, event *Event) {
+	if len(event.Attribute) != 2 {
+		t.Fatalf("Expected 2 attributes, got %+v", event.Attribute)
+	}
+	if attr := event.Attribute[0]; attr.Type != TypeDomain || attr.Value != "evil.com" || !attr.ToIDS || attr.Category != CategoryNetworkActivity {
+		t.Errorf("Unexpected attribute %+v", attr)
+	}
+	if attr := event.Attribute[1]; attr.Type != TypeFilenameMD5 || attr.Value != "invoice.exe|68b329da9893e34099c7d8ad5cb9c940" {
+		t.Errorf("Unexpected attribute %+v", attr)
+	}
+
+	if len(event.Objects) != 1 {
+		t.Fatalf("Expected 1 object, got %+v", event.Objects)
+	}
+	object := event.Objects[0]
+	if object.Name != "file" || object.UUID != "1b1c5bd8-1d6b-4d2c-9b6e-1a2b3c4d5e07" || len(object.Attributes) != 3 {
+		t.Errorf("Unexpected object %+v", object)
+	}
+	if sizes := object.GetAttributes("size-in-bytes"); len(sizes) != 1 || sizes[0].Value != "4096" {
+		t.Errorf("Unexpected object attributes %+v", object.Attributes)
+	}
+}
+
+func Test_ReadOpenIOC(t *testing.T) {
+	event, unmapped, err := ReadOpenIOC(strings.NewReader(testOpenIOC))
+	if err != nil {
+		t.Fatalf("ReadOpenIOC returned error: %s", err)
+	}
+
+	if event.UUID != "2e693d07-5b94-4b47-b4a5-ba0a9e1b8a1c" || event.Info != "Invoice dropper" ||
+		event.Date != "2017-03-01" || event.Orgc.Name != "IR vendor" {
+		t.Errorf("Unexpected event %+v", event)
+	}
+	if len(unmapped) != 2 || unmapped[0].Context.Search != "PortItem/remoteIP" || unmapped[1].Context.Search != "ProcessItem/path" {
+		t.Errorf("Unexpected unmapped items %+v", unmapped)
+	}
+	checkOpenIOCEvent(t, event)
+}
+
+func Test_WriteOpenIOC(t *testing.T) {
+	event, _, err := ReadOpenIOC(strings.NewReader(testOpenIOC))
+	if err != nil {
+		t.Fatalf("ReadOpenIOC returned error: %s", err)
+	}
+	event.Attribute = append(event.Attribute, Attribute{Type: TypeComment, Value: "not exported", ToIDS: true})
+
+	var buf bytes.Buffer
+	if err = WriteOpenIOC(&buf, event); err != nil {
+		t.Fatalf("WriteOpenIOC returned error: %s", err)
+	}
+	if !strings.Contains(buf.String(), `<OpenIOC xmlns="http://openioc.org/schemas/OpenIOC_1.1"`) {
+		t.Errorf("Missing OpenIOC 1.1 namespace:\n%s", buf.String())
+	}
+
+	again, unmapped, err := ReadOpenIOC(&buf)
+	if err != nil {
+		t.Fatalf("ReadOpenIOC returned error on exported document: %s", err)
+	}
+	if len(unmapped) != 0 || again.Info != event.Info {
+		t.Errorf("Unexpected round trip %+v, %+v", again, unmapped)
+	}
+	checkOpenIOCEvent(t, again)
+}
+
+func Test_WriteOpenIOCObjects(t *testing.T) {
+	event := &Event{
+		UUID: "5a1b1d2e-0c54-4e2b-a1c7-000000000030",
+		Info: "Objects",
+		Objects: []Object{
+			{Name: "x509", UUID: "5a1b1d2e-0c54-4e2b-a1c7-000000000031", Attributes: []Attribute{
+				{ObjectRelation: "subject", Type: TypeText, Value: "CN=evil.com", ToIDS: true},
+			}},
+			{Name: "file", UUID: "5a1b1d2e-0c54-4e2b-a1c7-000000000032", Attributes: []Attribute{
+				{ObjectRelation: "md5", Type: TypeMD5, Value: "68b329da9893e34099c7d8ad5cb9c940", ToIDS: true},
+				{ObjectRelation: "entropy", Type: TypeFloat, Value: "7.9", ToIDS: true},
+			}},
+			{Name: "email", UUID: "5a1b1d2e-0c54-4e2b-a1c7-000000000033", Attributes: []Attribute{
+				{ObjectRelation: "subject", Type: TypeEmailSubject, Value: "Invoice", ToIDS: true},
+				{ObjectRelation: "from", Type: TypeEmailSrc, Value: "evil@evil.com", ToIDS: true},
+			}},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := WriteOpenIOC(&buf, event); err != nil {
+		t.Fatalf("WriteOpenIOC returned error: %s", err)
+	}
+	out := buf.String()
+
+	for _, unexpected := range []string{"CN=evil.com", "68b329da9893e34099c7d8ad5cb9c940", "authored_date"} {
+		if strings.Contains(out, unexpected) {
+			t.Errorf("Unexpected %q in:\n%s", unexpected, out)
+		}
+	}
+	if strings.Count(out, `search="Email/Subject"`) != 1 || !strings.Contains(out, `search="Email/From"`) {
+		t.Errorf("Email object not exported:\n%s", out)
+	}
+}
@@ -0,0 +1,139 @@
+package misp
+
+import (
+	"bufio"
+	_ "embed" // bundled public suffix list
+	"fmt"
+	"io"
+	"strings"
+)
+
+//go:embed data/public_suffix_list.dat
+var bundledPublicSuffixList string
+
+// DefaultPublicSuffixList is the public suffix list used by the object
+// generators and indicator extraction. It is initialized from a bundled copy
+// of the complete Public Suffix List, version 2023-02-09 (Debian package
+// publicsuffix 20230209.2326-1), and can be replaced by a newer one with
+// ParsePublicSuffixList.
+var DefaultPublicSuffixList *PublicSuffixList
+
+func init() {
+	var err error
+	DefaultPublicSuffixList, err = ParsePublicSuffixList(strings.NewReader(bundledPublicSuffixList))
+	if err != nil {
+		panic(err)
+	}
+}
+
+// PublicSuffixList is a set of public suffix rules, as published on
+// https://publicsuffix.org/list/public_suffix_list.dat
+type PublicSuffixList struct {
+	rules      map[string]bool
+	wildcards  map[string]bool // "*.foo.bar" rules, indexed by "foo.bar"
+	exceptions map[string]bool // "!foo.bar" rules, indexed by "foo.bar"
+}
+
+// ParsePublicSuffixList reads a list in the Public Suffix List format
+func ParsePublicSuffixList(r io.Reader) (*PublicSuffixList, error) {
+	list := &PublicSuffixList{
+		rules:      make(map[string]bool),
+		wildcards:  make(map[string]bool),
+		exceptions: make(map[string]bool),
+	}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		// Rules stop at the first whitespace
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "//") {
+			continue
+		}
+
+		rule := strings.ToLower(fields[0])
+		switch {
+		case strings.HasPrefix(rule, "!"):
+			list.exceptions[rule[1:]] = true
+		case strings.HasPrefix(rule, "*."):
+			list.wildcards[rule[2:]] = true
+		default:
+			list.rules[rule] = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("Error reading public suffix list: %s", err)
+	}
+
+	return list, nil
+}
+
+// PublicSuffix returns the public suffix of domain, i.e. its effective TLD.
+// Domains that match no rule fall back on their last label.
+func (l *PublicSuffixList) PublicSuffix(domain string) string {
+	domain = strings.TrimSuffix(strings.ToLower(domain), ".")
+	labels := strings.Split(domain, ".")
+
+	// Exception rules take precedence over any other rule
+	for i := range labels {
+		if l.exceptions[strings.Join(labels[i:], ".")] {
+			return strings.Join(labels[i+1:], ".")
+		}
+	}
+
+	// Otherwise the longest matching rule wins, starting with the longest candidate
+	for i := range labels {
+		candidate := strings.Join(labels[i:], ".")
+		if i > 0 && l.wildcards[candidate] {
+			return strings.Join(labels[i-1:], ".")
+		}
+		if l.rules[candidate] {
+			return candidate
+		}
+	}
+
+	return labels[len(labels)-1]
+}
+
+// IsListed tells whether the public suffix of domain is matched by a rule of
+// the list, rather than by the fallback on its last label
+func (l *PublicSuffixList) IsListed(domain string) bool {
+	suffix := l.PublicSuffix(domain)
+	if l.rules[suffix] || l.wildcards[suffix] {
+		return true
+	}
+
+	// Wildcard rules match one more label than they list, exception rules one
+	// label less, hence the check of wildcards above
+	if i := strings.Index(suffix, "."); i >= 0 {
+		return l.wildcards[suffix[i+1:]]
+	}
+	return false
+}
+
+// SplitDomain splits domain into its subdomain, the registered label just
+// left of the public suffix, and the public suffix itself. For
+// "www.evil.co.uk" it returns "www", "evil" and "co.uk".
+func (l *PublicSuffixList) SplitDomain(domain string) (subdomain, label, suffix string) {
+	domain = strings.TrimSuffix(strings.ToLower(domain), ".")
+	suffix = l.PublicSuffix(domain)
+	if domain == suffix {
+		return "", "", suffix
+	}
+
+	rest := strings.Split(strings.TrimSuffix(domain, "."+suffix), ".")
+	label = rest[len(rest)-1]
+	subdomain = strings.Join(rest[:len(rest)-1], ".")
+
+	return subdomain, label, suffix
+}
+
+// RegisteredDomain returns the public suffix of domain plus one label, e.g.
+// "evil.co.uk" for "www.evil.co.uk". It returns an empty string when domain
+// is itself a public suffix.
+func (l *PublicSuffixList) RegisteredDomain(domain string) string {
+	_, label, suffix := l.SplitDomain(domain)
+	if label == "" {
+		return ""
+	}
+	return label + "." + suffix
+}
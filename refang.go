@@ -0,0 +1,180 @@
+package misp
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+)
+
+var (
+	refangSchemeRegexp = regexp.MustCompile(`(?i)\b(h(?:xx|\*\*|\[tt\]|tt)p|f(?:x|\[t\])p)(s?)(\[://\]|\[:\]//|://)`)
+	refangDotRegexp    = regexp.MustCompile(`(?i)\s*(?:\[\.\]|\[dot\])\s*|\(\.\)|\{\.\}|\(dot\)|\{dot\}`)
+	refangAtRegexp     = regexp.MustCompile(`(?i)\s*(?:\[@\]|\[at\])\s*|\(@\)|\{@\}|\(at\)|\{at\}`)
+	refangSlashRegexp  = regexp.MustCompile(`\[/\]`)
+)
+
+// Refang restores indicators defanged in reports, e.g. "hxxp://evil[.]com" or
+// "user[@]example[.]com", into their original form. Dots and at signs are only
+// restored between characters of host names or email local parts, and only
+// the square bracket forms may be surrounded by spaces, so that text such as
+// "meet (at) noon" is left alone.
+func Refang(value string) string {
+	value = refangSchemeRegexp.ReplaceAllStringFunc(value, func(match string) string {
+		parts := refangSchemeRegexp.FindStringSubmatch(match)
+		scheme := "http"
+		if strings.HasPrefix(strings.ToLower(parts[1]), "f") {
+			scheme = "ftp"
+		}
+		return scheme + strings.ToLower(parts[2]) + "://"
+	})
+	value = refangSeparator(value, refangDotRegexp, ".")
+	value = refangSeparator(value, refangAtRegexp, "@")
+	value = refangSlashRegexp.ReplaceAllString(value, "/")
+
+	return value
+}
+
+// refangSeparator replaces the matches of re with sep when they sit between
+// two characters of a host name or of the local part of an email address
+func refangSeparator(value string, re *regexp.Regexp, sep string) string {
+	var result strings.Builder
+	last := 0
+	for _, match := range re.FindAllStringIndex(value, -1) {
+		if match[0] == 0 || match[1] == len(value) || !isRefangChar(value[match[0]-1]) || !isRefangChar(value[match[1]]) {
+			continue
+		}
+		result.WriteString(value[last:match[0]])
+		result.WriteString(sep)
+		last = match[1]
+	}
+	result.WriteString(value[last:])
+
+	return result.String()
+}
+
+func isRefangChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+		c == '-' || c == '_' || c == '+' || c == '%' || c >= 0x80
+}
+
+// Defang neutralizes an indicator so that it is not clickable once pasted in
+// a report: schemes become hxxp or fxp, and dots and at signs are bracketed.
+// Only the host part of URLs is defanged.
+func Defang(value string) string {
+	if i := strings.Index(value, "://"); i >= 0 {
+		scheme, rest := value[:i], value[i+3:]
+		switch strings.ToLower(scheme) {
+		case "http":
+			scheme = "hxxp"
+		case "https":
+			scheme = "hxxps"
+		case "ftp":
+			scheme = "fxp"
+		}
+
+		host, path := rest, ""
+		if j := strings.IndexAny(rest, "/?#"); j >= 0 {
+			host, path = rest[:j], rest[j:]
+		}
+		return scheme + "[://]" + defangHost(host) + path
+	}
+
+	return defangHost(value)
+}
+
+func defangHost(value string) string {
+	value = strings.Replace(value, ".", "[.]", -1)
+	return strings.Replace(value, "@", "[@]", -1)
+}
+
+// Canonicalize returns the canonical form of value for the given attribute
+// type, so that equivalent indicators compare equal: hashes and domains are
+// lowercased, trailing dots are removed from domains, IP addresses are
+// formatted in their shortest form and URLs are normalized with NormalizeURL.
+// Each part of composite values is canonicalized according to its type.
+// Values that cannot be parsed are returned trimmed but otherwise unchanged.
+func Canonicalize(attrType, value string) string {
+	value = strings.TrimSpace(value)
+
+	if IsCompositeType(attrType) {
+		parts, err := splitComposite(attrType, value)
+		if err != nil {
+			return value
+		}
+		types := CompositePartTypes(attrType)
+		for i := range parts {
+			parts[i] = Canonicalize(types[i], parts[i])
+		}
+		return strings.Join(parts, "|")
+	}
+
+	if _, ok := hexLengths[attrType]; ok {
+		return strings.ToLower(value)
+	}
+
+	switch attrType {
+	case TypeTLSH, TypeTelfhash, TypeVHash, TypePEHash:
+		return strings.ToLower(value)
+	case TypeDomain, TypeHostname:
+		return strings.TrimSuffix(strings.ToLower(value), ".")
+	case TypeIPSrc, TypeIPDst:
+		if ip := net.ParseIP(value); ip != nil {
+			return ip.String()
+		}
+		// The address is kept as is, rather than masked to the network
+		if ip, network, err := net.ParseCIDR(value); err == nil {
+			ones, _ := network.Mask.Size()
+			return fmt.Sprintf("%s/%d", ip, ones)
+		}
+	case TypeURL:
+		if u, err := NormalizeURL(value); err == nil {
+			return u.String()
+		}
+	case TypeEmail, TypeEmailSrc, TypeEmailDst, TypeTargetEmail, TypeWhoisRegistrantEmail, TypeDNSSOAEmail:
+		// The local part is case sensitive, the domain is not
+		if i := strings.LastIndex(value, "@"); i >= 0 {
+			return value[:i] + "@" + strings.TrimSuffix(strings.ToLower(value[i+1:]), ".")
+		}
+	case TypeMACAddress, TypeMACEUI64:
+		if mac, err := net.ParseMAC(value); err == nil {
+			return mac.String()
+		}
+	}
+
+	return value
+}
+
+// refangTypes are the attribute types whose values are commonly defanged
+var refangTypes = map[string]bool{
+	TypeIPSrc:       true,
+	TypeIPDst:       true,
+	TypeDomain:      true,
+	TypeHostname:    true,
+	TypeURL:         true,
+	TypeURI:         true,
+	TypeLink:        true,
+	TypeEmail:       true,
+	TypeEmailSrc:    true,
+	TypeEmailDst:    true,
+	TypeTargetEmail: true,
+}
+
+// Normalize canonicalizes the value of the attribute in place, typically
+// before adding or searching for it. Values of network and email types are
+// refanged first; free-form types such as registry keys are left alone.
+func (a *Attribute) Normalize() {
+	value := a.Value
+	types := CompositePartTypes(a.Type)
+	if types == nil {
+		types = []string{a.Type}
+	}
+	for _, t := range types {
+		if refangTypes[t] {
+			value = Refang(value)
+			break
+		}
+	}
+
+	a.Value = Canonicalize(a.Type, value)
+}
@@ -0,0 +1,70 @@
+package misp
+
+import "testing"
+
+func Test_Refang(t *testing.T) {
+	tests := map[string]string{
+		"hxxp://evil[.]com/a.php":     "http://evil.com/a.php",
+		"hXXps[://]evil(.)com":        "https://evil.com",
+		"fxp://files[dot]evil[.]com":  "ftp://files.evil.com",
+		"1.2.3[.]4":                   "1.2.3.4",
+		"user[@]example[.]com":        "user@example.com",
+		"user [at] example [dot] com": "user@example.com",
+		"user(at)example(dot)com":     "user@example.com",
+		"meet (at) noon (dot) ok":     "meet (at) noon (dot) ok",
+		"end [.] (at) [dot]":          "end [.] (at) [dot]",
+		"(dot)com and evil{.}":        "(dot)com and evil{.}",
+		"http://already.clean/":       "http://already.clean/",
+	}
+
+	for defanged, want := range tests {
+		if got := Refang(defanged); got != want {
+			t.Errorf("Refang(%q) = %q, want %q", defanged, got, want)
+		}
+	}
+}
+
+func Test_Defang(t *testing.T) {
+	tests := map[string]string{
+		"http://evil.com/a.php?b=c.d": "hxxp[://]evil[.]com/a.php?b=c.d",
+		"https://evil.com":            "hxxps[://]evil[.]com",
+		"1.2.3.4":                     "1[.]2[.]3[.]4",
+		"user@example.com":            "user[@]example[.]com",
+	}
+
+	for value, want := range tests {
+		got := Defang(value)
+		if got != want {
+			t.Errorf("Defang(%q) = %q, want %q", value, got, want)
+		}
+		if Refang(got) != value {
+			t.Errorf("Refang(Defang(%q)) = %q", value, Refang(got))
+		}
+	}
+}
+
+func Test_Normalize(t *testing.T) {
+	tests := []struct {
+		attr Attribute
+		want string
+	}{
+		{Attribute{Type: TypeMD5, Value: " 68B329DA9893E34099C7D8AD5CB9C940 "}, "68b329da9893e34099c7d8ad5cb9c940"},
+		{Attribute{Type: TypeDomain, Value: "Evil[.]COM."}, "evil.com"},
+		{Attribute{Type: TypeIPDst, Value: "2001:0db8:0000:0000:0000:0000:0000:0001"}, "2001:db8::1"},
+		{Attribute{Type: TypeIPDst, Value: "10.1.2.3/8"}, "10.1.2.3/8"},
+		{Attribute{Type: TypeIPSrc, Value: "2001:DB8::1/64"}, "2001:db8::1/64"},
+		{Attribute{Type: TypeURL, Value: "hxxp://Evil[.]com:80/Path"}, "http://evil.com/Path"},
+		{Attribute{Type: TypeEmailSrc, Value: "John.Doe[@]Example.COM"}, "John.Doe@example.com"},
+		{Attribute{Type: TypeDomainIP, Value: "EVIL.com|203.0.113.007"}, "evil.com|203.0.113.007"},
+		{Attribute{Type: TypeFilenameSHA1, Value: "A.EXE|DA39A3EE5E6B4B0D3255BFEF95601890AFD80709"}, "A.EXE|da39a3ee5e6b4b0d3255bfef95601890afd80709"},
+		{Attribute{Type: TypeRegkey, Value: `HKLM\Software\(.)NET`}, `HKLM\Software\(.)NET`},
+	}
+
+	for _, test := range tests {
+		attr := test.attr
+		attr.Normalize()
+		if attr.Value != test.want {
+			t.Errorf("Normalize(%+v) = %q, want %q", test.attr, attr.Value, test.want)
+		}
+	}
+}
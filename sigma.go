@@ -0,0 +1,479 @@
+package misp
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// SigmaRule is a Sigma detection rule, as stored in sigma attributes
+type SigmaRule struct {
+	Title       string
+	ID          string
+	Status      string
+	Level       string
+	Description string
+	References  []string
+	Tags        []string
+	LogSource   SigmaLogSource
+
+	// YAML source of the rule
+	Source string
+
+	// Event and attribute the rule was extracted from, if any
+	EventUUID     string
+	AttributeUUID string
+}
+
+// SigmaLogSource is the log source a Sigma rule applies to
+type SigmaLogSource struct {
+	Category string
+	Product  string
+	Service  string
+}
+
+var (
+	sigmaStatuses = []string{"stable", "test", "experimental", "deprecated", "unsupported"}
+	sigmaLevels   = []string{"informational", "low", "medium", "high", "critical"}
+
+	sigmaTagRegexp = regexp.MustCompile(`^[a-z0-9_-]+\.[a-z0-9._-]+$`)
+
+	// ATT&CK galaxy tags, e.g. misp-galaxy:mitre-attack-pattern="Spearphishing Attachment - T1566.001"
+	sigmaAttackTagRegexp = regexp.MustCompile(`^misp-galaxy:mitre-[a-z-]+=".* - ([TGS][0-9]{4}(\.[0-9]{3})?)"$`)
+	sigmaAttackIDRegexp  = regexp.MustCompile(`^[TGS][0-9]{4}(\.[0-9]{3})?$`)
+)
+
+// ParseSigmaRule parses and validates a Sigma rule. Rules must have a title,
+// a log source and a detection with a condition and at least one search
+// identifier. Optional fields are checked against the values allowed by the
+// Sigma specification.
+func ParseSigmaRule(source string) (*SigmaRule, error) {
+	doc, err := parseYAML(source)
+	if err != nil {
+		return nil, err
+	}
+	root, ok := doc.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("Sigma rule is not a YAML mapping")
+	}
+
+	rule := &SigmaRule{Source: source}
+	fields := map[string]*string{
+		"title":       &rule.Title,
+		"id":          &rule.ID,
+		"status":      &rule.Status,
+		"level":       &rule.Level,
+		"description": &rule.Description,
+	}
+	for key, field := range fields {
+		if value, ok := root[key]; ok && value != nil {
+			if *field, ok = value.(string); !ok {
+				return nil, fmt.Errorf("Field %s is not a string", key)
+			}
+		}
+	}
+
+	if strings.TrimSpace(rule.Title) == "" {
+		return nil, fmt.Errorf("Missing title")
+	}
+	if len(rule.Title) > 256 {
+		return nil, fmt.Errorf("Title longer than 256 characters")
+	}
+	if rule.ID != "" && !uuidRegexp.MatchString(rule.ID) {
+		return nil, fmt.Errorf("Invalid id %q", rule.ID)
+	}
+	if rule.Status != "" && !containsString(sigmaStatuses, rule.Status) {
+		return nil, fmt.Errorf("Invalid status %q", rule.Status)
+	}
+	if rule.Level != "" && !containsString(sigmaLevels, rule.Level) {
+		return nil, fmt.Errorf("Invalid level %q", rule.Level)
+	}
+
+	if rule.References, err = sigmaStrings(root, "references"); err != nil {
+		return nil, err
+	}
+	if rule.Tags, err = sigmaStrings(root, "tags"); err != nil {
+		return nil, err
+	}
+	for _, tag := range rule.Tags {
+		if !sigmaTagRegexp.MatchString(tag) {
+			return nil, fmt.Errorf("Invalid tag %q", tag)
+		}
+	}
+
+	logsource, ok := root["logsource"].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("Missing logsource")
+	}
+	for key, field := range map[string]*string{
+		"category": &rule.LogSource.Category,
+		"product":  &rule.LogSource.Product,
+		"service":  &rule.LogSource.Service,
+	} {
+		if value, ok := logsource[key]; ok && value != nil {
+			if *field, ok = value.(string); !ok {
+				return nil, fmt.Errorf("Field logsource.%s is not a string", key)
+			}
+		}
+	}
+	if rule.LogSource == (SigmaLogSource{}) {
+		return nil, fmt.Errorf("Log source without category, product or service")
+	}
+
+	detection, ok := root["detection"].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("Missing detection")
+	}
+	switch condition := detection["condition"].(type) {
+	case string:
+	case []interface{}:
+		for _, c := range condition {
+			if _, ok := c.(string); !ok {
+				return nil, fmt.Errorf("Condition is not a string")
+			}
+		}
+	default:
+		return nil, fmt.Errorf("Detection without condition")
+	}
+	searches := 0
+	for key, value := range detection {
+		if key == "condition" || key == "timeframe" {
+			continue
+		}
+		switch value.(type) {
+		case map[string]interface{}, []interface{}:
+			searches++
+		default:
+			return nil, fmt.Errorf("Search identifier %s is not a map or a list", key)
+		}
+	}
+	if searches == 0 {
+		return nil, fmt.Errorf("Detection without search identifier")
+	}
+
+	return rule, nil
+}
+
+// sigmaStrings returns the list of strings of an optional field
+func sigmaStrings(root map[string]interface{}, key string) ([]string, error) {
+	value, ok := root[key]
+	if !ok || value == nil {
+		return nil, nil
+	}
+	list, ok := value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("Field %s is not a list", key)
+	}
+
+	var result []string
+	for _, item := range list {
+		s, ok := item.(string)
+		if !ok {
+			return nil, fmt.Errorf("Field %s is not a list of strings", key)
+		}
+		result = append(result, s)
+	}
+	return result, nil
+}
+
+// ExtractSigmaRules returns the rules of the sigma attributes of the event
+// and of its objects, with the event metadata added to them: the links of the
+// event, and the event itself when baseURL is set, are added to references,
+// and the ATT&CK techniques, groups and software of the galaxy tags and
+// clusters, as well as the TLP, are added to tags. It returns the errors of
+// the attributes whose rules are invalid and were left out.
+func ExtractSigmaRules(event *Event, baseURL string) ([]SigmaRule, []error) {
+	var references []string
+	if baseURL != "" {
+		references = append(references, strings.TrimSuffix(baseURL, "/")+"/events/view/"+defaultString(event.ID, event.UUID))
+	}
+
+	var attrs []*Attribute
+	for i := range event.Attribute {
+		attrs = append(attrs, &event.Attribute[i])
+	}
+	for i := range event.Objects {
+		if event.Objects[i].Deleted {
+			continue
+		}
+		for j := range event.Objects[i].Attributes {
+			attrs = append(attrs, &event.Objects[i].Attributes[j])
+		}
+	}
+	for _, attr := range attrs {
+		if attr.Type == TypeLink && !attr.Deleted && !containsString(references, attr.Value) {
+			references = append(references, attr.Value)
+		}
+	}
+
+	eventTags := sigmaTags(event.Tags, event.Galaxies)
+
+	var rules []SigmaRule
+	var errs []error
+	for _, attr := range attrs {
+		if attr.Type != TypeSigma || attr.Deleted {
+			continue
+		}
+
+		rule, err := ParseSigmaRule(attr.Value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("Attribute %s: %s", attr.UUID, err))
+			continue
+		}
+		rule.EventUUID = event.UUID
+		rule.AttributeUUID = attr.UUID
+
+		rule.addList("references", &rule.References, references)
+		rule.addList("tags", &rule.Tags, append(append([]string{}, eventTags...), sigmaTags(attr.Tags, attr.Galaxies)...))
+		rules = append(rules, *rule)
+	}
+
+	return rules, errs
+}
+
+// sigmaTags maps MISP tags and galaxy clusters to Sigma tags
+func sigmaTags(tags []Tag, galaxies []Galaxy) []string {
+	var result []string
+	add := func(tag string) {
+		if !containsString(result, tag) {
+			result = append(result, tag)
+		}
+	}
+
+	for _, tag := range tags {
+		if m := sigmaAttackTagRegexp.FindStringSubmatch(tag.Name); m != nil {
+			add("attack." + strings.ToLower(m[1]))
+		} else if name := strings.ToLower(tag.Name); strings.HasPrefix(name, "tlp:") {
+			// Sigma tags do not allow "+", e.g. tlp:amber+strict
+			if sigmaTag := "tlp." + strings.Replace(name[4:], "+", "_", -1); sigmaTagRegexp.MatchString(sigmaTag) {
+				add(sigmaTag)
+			}
+		}
+	}
+
+	for _, galaxy := range galaxies {
+		for i := range galaxy.Clusters {
+			cluster := &galaxy.Clusters[i]
+			for _, id := range galaxyClusterMeta(cluster, "external_id") {
+				if sigmaAttackIDRegexp.MatchString(id) {
+					add("attack." + strings.ToLower(id))
+				}
+			}
+			// Tactics, e.g. mitre-attack:initial-access
+			for _, phase := range galaxyClusterMeta(cluster, "kill_chain") {
+				if strings.HasPrefix(phase, "mitre-attack:") {
+					add("attack." + strings.Replace(phase[len("mitre-attack:"):], "-", "_", -1))
+				}
+			}
+		}
+	}
+
+	return result
+}
+
+// addList adds values missing from the list field key, in the rule and in its
+// source. The field is rewritten in place, or added before the log source, or
+// at the end, when the rule does not have it yet. The source is left unchanged
+// when it cannot be edited line by line, e.g. a flow mapping.
+func (r *SigmaRule) addList(key string, list *[]string, values []string) {
+	added := false
+	for _, value := range values {
+		if !containsString(*list, value) {
+			*list = append(*list, value)
+			added = true
+		}
+	}
+	if !added {
+		return
+	}
+
+	var b strings.Builder
+	b.WriteString(key + ":\n")
+	for _, value := range *list {
+		b.WriteString("    - " + yamlQuote(value) + "\n")
+	}
+
+	source := r.Source
+	if source != "" && !strings.HasSuffix(source, "\n") {
+		source += "\n"
+	}
+	lines := strings.SplitAfter(source, "\n")
+	start, end := sigmaTopLevelKey(lines, key)
+	if start < 0 {
+		start, _ = sigmaTopLevelKey(lines, "logsource")
+		if start < 0 {
+			start = len(lines)
+		}
+		end = start
+	}
+
+	source = strings.Join(lines[:start], "") + b.String() + strings.Join(lines[end:], "")
+	if doc, err := parseYAML(source); err == nil {
+		if _, ok := doc.(map[string]interface{}); ok {
+			r.Source = source
+		}
+	}
+}
+
+// sigmaTopLevelKey returns the range of lines of a top-level key, plain or
+// quoted, and of its value, or -1 if the key is missing
+func sigmaTopLevelKey(lines []string, key string) (int, int) {
+	start := -1
+	for i, line := range lines {
+		if strings.HasPrefix(line, key+":") || strings.HasPrefix(line, `"`+key+`":`) || strings.HasPrefix(line, "'"+key+"':") {
+			start = i
+			break
+		}
+	}
+	if start < 0 {
+		return -1, -1
+	}
+
+	end := start + 1
+	for i := start + 1; i < len(lines); i++ {
+		line := strings.TrimRight(lines[i], "\r\n")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if line[0] != ' ' && line[0] != '-' {
+			break
+		}
+		end = i + 1
+	}
+	return start, end
+}
+
+// yamlQuote returns s as a plain scalar when possible, single quoted otherwise
+func yamlQuote(s string) string {
+	plain := s != "" && s == strings.TrimSpace(s) &&
+		strings.IndexByte("-?:,[]{}#&*!|>'\"%@`~", s[0]) < 0 &&
+		!strings.Contains(s, ": ") && !strings.Contains(s, " #") && !strings.HasSuffix(s, ":") &&
+		!strings.ContainsAny(s, "\n\t")
+	if plain {
+		return s
+	}
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
+
+// WriteSigmaRules writes rules to a directory tree organized by log source,
+// such as dir/windows/process_creation/<title>.yml. Rules without product are
+// written under generic. Rules with the same path are numbered.
+func WriteSigmaRules(dir string, rules []SigmaRule) error {
+	used := make(map[string]bool)
+	for _, rule := range rules {
+		parts := []string{dir, sigmaFileName(defaultString(rule.LogSource.Product, "generic"))}
+		if source := defaultString(rule.LogSource.Category, rule.LogSource.Service); source != "" {
+			parts = append(parts, sigmaFileName(source))
+		}
+		ruleDir := filepath.Join(parts...)
+
+		name := sigmaFileName(rule.Title)
+		if name == "" {
+			name = defaultString(rule.ID, "rule")
+		}
+		filename := filepath.Join(ruleDir, name+".yml")
+		for i := 2; used[filename]; i++ {
+			filename = filepath.Join(ruleDir, fmt.Sprintf("%s_%d.yml", name, i))
+		}
+		used[filename] = true
+
+		if err := os.MkdirAll(ruleDir, 0755); err != nil {
+			return fmt.Errorf("Error creating %s: %s", ruleDir, err)
+		}
+		source := rule.Source
+		if !strings.HasSuffix(source, "\n") {
+			source += "\n"
+		}
+		if err := writeFileAtomic(filename, []byte(source)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// sigmaFileName returns the lowercase name, with runs of other characters than
+// letters and digits replaced by an underscore
+func sigmaFileName(name string) string {
+	var b strings.Builder
+	underscore := false
+	for _, r := range strings.ToLower(name) {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' {
+			if underscore && b.Len() > 0 {
+				b.WriteByte('_')
+			}
+			b.WriteRune(r)
+			underscore = false
+		} else {
+			underscore = true
+		}
+	}
+
+	result := b.String()
+	if len(result) > 100 {
+		result = strings.TrimRight(result[:100], "_")
+	}
+	return result
+}
+
+// ReadSigmaRules reads and validates the .yml and .yaml files of a directory
+// tree. It returns the errors of the files which could not be read or whose
+// rules are invalid.
+func ReadSigmaRules(dir string) ([]SigmaRule, []error) {
+	var rules []SigmaRule
+	var errs []error
+
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		ext := strings.ToLower(filepath.Ext(path))
+		if info.IsDir() || ext != ".yml" && ext != ".yaml" {
+			return nil
+		}
+
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("Error reading %s: %s", path, err))
+			return nil
+		}
+		rule, err := ParseSigmaRule(string(data))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %s", path, err))
+			return nil
+		}
+		rules = append(rules, *rule)
+		return nil
+	})
+	if err != nil {
+		errs = append(errs, fmt.Errorf("Error reading %s: %s", dir, err))
+	}
+
+	return rules, errs
+}
+
+// Attribute returns the sigma attribute of the rule, commented with its title
+func (r *SigmaRule) Attribute() Attribute {
+	attr := Attribute{
+		UUID:    r.AttributeUUID,
+		Type:    TypeSigma,
+		Value:   r.Source,
+		Comment: r.Title,
+	}
+	DefaultDescribeTypes.ApplyDefaults(&attr)
+	attr.ToIDS = DefaultDescribeTypes.DefaultToIDS(attr.Type)
+	return attr
+}
+
+// AddSigmaRules adds rules as sigma attributes to the event identified by
+// eventID, such as the rules read by ReadSigmaRules
+func (client *Client) AddSigmaRules(eventID string, rules []SigmaRule) ([]Attribute, error) {
+	attrs := make([]Attribute, len(rules))
+	for i := range rules {
+		attrs[i] = rules[i].Attribute()
+	}
+	return client.AddAttributes(eventID, attrs)
+}
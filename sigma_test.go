@@ -0,0 +1,200 @@
+package misp
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testSigmaRule = `title: Suspicious Encoded PowerShell
+id: 5b4f6d89-1f32-4b2c-9f2a-6f9f3e0a2c11
+status: experimental
+description: >
+    Detects PowerShell started
+    with an encoded command
+references:
+    - https://example.com/blog # analysis
+author: CERT
+tags:
+    - attack.execution
+logsource:
+    category: process_creation
+    product: windows
+detection:
+    selection:
+        Image|endswith: '\powershell.exe'
+        CommandLine|contains:
+            - ' -enc '
+            - " -EncodedCommand "
+    filter: {User: 'NT AUTHORITY\SYSTEM', ParentImage: [a, b]}
+    condition: selection and not filter
+falsepositives:
+    - Administration scripts
+level: high
+`
+
+func Test_parseYAML(t *testing.T) {
+	doc, err := parseYAML(testSigmaRule)
+	if err != nil {
+		t.Fatalf("parseYAML returned error: %s", err)
+	}
+	root := doc.(map[string]interface{})
+
+	if root["description"] != "Detects PowerShell started with an encoded command\n" {
+		t.Errorf("Unexpected description %q", root["description"])
+	}
+	detection := root["detection"].(map[string]interface{})
+	want := map[string]interface{}{
+		"Image|endswith":       `\powershell.exe`,
+		"CommandLine|contains": []interface{}{" -enc ", " -EncodedCommand "},
+	}
+	if !reflect.DeepEqual(detection["selection"], want) {
+		t.Errorf("Unexpected selection %#v", detection["selection"])
+	}
+	want = map[string]interface{}{"User": `NT AUTHORITY\SYSTEM`, "ParentImage": []interface{}{"a", "b"}}
+	if !reflect.DeepEqual(detection["filter"], want) {
+		t.Errorf("Unexpected filter %#v", detection["filter"])
+	}
+
+	doc, err = parseYAML("list:\n- a\n- key: b\n  other: |-\n    line 1\n\n    line 2\n- - c\n  - ~\n")
+	if err != nil {
+		t.Fatalf("parseYAML returned error: %s", err)
+	}
+	wantDoc := map[string]interface{}{"list": []interface{}{
+		"a",
+		map[string]interface{}{"key": "b", "other": "line 1\n\nline 2"},
+		[]interface{}{"c", nil},
+	}}
+	if !reflect.DeepEqual(doc, wantDoc) {
+		t.Errorf("Unexpected document %#v", doc)
+	}
+
+	for _, source := range []string{
+		"a: 1\na: 2\n",
+		"a: 1\n  b: 2\n",
+		"a: 'unterminated\n",
+		"a: 1\n---\nb: 2\n",
+		"a: *alias\n",
+	} {
+		if _, err := parseYAML(source); err == nil {
+			t.Errorf("parseYAML accepted %q", source)
+		}
+	}
+}
+
+func Test_ParseSigmaRule(t *testing.T) {
+	rule, err := ParseSigmaRule(testSigmaRule)
+	if err != nil {
+		t.Fatalf("ParseSigmaRule returned error: %s", err)
+	}
+	if rule.Title != "Suspicious Encoded PowerShell" || rule.Level != "high" || rule.LogSource.Product != "windows" ||
+		!reflect.DeepEqual(rule.Tags, []string{"attack.execution"}) {
+		t.Errorf("Unexpected rule %+v", rule)
+	}
+
+	for _, invalid := range []struct {
+		from, to, err string
+	}{
+		{"title: Suspicious Encoded PowerShell\n", "", "Missing title"},
+		{"status: experimental", "status: beta", "Invalid status"},
+		{"    - attack.execution", "    - ATT&CK", "Invalid tag"},
+		{"    condition: selection and not filter\n", "", "without condition"},
+		{"logsource:\n    category: process_creation\n    product: windows\n", "", "Missing logsource"},
+	} {
+		source := strings.Replace(testSigmaRule, invalid.from, invalid.to, 1)
+		if _, err := ParseSigmaRule(source); err == nil || !strings.Contains(err.Error(), invalid.err) {
+			t.Errorf("Expected error %q, got %v", invalid.err, err)
+		}
+	}
+}
+
+func Test_ExtractSigmaRules(t *testing.T) {
+	event := &Event{
+		ID:   "12",
+		UUID: "58b9864a-b6ec-4fa6-a5e6-4a9a0a3ac101",
+		Tags: []Tag{
+			{Name: "tlp:amber"},
+			{Name: `misp-galaxy:mitre-attack-pattern="PowerShell - T1059.001"`},
+		},
+		Galaxies: []Galaxy{{Clusters: []GalaxyCluster{{
+			Value: "PowerShell - T1059.001",
+			Meta:  map[string]interface{}{"external_id": []interface{}{"T1059.001"}, "kill_chain": []interface{}{"mitre-attack:execution"}},
+		}}}},
+		Attribute: []Attribute{
+			{UUID: "5a1b1d2e-0c54-4e2b-a1c7-000000000001", Type: TypeSigma, Value: testSigmaRule,
+				Tags: []Tag{{Name: `misp-galaxy:mitre-intrusion-set="APT29 - G0016"`}, {Name: "TLP:RED"}, {Name: "tlp:amber+strict"}}},
+			{UUID: "5a1b1d2e-0c54-4e2b-a1c7-000000000002", Type: TypeSigma, Value: "title: broken\n"},
+			{Type: TypeLink, Value: "https://example.com/report"},
+		},
+	}
+
+	rules, errs := ExtractSigmaRules(event, "https://misp.local/")
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "5a1b1d2e-0c54-4e2b-a1c7-000000000002") {
+		t.Errorf("Unexpected errors %v", errs)
+	}
+	if len(rules) != 1 {
+		t.Fatalf("Expected 1 rule, got %d", len(rules))
+	}
+	rule := rules[0]
+
+	want := "references:\n    - https://example.com/blog\n    - https://misp.local/events/view/12\n    - https://example.com/report\nauthor: CERT\n" +
+		"tags:\n    - attack.execution\n    - tlp.amber\n    - attack.t1059.001\n    - attack.g0016\n    - tlp.red\n    - tlp.amber_strict\nlogsource:\n"
+	if !strings.Contains(rule.Source, want) {
+		t.Errorf("Rule does not contain %q:\n%s", want, rule.Source)
+	}
+
+	// Rules keep their metadata once written and read back
+	dir, err := ioutil.TempDir("", "sigma")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err = WriteSigmaRules(dir, []SigmaRule{rule, rule}); err != nil {
+		t.Fatalf("WriteSigmaRules returned error: %s", err)
+	}
+	for _, name := range []string{"suspicious_encoded_powershell.yml", "suspicious_encoded_powershell_2.yml"} {
+		if _, err = os.Stat(filepath.Join(dir, "windows", "process_creation", name)); err != nil {
+			t.Errorf("Rule not written: %s", err)
+		}
+	}
+
+	read, errs := ReadSigmaRules(dir)
+	if len(errs) != 0 || len(read) != 2 || !reflect.DeepEqual(read[0].Tags, rule.Tags) {
+		t.Errorf("Unexpected rules %+v, errors %v", read, errs)
+	}
+
+	attr := read[0].Attribute()
+	if attr.Type != TypeSigma || attr.Category != "Payload installation" || !attr.ToIDS || attr.Comment != rule.Title {
+		t.Errorf("Unexpected attribute %+v", attr)
+	}
+}
+
+func Test_ExtractSigmaRules_Layout(t *testing.T) {
+	quoted := "title: Quoted\n\"logsource\":\n    product: windows\ndetection:\n    selection:\n        Image: evil.exe\n    condition: selection"
+	flow := "{title: Flow, logsource: {product: windows}, detection: {selection: {Image: evil.exe}, condition: selection}}\n"
+	event := &Event{
+		Tags: []Tag{{Name: "tlp:amber"}},
+		Attribute: []Attribute{
+			{Type: TypeSigma, Value: quoted},
+			{Type: TypeSigma, Value: flow},
+		},
+	}
+
+	rules, errs := ExtractSigmaRules(event, "")
+	if len(errs) != 0 || len(rules) != 2 {
+		t.Fatalf("Unexpected rules %+v, errors %v", rules, errs)
+	}
+
+	if want := "title: Quoted\ntags:\n    - tlp.amber\n\"logsource\":\n"; !strings.HasPrefix(rules[0].Source, want) {
+		t.Errorf("Rule does not start with %q:\n%s", want, rules[0].Source)
+	}
+
+	// Flow mappings are not edited, the tags are only added to the rule
+	if rules[1].Source != flow || !reflect.DeepEqual(rules[1].Tags, []string{"tlp.amber"}) {
+		t.Errorf("Unexpected rule %+v", rules[1])
+	}
+}
@@ -0,0 +1,174 @@
+package misp
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Parameters of the ssdeep algorithm
+const (
+	ssdeepSpamSumLength = 64
+	ssdeepRollingWindow = 7
+	ssdeepMinBlockSize  = 3
+)
+
+// ssdeepHash is a parsed ssdeep hash, blocksize:hash1:hash2
+type ssdeepHash struct {
+	blockSize int
+	hash1     string
+	hash2     string
+}
+
+func parseSSDeep(value string) (*ssdeepHash, error) {
+	parts := strings.SplitN(strings.TrimSpace(value), ":", 3)
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("Invalid ssdeep hash %q", value)
+	}
+	blockSize, err := strconv.Atoi(parts[0])
+	if err != nil || blockSize < ssdeepMinBlockSize {
+		return nil, fmt.Errorf("Invalid ssdeep block size in %q", value)
+	}
+
+	// The second hash may be followed by the file name
+	hash2 := parts[2]
+	if i := strings.IndexByte(hash2, ','); i >= 0 {
+		hash2 = hash2[:i]
+	}
+
+	return &ssdeepHash{
+		blockSize: blockSize,
+		hash1:     ssdeepEliminateSequences(parts[1]),
+		hash2:     ssdeepEliminateSequences(hash2),
+	}, nil
+}
+
+// SSDeepCompare returns the similarity score of two ssdeep hashes, from 0 for
+// unrelated inputs to 100 for identical ones, as computed by ssdeep. Hashes
+// only compare when their block sizes are equal or differ by a factor of two.
+func SSDeepCompare(a, b string) (int, error) {
+	h1, err := parseSSDeep(a)
+	if err != nil {
+		return 0, err
+	}
+	h2, err := parseSSDeep(b)
+	if err != nil {
+		return 0, err
+	}
+	return h1.compare(h2), nil
+}
+
+func (h1 *ssdeepHash) compare(h2 *ssdeepHash) int {
+	bs1, bs2 := h1.blockSize, h2.blockSize
+	if bs1 != bs2 && bs1 != 2*bs2 && bs2 != 2*bs1 {
+		return 0
+	}
+
+	if bs1 == bs2 && h1.hash1 == h2.hash1 && h1.hash2 == h2.hash2 {
+		return 100
+	}
+
+	switch {
+	case bs1 == bs2:
+		score1 := ssdeepScoreStrings(h1.hash1, h2.hash1, bs1)
+		score2 := ssdeepScoreStrings(h1.hash2, h2.hash2, bs1*2)
+		if score1 > score2 {
+			return score1
+		}
+		return score2
+	case bs1 == 2*bs2:
+		return ssdeepScoreStrings(h1.hash1, h2.hash2, bs1)
+	default:
+		return ssdeepScoreStrings(h1.hash2, h2.hash1, bs2)
+	}
+}
+
+// ssdeepEliminateSequences reduces runs of more than three identical
+// characters to three, as they carry little information
+func ssdeepEliminateSequences(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if i < 3 || s[i] != s[i-1] || s[i] != s[i-2] || s[i] != s[i-3] {
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
+
+func ssdeepScoreStrings(s1, s2 string, blockSize int) int {
+	if len(s1) > ssdeepSpamSumLength || len(s2) > ssdeepSpamSumLength {
+		return 0
+	}
+
+	// Hashes without a common substring of the rolling window size are
+	// considered unrelated
+	if !ssdeepCommonSubstring(s1, s2) {
+		return 0
+	}
+
+	score := ssdeepEditDistance(s1, s2)
+	score = score * ssdeepSpamSumLength / (len(s1) + len(s2))
+	score = 100 * score / ssdeepSpamSumLength
+	if score >= 100 {
+		return 0
+	}
+	score = 100 - score
+
+	// Small block sizes cannot claim high similarity for short hashes
+	if blockSize < (99+ssdeepRollingWindow)/ssdeepRollingWindow*ssdeepMinBlockSize {
+		limit := blockSize / ssdeepMinBlockSize * len(s1)
+		if len(s2) < len(s1) {
+			limit = blockSize / ssdeepMinBlockSize * len(s2)
+		}
+		if score > limit {
+			score = limit
+		}
+	}
+	return score
+}
+
+func ssdeepCommonSubstring(s1, s2 string) bool {
+	if len(s1) < ssdeepRollingWindow || len(s2) < ssdeepRollingWindow {
+		return false
+	}
+	windows := make(map[string]bool, len(s1))
+	for i := 0; i+ssdeepRollingWindow <= len(s1); i++ {
+		windows[s1[i:i+ssdeepRollingWindow]] = true
+	}
+	for i := 0; i+ssdeepRollingWindow <= len(s2); i++ {
+		if windows[s2[i:i+ssdeepRollingWindow]] {
+			return true
+		}
+	}
+	return false
+}
+
+// ssdeepEditDistance is the Levenshtein distance of ssdeep, insertions and
+// deletions costing 1 and substitutions 2
+func ssdeepEditDistance(s1, s2 string) int {
+	previous := make([]int, len(s2)+1)
+	current := make([]int, len(s2)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(s1); i++ {
+		current[0] = i
+		for j := 1; j <= len(s2); j++ {
+			cost := previous[j-1]
+			if s1[i-1] != s2[j-1] {
+				cost += 2
+			}
+			if previous[j]+1 < cost {
+				cost = previous[j] + 1
+			}
+			if current[j-1]+1 < cost {
+				cost = current[j-1] + 1
+			}
+			current[j] = cost
+		}
+		previous, current = current, previous
+	}
+
+	return previous[len(s2)]
+}
@@ -0,0 +1,29 @@
+package misp
+
+import "testing"
+
+func Test_SSDeepCompare(t *testing.T) {
+	for _, test := range []struct {
+		a, b  string
+		score int
+	}{
+		// Example of the python-ssdeep documentation
+		{"3:AXGBicFlgVNhBGcL6wCrFQEv:AXGHsNhxLsr2C", "3:AXGBicFlIHBGcL6wCrFQEv:AXGH6xLsr2Cx", 22},
+		{"3:AXGBicFlgVNhBGcL6wCrFQEv:AXGHsNhxLsr2C", "3:AXGBicFlgVNhBGcL6wCrFQEv:AXGHsNhxLsr2C", 100},
+		// Runs of identical characters are shortened before comparing
+		{"96:aaaaaaaaXYZabcdefgh:Hij", "96:aaaXYZabcdefgh:Hij", 100},
+		{"3:AXGBicFlgVNhBGcL6wCrFQEv:AXGHsNhxLsr2C", "3:0123456789abcdefghij:klmnopq", 0},
+		{"3:AXGBicFlgVNhBGcL6wCrFQEv:AXGHsNhxLsr2C", "12:AXGBicFlgVNhBGcL6wCrFQEv:AXGHsNhxLsr2C", 0},
+	} {
+		score, err := SSDeepCompare(test.a, test.b)
+		if err != nil {
+			t.Errorf("SSDeepCompare returned error: %s", err)
+		} else if score != test.score {
+			t.Errorf("%s and %s: expected %d, got %d", test.a, test.b, test.score, score)
+		}
+	}
+
+	if _, err := SSDeepCompare("3:abc", "3:abc:def"); err == nil {
+		t.Errorf("SSDeepCompare accepted an invalid hash")
+	}
+}
@@ -0,0 +1,890 @@
+package misp
+
+import (
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// STIXObject is a STIX 2.1 object, kept generic to represent any object type
+type STIXObject map[string]interface{}
+
+// Type returns the STIX type of the object
+func (o STIXObject) Type() string {
+	return o.String("type")
+}
+
+// ID returns the STIX identifier of the object
+func (o STIXObject) ID() string {
+	return o.String("id")
+}
+
+// String returns the string property key of the object, or an empty string
+func (o STIXObject) String(key string) string {
+	s, _ := o[key].(string)
+	return s
+}
+
+// Strings returns the list of strings property key of the object
+func (o STIXObject) Strings(key string) []string {
+	switch values := o[key].(type) {
+	case []string:
+		return values
+	case []interface{}:
+		result := make([]string, 0, len(values))
+		for _, value := range values {
+			if s, ok := value.(string); ok {
+				result = append(result, s)
+			}
+		}
+		return result
+	}
+	return nil
+}
+
+// STIXBundle is a STIX 2.1 bundle
+type STIXBundle struct {
+	Type    string       `json:"type"`
+	ID      string       `json:"id"`
+	Objects []STIXObject `json:"objects"`
+}
+
+// Write encodes the bundle in JSON to w
+func (b *STIXBundle) Write(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "    ")
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(b); err != nil {
+		return fmt.Errorf("Could not marshal STIX bundle: %s", err)
+	}
+	return nil
+}
+
+const stixTimeFormat = "2006-01-02T15:04:05.000Z"
+
+// stixSCONamespace is the namespace of the deterministic identifiers of STIX
+// cyber-observable objects
+var stixSCONamespace = []byte{0x00, 0xab, 0xed, 0xb4, 0xaa, 0x42, 0x46, 0x6c, 0x9c, 0x01, 0xfe, 0xd2, 0x33, 0x15, 0xa9, 0xb7}
+
+// stixSCOIDProperties are the properties contributing to the identifier of
+// each type of cyber-observable object
+var stixSCOIDProperties = map[string][]string{
+	"autonomous-system":    {"number"},
+	"domain-name":          {"value"},
+	"email-addr":           {"value"},
+	"email-message":        {"from_ref", "subject", "body"},
+	"file":                 {"hashes", "name", "extensions", "parent_directory_ref"},
+	"ipv4-addr":            {"value"},
+	"ipv6-addr":            {"value"},
+	"mac-addr":             {"value"},
+	"mutex":                {"name"},
+	"network-traffic":      {"start", "end", "src_ref", "dst_ref", "src_port", "dst_port", "protocols", "extensions"},
+	"url":                  {"value"},
+	"windows-registry-key": {"key", "values"},
+	"x509-certificate":     {"hashes", "serial_number"},
+}
+
+// TLP marking definitions, as defined by the STIX 2.1 specification
+var stixTLPMarkings = map[string]STIXObject{
+	"tlp:white": stixTLPMarking("613f2e26-407d-48c7-9eca-b8e91df99dc9", "white"),
+	"tlp:clear": stixTLPMarking("613f2e26-407d-48c7-9eca-b8e91df99dc9", "white"),
+	"tlp:green": stixTLPMarking("34098fce-860f-48ae-8e50-ebd3cc5e41da", "green"),
+	"tlp:amber": stixTLPMarking("f88d31f6-486f-44da-b317-01333bde0b82", "amber"),
+	"tlp:red":   stixTLPMarking("5e57c739-391a-4eb3-b6be-7d15ca92d5ed", "red"),
+}
+
+func stixTLPMarking(uuid, tlp string) STIXObject {
+	return STIXObject{
+		"type":            "marking-definition",
+		"spec_version":    "2.1",
+		"id":              "marking-definition--" + uuid,
+		"created":         "2017-01-20T00:00:00.000Z",
+		"definition_type": "tlp",
+		"name":            "TLP:" + strings.ToUpper(tlp),
+		"definition":      map[string]interface{}{"tlp": tlp},
+	}
+}
+
+// stixHashNames maps MISP hash types to STIX hash algorithm names
+var stixHashNames = map[string]string{
+	TypeMD5:      "MD5",
+	TypeSHA1:     "SHA-1",
+	TypeSHA224:   "SHA224",
+	TypeSHA256:   "SHA-256",
+	TypeSHA384:   "SHA384",
+	TypeSHA512:   "SHA-512",
+	TypeSHA3_256: "SHA3-256",
+	TypeSHA3_512: "SHA3-512",
+	TypeSSDeep:   "SSDEEP",
+	TypeTLSH:     "TLSH",
+}
+
+// stixGalaxyTypes maps MISP galaxy types to STIX domain object types
+var stixGalaxyTypes = map[string]string{
+	"threat-actor":           "threat-actor",
+	"mitre-attack-pattern":   "attack-pattern",
+	"attack-pattern":         "attack-pattern",
+	"mitre-intrusion-set":    "intrusion-set",
+	"intrusion-set":          "intrusion-set",
+	"mitre-malware":          "malware",
+	"malpedia":               "malware",
+	"ransomware":             "malware",
+	"rat":                    "malware",
+	"banker":                 "malware",
+	"botnet":                 "malware",
+	"backdoor":               "malware",
+	"stealer":                "malware",
+	"android":                "malware",
+	"exploit-kit":            "malware",
+	"mitre-tool":             "tool",
+	"tool":                   "tool",
+	"mitre-course-of-action": "course-of-action",
+	"course-of-action":       "course-of-action",
+}
+
+// stixPatternTypes are the MISP types holding a whole pattern in a language
+// supported by STIX indicators
+var stixPatternTypes = map[string]string{
+	TypeYara:         "yara",
+	TypeSnort:        "snort",
+	TypeSigma:        "sigma",
+	TypeSTIX2Pattern: "stix",
+}
+
+// stixObservation is the set of comparisons applying to one cyber-observable
+// object in a pattern
+type stixObservation struct {
+	objType     string
+	comparisons []string
+}
+
+// stixConverter converts events to STIX, keeping track of the objects
+// already added to the bundle
+type stixConverter struct {
+	objects  []STIXObject
+	seen     map[string]bool
+	ids      map[string]string // MISP UUID -> STIX identifier
+	clusters map[string]string // galaxy cluster UUID -> STIX identifier
+}
+
+// EventsToSTIX converts events to a STIX 2.1 bundle following the misp-stix
+// mapping: each event becomes a report referencing its content, attributes
+// and objects flagged for IDS become indicators with STIX patterns, others
+// become observed-data with their cyber-observable objects, galaxy clusters
+// become threat-actor, malware, attack-pattern, etc. objects, object
+// references become relationships and TLP tags become marking definitions.
+// Attributes and objects with no STIX equivalent are exported as custom
+// x-misp-attribute and x-misp-object objects.
+func EventsToSTIX(events []Event) *STIXBundle {
+	c := &stixConverter{
+		seen:     make(map[string]bool),
+		ids:      make(map[string]string),
+		clusters: make(map[string]string),
+	}
+
+	for i := range events {
+		c.convertEvent(&events[i])
+	}
+
+	return &STIXBundle{
+		Type:    "bundle",
+		ID:      "bundle--" + newUUID(),
+		Objects: c.objects,
+	}
+}
+
+func (c *stixConverter) add(object STIXObject) {
+	id := object.ID()
+	if c.seen[id] {
+		return
+	}
+	c.seen[id] = true
+	c.objects = append(c.objects, object)
+}
+
+func (c *stixConverter) convertEvent(event *Event) {
+	created := stixTime(event.Timestamp, event.Date)
+
+	var identityRef string
+	if event.Orgc.Name != "" {
+		uuid := event.Orgc.UUID
+		if uuid == "" {
+			uuid = stixUUIDv5(event.Orgc.Name)
+		}
+		identityRef = "identity--" + uuid
+		c.add(STIXObject{
+			"type":           "identity",
+			"spec_version":   "2.1",
+			"id":             identityRef,
+			"created":        created,
+			"modified":       created,
+			"name":           event.Orgc.Name,
+			"identity_class": "organization",
+		})
+	}
+
+	markings, labels := c.convertTags(event.Tags)
+	base := func(objType, uuid, timestamp string) STIXObject {
+		ts := stixTime(timestamp, event.Date)
+		object := STIXObject{
+			"type":         objType,
+			"spec_version": "2.1",
+			"id":           objType + "--" + uuid,
+			"created":      ts,
+			"modified":     ts,
+		}
+		if identityRef != "" {
+			object["created_by_ref"] = identityRef
+		}
+		return object
+	}
+
+	var refs []string
+	for _, galaxy := range event.Galaxies {
+		refs = append(refs, c.convertGalaxy(&galaxy, base)...)
+	}
+
+	for i := range event.Attribute {
+		attr := &event.Attribute[i]
+		object := c.convertAttribute(attr, base)
+		if object == nil {
+			continue
+		}
+		refs = append(refs, object.ID())
+		for _, galaxy := range attr.Galaxies {
+			for _, target := range c.convertGalaxy(&galaxy, base) {
+				refs = append(refs, c.relationship(base, object, target).ID())
+			}
+		}
+	}
+
+	for i := range event.Objects {
+		refs = append(refs, c.convertObject(&event.Objects[i], base)...)
+	}
+
+	// References are converted last, once every target has an identifier
+	for _, object := range event.Objects {
+		source, ok := c.ids[object.UUID]
+		if !ok {
+			continue
+		}
+		for _, ref := range object.References {
+			target, ok := c.ids[ref.ReferencedUUID]
+			if !ok {
+				continue
+			}
+			relationship := base("relationship", stixUUIDv5(source+ref.RelationshipType+target), ref.Timestamp)
+			relationship["relationship_type"] = ref.RelationshipType
+			relationship["source_ref"] = source
+			relationship["target_ref"] = target
+			c.add(relationship)
+			refs = append(refs, relationship.ID())
+		}
+	}
+
+	for _, marking := range markings {
+		refs = append(refs, marking)
+	}
+
+	published := stixTime(event.PublishTimestamp, event.Date)
+	report := base("report", event.UUID, event.Timestamp)
+	report["name"] = event.Info
+	report["published"] = published
+	report["report_types"] = []string{"threat-report"}
+	report["labels"] = append([]string{"Threat-Report", "misp:tool=\"MISP-STIX-Converter\""}, labels...)
+	if len(markings) > 0 {
+		report["object_marking_refs"] = markings
+	}
+	if len(refs) == 0 && identityRef != "" {
+		// object_refs is mandatory, reference at least the author
+		refs = []string{identityRef}
+	}
+	if len(refs) > 0 {
+		report["object_refs"] = refs
+	}
+	c.add(report)
+}
+
+// convertTags adds the marking definitions of TLP tags and returns their
+// identifiers, and the names of the other tags
+func (c *stixConverter) convertTags(tags []Tag) (markings []string, labels []string) {
+	for _, tag := range tags {
+		if marking, ok := stixTLPMarkings[strings.ToLower(tag.Name)]; ok {
+			c.add(marking)
+			markings = append(markings, marking.ID())
+			continue
+		}
+		labels = append(labels, tag.Name)
+	}
+	return markings, labels
+}
+
+func (c *stixConverter) convertGalaxy(galaxy *Galaxy, base func(string, string, string) STIXObject) []string {
+	objType, ok := stixGalaxyTypes[galaxy.Type]
+	if !ok {
+		objType = "x-misp-galaxy-cluster"
+	}
+
+	var ids []string
+	for _, cluster := range galaxy.Clusters {
+		uuid := cluster.UUID
+		if uuid == "" {
+			// Clusters attached by tag only have no UUID
+			uuid = stixUUIDv5(defaultString(cluster.TagName, galaxy.Type+"="+cluster.Value))
+		}
+		if id, ok := c.clusters[uuid]; ok {
+			ids = append(ids, id)
+			continue
+		}
+
+		object := base(objType, uuid, "")
+		object["name"] = cluster.Value
+		object["labels"] = []string{
+			fmt.Sprintf("misp:galaxy-name=%q", galaxy.Name),
+			fmt.Sprintf("misp:galaxy-type=%q", galaxy.Type),
+		}
+		if cluster.Description != "" {
+			object["description"] = cluster.Description
+		}
+		synonyms := galaxyClusterMeta(&cluster, "synonyms")
+
+		switch objType {
+		case "malware":
+			object["is_family"] = true
+			if len(synonyms) > 0 {
+				object["aliases"] = synonyms
+			}
+		case "threat-actor", "intrusion-set", "tool":
+			if len(synonyms) > 0 {
+				object["aliases"] = synonyms
+			}
+		case "attack-pattern", "course-of-action":
+			if ids := galaxyClusterMeta(&cluster, "external_id"); len(ids) > 0 {
+				object["external_references"] = []map[string]string{
+					{"source_name": "mitre-attack", "external_id": ids[0]},
+				}
+			}
+		case "x-misp-galaxy-cluster":
+			object["x_misp_type"] = galaxy.Type
+			object["x_misp_tag_name"] = cluster.TagName
+		}
+
+		c.add(object)
+		c.clusters[uuid] = object.ID()
+		ids = append(ids, object.ID())
+	}
+
+	return ids
+}
+
+// galaxyClusterMeta returns the values of a meta field of a cluster
+func galaxyClusterMeta(cluster *GalaxyCluster, key string) []string {
+	switch values := cluster.Meta[key].(type) {
+	case string:
+		return []string{values}
+	case []string:
+		return values
+	case []interface{}:
+		var result []string
+		for _, value := range values {
+			if s, ok := value.(string); ok {
+				result = append(result, s)
+			}
+		}
+		return result
+	}
+	return nil
+}
+
+func (c *stixConverter) relationship(base func(string, string, string) STIXObject, source STIXObject, target string) STIXObject {
+	relationshipType := "related-to"
+	if source.Type() == "indicator" {
+		relationshipType = "indicates"
+	}
+
+	relationship := base("relationship", stixUUIDv5(source.ID()+relationshipType+target), "")
+	relationship["relationship_type"] = relationshipType
+	relationship["source_ref"] = source.ID()
+	relationship["target_ref"] = target
+	c.add(relationship)
+
+	return relationship
+}
+
+func (c *stixConverter) convertAttribute(attr *Attribute, base func(string, string, string) STIXObject) STIXObject {
+	if attr.Deleted {
+		return nil
+	}
+
+	var object STIXObject
+	markings, labels := c.convertTags(attr.Tags)
+	labels = append([]string{
+		fmt.Sprintf("misp:type=%q", attr.Type),
+		fmt.Sprintf("misp:category=%q", attr.Category),
+	}, labels...)
+
+	observations, observables := stixAttributeMapping(attr)
+	patternType, isPattern := stixPatternTypes[attr.Type]
+
+	switch {
+	case isPattern:
+		object = base("indicator", attr.UUID, attr.Timestamp)
+		object["pattern"] = attr.Value
+		object["pattern_type"] = patternType
+	case attr.ToIDS && observations != nil:
+		object = base("indicator", attr.UUID, attr.Timestamp)
+		object["pattern"] = stixPatternString(observations)
+		object["pattern_type"] = "stix"
+		object["pattern_version"] = "2.1"
+	case attr.Type == TypeVulnerability:
+		object = base("vulnerability", attr.UUID, attr.Timestamp)
+		object["name"] = attr.Value
+		object["external_references"] = []map[string]string{
+			{"source_name": "cve", "external_id": attr.Value},
+		}
+	case observables != nil:
+		object = base("observed-data", attr.UUID, attr.Timestamp)
+		c.addObservables(object, observables)
+	default:
+		object = base("x-misp-attribute", attr.UUID, attr.Timestamp)
+		object["x_misp_type"] = attr.Type
+		object["x_misp_value"] = attr.Value
+		object["x_misp_category"] = attr.Category
+	}
+
+	if object.Type() == "indicator" {
+		object["valid_from"] = object["created"]
+		object["kill_chain_phases"] = []map[string]string{
+			{"kill_chain_name": "misp-category", "phase_name": attr.Category},
+		}
+		toIDS := "False"
+		if attr.ToIDS {
+			toIDS = "True"
+		}
+		labels = append(labels, fmt.Sprintf("misp:to_ids=%q", toIDS))
+	}
+
+	object["labels"] = labels
+	if attr.Comment != "" {
+		object["description"] = attr.Comment
+	}
+	if len(markings) > 0 {
+		object["object_marking_refs"] = markings
+	}
+
+	c.add(object)
+	c.ids[attr.UUID] = object.ID()
+
+	return object
+}
+
+// convertObject adds the STIX objects of a MISP object and returns the
+// identifiers to reference from the report. The attributes of a mapped object
+// which have no STIX equivalent are kept in a related x-misp-object.
+func (c *stixConverter) convertObject(misp *Object, base func(string, string, string) STIXObject) []string {
+	if misp.Deleted {
+		return nil
+	}
+
+	var observations []stixObservation
+	var observables []STIXObject
+	var unmapped []map[string]string
+	toIDS := false
+
+	for i := range misp.Attributes {
+		attr := &misp.Attributes[i]
+		if attr.Deleted {
+			continue
+		}
+		attrObservations, attrObservables := stixAttributeMapping(attr)
+		if attrObservations == nil {
+			unmapped = append(unmapped, map[string]string{
+				"type":            attr.Type,
+				"object_relation": attr.ObjectRelation,
+				"value":           attr.Value,
+			})
+			continue
+		}
+		observations = mergeObservations(observations, attrObservations)
+		observables = mergeObservables(observables, attrObservables)
+		toIDS = toIDS || attr.ToIDS
+	}
+
+	labels := []string{
+		fmt.Sprintf("misp:name=%q", misp.Name),
+		fmt.Sprintf("misp:meta-category=%q", misp.MetaCategory),
+	}
+	custom := func(uuid string) STIXObject {
+		object := base("x-misp-object", uuid, misp.Timestamp)
+		object["x_misp_name"] = misp.Name
+		object["x_misp_meta_category"] = misp.MetaCategory
+		object["x_misp_attributes"] = unmapped
+		object["labels"] = labels
+		return object
+	}
+
+	var object STIXObject
+	switch {
+	case observations == nil:
+		object = custom(misp.UUID)
+	case toIDS:
+		object = base("indicator", misp.UUID, misp.Timestamp)
+		object["pattern"] = stixPatternString(observations)
+		object["pattern_type"] = "stix"
+		object["pattern_version"] = "2.1"
+		object["valid_from"] = object["created"]
+		object["kill_chain_phases"] = []map[string]string{
+			{"kill_chain_name": "misp-category", "phase_name": misp.MetaCategory},
+		}
+	default:
+		object = base("observed-data", misp.UUID, misp.Timestamp)
+		c.addObservables(object, observables)
+	}
+
+	object["labels"] = labels
+	if misp.Comment != "" {
+		object["description"] = misp.Comment
+	}
+
+	c.add(object)
+	c.ids[misp.UUID] = object.ID()
+	ids := []string{object.ID()}
+
+	if observations != nil && len(unmapped) > 0 {
+		leftover := custom(stixUUIDv5(misp.UUID + "x-misp-object"))
+		c.add(leftover)
+		relationship := base("relationship", stixUUIDv5(object.ID()+"related-to"+leftover.ID()), misp.Timestamp)
+		relationship["relationship_type"] = "related-to"
+		relationship["source_ref"] = object.ID()
+		relationship["target_ref"] = leftover.ID()
+		c.add(relationship)
+		ids = append(ids, leftover.ID(), relationship.ID())
+	}
+
+	return ids
+}
+
+func (c *stixConverter) addObservables(object STIXObject, observables []STIXObject) {
+	refs := make([]string, len(observables))
+	for i, observable := range observables {
+		c.add(observable)
+		refs[i] = observable.ID()
+	}
+
+	object["first_observed"] = object["created"]
+	object["last_observed"] = object["created"]
+	object["number_observed"] = 1
+	object["object_refs"] = refs
+}
+
+// stixAttributeMapping returns the pattern observations and the
+// cyber-observable objects equivalent to an attribute, or nil if the attribute
+// type has no STIX equivalent or its composite value is malformed
+func stixAttributeMapping(attr *Attribute) ([]stixObservation, []STIXObject) {
+	value := attr.Value
+
+	if hash, ok := stixHashNames[attr.Type]; ok {
+		return []stixObservation{{"file", []string{stixComparison("file:hashes."+stixQuoteKey(hash), value)}}},
+			[]STIXObject{newSCO("file", map[string]interface{}{"hashes": map[string]string{hash: value}})}
+	}
+
+	parts, err := attr.Composite()
+	if err != nil && IsCompositeType(attr.Type) {
+		return nil, nil
+	}
+
+	switch attr.Type {
+	case TypeFilename:
+		return []stixObservation{{"file", []string{stixComparison("file:name", value)}}},
+			[]STIXObject{newSCO("file", map[string]interface{}{"name": value})}
+	case TypeIPSrc, TypeIPDst, TypeIPSrcPort, TypeIPDstPort:
+		side := "dst"
+		if attr.Type == TypeIPSrc || attr.Type == TypeIPSrcPort {
+			side = "src"
+		}
+		ip := value
+		if parts != nil {
+			ip = parts[0]
+		}
+
+		ipObject, ok := newIPSCO(ip)
+		if !ok {
+			return nil, nil
+		}
+		traffic := map[string]interface{}{
+			side + "_ref": ipObject.ID(),
+			"protocols":   []string{strings.TrimSuffix(ipObject.Type(), "-addr")},
+		}
+		comparisons := []string{
+			stixComparison("network-traffic:"+side+"_ref.type", ipObject.Type()),
+			stixComparison("network-traffic:"+side+"_ref.value", ip),
+		}
+		if parts != nil {
+			port, err := strconv.Atoi(parts[1])
+			if err != nil {
+				return nil, nil
+			}
+			traffic[side+"_port"] = port
+			comparisons = append(comparisons, fmt.Sprintf("network-traffic:%s_port = %d", side, port))
+		}
+
+		return []stixObservation{{"network-traffic", comparisons}},
+			[]STIXObject{ipObject, newSCO("network-traffic", traffic)}
+	case TypeHostnamePort:
+		port, err := strconv.Atoi(parts[1])
+		if err != nil {
+			return nil, nil
+		}
+		domain := newSCO("domain-name", map[string]interface{}{"value": parts[0]})
+		return []stixObservation{{"network-traffic", []string{
+				stixComparison("network-traffic:dst_ref.type", "domain-name"),
+				stixComparison("network-traffic:dst_ref.value", parts[0]),
+				fmt.Sprintf("network-traffic:dst_port = %d", port),
+			}}},
+			[]STIXObject{domain, newSCO("network-traffic", map[string]interface{}{
+				"dst_ref":   domain.ID(),
+				"dst_port":  port,
+				"protocols": []string{"tcp"},
+			})}
+	case TypeDomain, TypeHostname:
+		return []stixObservation{{"domain-name", []string{stixComparison("domain-name:value", value)}}},
+			[]STIXObject{newSCO("domain-name", map[string]interface{}{"value": value})}
+	case TypeDomainIP:
+		ipObject, ok := newIPSCO(parts[1])
+		if !ok {
+			return nil, nil
+		}
+		return []stixObservation{{"domain-name", []string{
+				stixComparison("domain-name:value", parts[0]),
+				stixComparison("domain-name:resolves_to_refs[*].value", parts[1]),
+			}}},
+			[]STIXObject{ipObject, newSCO("domain-name", map[string]interface{}{
+				"value":            parts[0],
+				"resolves_to_refs": []string{ipObject.ID()},
+			})}
+	case TypeURL, TypeURI:
+		return []stixObservation{{"url", []string{stixComparison("url:value", value)}}},
+			[]STIXObject{newSCO("url", map[string]interface{}{"value": value})}
+	case TypeEmail, TypeEmailSrc, TypeEmailDst:
+		path := map[string]string{
+			TypeEmail:    "email-addr:value",
+			TypeEmailSrc: "email-message:from_ref.value",
+			TypeEmailDst: "email-message:to_refs[*].value",
+		}[attr.Type]
+		return []stixObservation{{strings.SplitN(path, ":", 2)[0], []string{stixComparison(path, value)}}},
+			[]STIXObject{newSCO("email-addr", map[string]interface{}{"value": value})}
+	case TypeEmailSubject:
+		return []stixObservation{{"email-message", []string{stixComparison("email-message:subject", value)}}},
+			[]STIXObject{newSCO("email-message", map[string]interface{}{"is_multipart": false, "subject": value})}
+	case TypeEmailReplyTo:
+		return []stixObservation{{"email-message", []string{stixComparison("email-message:additional_header_fields.reply_to", value)}}},
+			[]STIXObject{newSCO("email-message", map[string]interface{}{
+				"is_multipart":             false,
+				"additional_header_fields": map[string]string{"Reply-To": value},
+			})}
+	case TypeMutex:
+		return []stixObservation{{"mutex", []string{stixComparison("mutex:name", value)}}},
+			[]STIXObject{newSCO("mutex", map[string]interface{}{"name": value})}
+	case TypeRegkey:
+		return []stixObservation{{"windows-registry-key", []string{stixComparison("windows-registry-key:key", value)}}},
+			[]STIXObject{newSCO("windows-registry-key", map[string]interface{}{"key": value})}
+	case TypeRegkeyValue:
+		return []stixObservation{{"windows-registry-key", []string{
+				stixComparison("windows-registry-key:key", parts[0]),
+				stixComparison("windows-registry-key:values[*].data", parts[1]),
+			}}},
+			[]STIXObject{newSCO("windows-registry-key", map[string]interface{}{
+				"key":    parts[0],
+				"values": []map[string]string{{"data": parts[1]}},
+			})}
+	case TypeAS:
+		number, err := strconv.Atoi(strings.TrimPrefix(strings.ToUpper(value), "AS"))
+		if err != nil {
+			return nil, nil
+		}
+		return []stixObservation{{"autonomous-system", []string{fmt.Sprintf("autonomous-system:number = %d", number)}}},
+			[]STIXObject{newSCO("autonomous-system", map[string]interface{}{"number": number})}
+	case TypeMACAddress:
+		return []stixObservation{{"mac-addr", []string{stixComparison("mac-addr:value", value)}}},
+			[]STIXObject{newSCO("mac-addr", map[string]interface{}{"value": value})}
+	case TypeX509FingerprintMD5, TypeX509FingerprintSHA1, TypeX509FingerprintSHA256:
+		hash := stixHashNames[strings.TrimPrefix(attr.Type, "x509-fingerprint-")]
+		return []stixObservation{{"x509-certificate", []string{stixComparison("x509-certificate:hashes."+stixQuoteKey(hash), value)}}},
+			[]STIXObject{newSCO("x509-certificate", map[string]interface{}{"hashes": map[string]string{hash: value}})}
+	}
+
+	if types := CompositePartTypes(attr.Type); len(types) == 2 && types[0] == TypeFilename {
+		if hash, ok := stixHashNames[types[1]]; ok {
+			return []stixObservation{{"file", []string{
+					stixComparison("file:name", parts[0]),
+					stixComparison("file:hashes."+stixQuoteKey(hash), parts[1]),
+				}}},
+				[]STIXObject{newSCO("file", map[string]interface{}{
+					"name":   parts[0],
+					"hashes": map[string]string{hash: parts[1]},
+				})}
+		}
+	}
+
+	return nil, nil
+}
+
+// mergeObservations merges the comparisons applying to the same type of
+// cyber-observable object
+func mergeObservations(observations, added []stixObservation) []stixObservation {
+	for _, observation := range added {
+		merged := false
+		for i := range observations {
+			if observations[i].objType == observation.objType {
+				observations[i].comparisons = append(observations[i].comparisons, observation.comparisons...)
+				merged = true
+				break
+			}
+		}
+		if !merged {
+			observations = append(observations, observation)
+		}
+	}
+	return observations
+}
+
+// mergeObservables merges the properties of the files, email messages and
+// certificates described by the attributes of a single MISP object
+func mergeObservables(observables, added []STIXObject) []STIXObject {
+	for _, observable := range added {
+		merged := false
+		switch observable.Type() {
+		case "file", "email-message", "x509-certificate":
+			for i := range observables {
+				if observables[i].Type() != observable.Type() {
+					continue
+				}
+				props := make(map[string]interface{})
+				for key, value := range observables[i] {
+					props[key] = value
+				}
+				for key, value := range observable {
+					existing, ok := props[key].(map[string]string)
+					if added, isMap := value.(map[string]string); ok && isMap {
+						union := make(map[string]string)
+						for k, v := range existing {
+							union[k] = v
+						}
+						for k, v := range added {
+							union[k] = v
+						}
+						props[key] = union
+					} else if _, exists := props[key]; !exists {
+						props[key] = value
+					}
+				}
+				delete(props, "id")
+				observables[i] = newSCO(observable.Type(), props)
+				merged = true
+				break
+			}
+		}
+		if !merged {
+			observables = append(observables, observable)
+		}
+	}
+	return observables
+}
+
+// newIPSCO builds the ipv4-addr or ipv6-addr object of an address or CIDR
+// block, or returns false if ip is neither
+func newIPSCO(ip string) (STIXObject, bool) {
+	network, err := parseNetwork(ip)
+	if err != nil {
+		return nil, false
+	}
+	objType := "ipv4-addr"
+	if network.IP.To4() == nil {
+		objType = "ipv6-addr"
+	}
+	return newSCO(objType, map[string]interface{}{"value": ip}), true
+}
+
+// newSCO builds a cyber-observable object with its deterministic identifier
+func newSCO(objType string, props map[string]interface{}) STIXObject {
+	object := STIXObject{
+		"type":         objType,
+		"spec_version": "2.1",
+	}
+
+	contributing := make(map[string]interface{})
+	for key, value := range props {
+		if key == "type" || key == "spec_version" {
+			continue
+		}
+		object[key] = value
+		for _, property := range stixSCOIDProperties[objType] {
+			if property == key {
+				contributing[key] = value
+			}
+		}
+	}
+
+	// encoding/json sorts map keys and adds no whitespace, which matches the
+	// JSON canonicalization of these simple values
+	data, _ := json.Marshal(contributing)
+	object["id"] = objType + "--" + stixUUIDv5(string(data))
+
+	return object
+}
+
+// stixUUIDv5 returns the version 5 UUID of name in the SCO namespace
+func stixUUIDv5(name string) string {
+	h := sha1.New()
+	h.Write(stixSCONamespace)
+	h.Write([]byte(name))
+	b := h.Sum(nil)[:16]
+	b[6] = (b[6] & 0x0f) | 0x50
+	b[8] = (b[8] & 0x3f) | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+func stixComparison(path, value string) string {
+	return fmt.Sprintf("%s = %s", path, stixQuote(value))
+}
+
+// stixQuote returns value as a STIX pattern string literal
+func stixQuote(value string) string {
+	value = strings.Replace(value, `\`, `\\`, -1)
+	return "'" + strings.Replace(value, `'`, `\'`, -1) + "'"
+}
+
+// stixQuoteKey quotes object path components holding a hyphen
+func stixQuoteKey(key string) string {
+	if strings.Contains(key, "-") {
+		return "'" + key + "'"
+	}
+	return key
+}
+
+func stixPatternString(observations []stixObservation) string {
+	expressions := make([]string, len(observations))
+	for i, observation := range observations {
+		expressions[i] = "[" + strings.Join(observation.comparisons, " AND ") + "]"
+	}
+	sort.Strings(expressions)
+	return strings.Join(expressions, " AND ")
+}
+
+// stixTime converts a MISP timestamp to the STIX format, falling back on the
+// given date and then on the current time
+func stixTime(timestamp, date string) string {
+	if ts, err := strconv.ParseInt(timestamp, 10, 64); err == nil && ts > 0 {
+		return time.Unix(ts, 0).UTC().Format(stixTimeFormat)
+	}
+	if t, err := time.Parse("2006-01-02", date); err == nil {
+		return t.UTC().Format(stixTimeFormat)
+	}
+	return time.Now().UTC().Format(stixTimeFormat)
+}
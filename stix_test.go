@@ -0,0 +1,268 @@
+package misp
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func Test_EventsToSTIX(t *testing.T) {
+	event, err := ReadEvent(strings.NewReader(testEventFile))
+	if err != nil {
+		t.Fatalf("ReadEvent returned error: %s", err)
+	}
+	event.Attribute = append(event.Attribute,
+		Attribute{UUID: "5a1b1d2e-0c54-4e2b-a1c7-000000000010", Type: TypeDomain, Category: CategoryNetworkActivity, Value: "evil.com"},
+		Attribute{UUID: "5a1b1d2e-0c54-4e2b-a1c7-000000000011", Type: TypeVulnerability, Category: CategoryExternalAnalysis, Value: "CVE-2017-0199"},
+		Attribute{UUID: "5a1b1d2e-0c54-4e2b-a1c7-000000000012", Type: TypeText, Category: CategoryOther, Value: "free text"},
+		// Malformed composite value, without the separator
+		Attribute{UUID: "5a1b1d2e-0c54-4e2b-a1c7-000000000013", Type: TypeDomainIP, Category: CategoryNetworkActivity, Value: "evil.com", ToIDS: true},
+	)
+
+	bundle := EventsToSTIX([]Event{*event})
+
+	byID := make(map[string]STIXObject)
+	for _, object := range bundle.Objects {
+		if _, ok := byID[object.ID()]; ok {
+			t.Errorf("Duplicate object %s", object.ID())
+		}
+		byID[object.ID()] = object
+	}
+
+	report := byID["report--58b9864a-b6ec-4fa6-a5e6-4a9a0a3ac101"]
+	if report == nil {
+		t.Fatalf("No report for the event")
+	}
+	if report.String("name") != event.Info || report.String("created_by_ref") != "identity--5a1b1d2e-0c54-4e2b-a1c7-000000000002" {
+		t.Errorf("Unexpected report %v", report)
+	}
+	for _, ref := range report.Strings("object_refs") {
+		if byID[ref] == nil {
+			t.Errorf("Report references missing object %s", ref)
+		}
+	}
+	if markings := report.Strings("object_marking_refs"); len(markings) != 1 || markings[0] != "marking-definition--34098fce-860f-48ae-8e50-ebd3cc5e41da" {
+		t.Errorf("Unexpected report markings %v", markings)
+	}
+
+	indicator := byID["indicator--58b98766-73cc-437f-a814-4a9a0a3ac101"]
+	if want := "[file:name = 'invoice.exe' AND file:hashes.MD5 = '68b329da9893e34099c7d8ad5cb9c940']"; indicator.String("pattern") != want {
+		t.Errorf("Expected pattern %s, got %s", want, indicator.String("pattern"))
+	}
+	if markings := indicator.Strings("object_marking_refs"); len(markings) != 1 || markings[0] != "marking-definition--f88d31f6-486f-44da-b317-01333bde0b82" {
+		t.Errorf("Unexpected indicator markings %v", markings)
+	}
+
+	object := byID["indicator--5a1b1d2e-0c54-4e2b-a1c7-000000000004"]
+	if want := "[domain-name:value = 'evil.com'] AND [network-traffic:dst_ref.type = 'ipv4-addr' AND network-traffic:dst_ref.value = '203.0.113.7']"; object.String("pattern") != want {
+		t.Errorf("Expected pattern %s, got %s", want, object.String("pattern"))
+	}
+
+	observed := byID["observed-data--5a1b1d2e-0c54-4e2b-a1c7-000000000010"]
+	refs := observed.Strings("object_refs")
+	if len(refs) != 1 || byID[refs[0]].String("value") != "evil.com" {
+		t.Errorf("Unexpected observed-data %v", observed)
+	}
+
+	if byID["vulnerability--5a1b1d2e-0c54-4e2b-a1c7-000000000011"] == nil {
+		t.Errorf("No vulnerability")
+	}
+	if byID["x-misp-attribute--5a1b1d2e-0c54-4e2b-a1c7-000000000012"] == nil {
+		t.Errorf("No custom attribute")
+	}
+	if byID["x-misp-attribute--5a1b1d2e-0c54-4e2b-a1c7-000000000013"] == nil {
+		t.Errorf("No custom attribute for the malformed composite value")
+	}
+
+	actor := byID["threat-actor--7cdff317-a673-4474-84ec-4f1754947823"]
+	if actor.String("name") != "APT28" || len(actor.Strings("aliases")) != 2 {
+		t.Errorf("Unexpected threat-actor %v", actor)
+	}
+
+	found := false
+	for _, object := range bundle.Objects {
+		if object.Type() == "relationship" && object.String("source_ref") == "indicator--5a1b1d2e-0c54-4e2b-a1c7-000000000004" &&
+			object.String("target_ref") == "indicator--58b98766-73cc-437f-a814-4a9a0a3ac101" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("No relationship for the object reference")
+	}
+
+	var buf bytes.Buffer
+	if err = bundle.Write(&buf); err != nil {
+		t.Fatalf("Write returned error: %s", err)
+	}
+	var decoded STIXBundle
+	if err = json.Unmarshal(buf.Bytes(), &decoded); err != nil || len(decoded.Objects) != len(bundle.Objects) {
+		t.Errorf("Could not decode written bundle: %v", err)
+	}
+}
+
+func Test_EventsToSTIXEdgeCases(t *testing.T) {
+	empty := Event{UUID: "5a1b1d2e-0c54-4e2b-a1c7-000000000020", Info: "Empty"}
+	galaxy := Galaxy{Type: "tool", Name: "Tool", Clusters: []GalaxyCluster{{Value: "Mimikatz", TagName: `misp-galaxy:tool="Mimikatz"`}}}
+	event := Event{
+		UUID:     "5a1b1d2e-0c54-4e2b-a1c7-000000000021",
+		Info:     "Edge cases",
+		Galaxies: []Galaxy{galaxy},
+		Attribute: []Attribute{
+			{UUID: "5a1b1d2e-0c54-4e2b-a1c7-000000000022", Type: TypeIPDst, Category: CategoryNetworkActivity, Value: "999.1.1.1", ToIDS: true, Galaxies: []Galaxy{galaxy}},
+			{UUID: "5a1b1d2e-0c54-4e2b-a1c7-000000000023", Type: TypeDomainIP, Category: CategoryNetworkActivity, Value: "evil.com|not-an-ip"},
+		},
+		Objects: []Object{{
+			UUID: "5a1b1d2e-0c54-4e2b-a1c7-000000000024", Name: "domain-ip", MetaCategory: "network",
+			Attributes: []Attribute{
+				{ObjectRelation: "domain", Type: TypeDomain, Value: "evil.com"},
+				{ObjectRelation: "text", Type: TypeText, Value: "hosted on a bulletproof provider"},
+			},
+		}},
+	}
+
+	bundle := EventsToSTIX([]Event{empty, event})
+	byID := make(map[string]STIXObject)
+	var tools, custom []STIXObject
+	for _, object := range bundle.Objects {
+		byID[object.ID()] = object
+		switch object.Type() {
+		case "tool":
+			tools = append(tools, object)
+		case "x-misp-object":
+			custom = append(custom, object)
+		}
+	}
+
+	if report := byID["report--5a1b1d2e-0c54-4e2b-a1c7-000000000020"]; report == nil || report["object_refs"] != nil {
+		t.Errorf("Unexpected report %v", report)
+	}
+
+	if len(tools) != 1 || tools[0].ID() != "tool--"+stixUUIDv5(`misp-galaxy:tool="Mimikatz"`) {
+		t.Errorf("Unexpected tools %v", tools)
+	}
+
+	for _, uuid := range []string{"5a1b1d2e-0c54-4e2b-a1c7-000000000022", "5a1b1d2e-0c54-4e2b-a1c7-000000000023"} {
+		if byID["x-misp-attribute--"+uuid] == nil {
+			t.Errorf("Invalid IP address of %s not exported as a custom attribute", uuid)
+		}
+	}
+	for _, object := range bundle.Objects {
+		if object.Type() == "ipv4-addr" || object.Type() == "ipv6-addr" {
+			t.Errorf("Unexpected %v", object)
+		}
+	}
+
+	if byID["observed-data--5a1b1d2e-0c54-4e2b-a1c7-000000000024"] == nil || len(custom) != 1 {
+		t.Fatalf("Unexpected custom objects %v", custom)
+	}
+	attrs, _ := custom[0]["x_misp_attributes"].([]map[string]string)
+	if len(attrs) != 1 || attrs[0]["object_relation"] != "text" {
+		t.Errorf("Unexpected unmapped attributes %v", custom[0])
+	}
+	report := byID["report--5a1b1d2e-0c54-4e2b-a1c7-000000000021"]
+	if !containsString(report.Strings("object_refs"), custom[0].ID()) {
+		t.Errorf("Report does not reference %s", custom[0].ID())
+	}
+}
+
+func Test_STIXSCOIdentifier(t *testing.T) {
+	// UUIDv5 of {"value":"198.51.100.3"} in the SCO namespace
+	sco := newSCO("ipv4-addr", map[string]interface{}{"value": "198.51.100.3"})
+	if sco.ID() != "ipv4-addr--28bb3599-77cd-5a82-a950-b5bc3caf07c4" {
+		t.Errorf("Unexpected identifier %s", sco.ID())
+	}
+}
+
+func Test_STIXToEvent(t *testing.T) {
+	original, err := ReadEvent(strings.NewReader(testEventFile))
+	if err != nil {
+		t.Fatalf("ReadEvent returned error: %s", err)
+	}
+	original.Attribute = append(original.Attribute,
+		Attribute{UUID: "5a1b1d2e-0c54-4e2b-a1c7-000000000010", Type: TypeHostname, Category: CategoryNetworkActivity, Value: "www.evil.com"},
+	)
+
+	var buf bytes.Buffer
+	EventsToSTIX([]Event{*original}).Write(&buf)
+	bundle, err := ReadSTIXBundle(&buf)
+	if err != nil {
+		t.Fatalf("ReadSTIXBundle returned error: %s", err)
+	}
+	bundle.Objects = append(bundle.Objects,
+		STIXObject{"type": "indicator", "id": "indicator--5a1b1d2e-0c54-4e2b-a1c7-000000000020", "pattern_type": "stix",
+			"pattern": "[url:value = 'http://a.example/x' OR url:value = 'http://b.example/y']"},
+		STIXObject{"type": "campaign", "id": "campaign--5a1b1d2e-0c54-4e2b-a1c7-000000000021", "name": "Operation"},
+	)
+
+	event, unmapped := STIXToEvent(bundle)
+
+	if len(unmapped) != 1 || unmapped[0].Type() != "campaign" {
+		t.Errorf("Unexpected unmapped objects %v", unmapped)
+	}
+	if event.UUID != original.UUID || event.Info != original.Info || event.Date != original.Date || event.Orgc.Name != "Partner" {
+		t.Errorf("Unexpected event %+v", event)
+	}
+	if len(event.Tags) != 1 || event.Tags[0].Name != "tlp:green" {
+		t.Errorf("Unexpected event tags %v", event.Tags)
+	}
+
+	want := map[string]string{
+		"58b98766-73cc-437f-a814-4a9a0a3ac101": "filename|md5=invoice.exe|68b329da9893e34099c7d8ad5cb9c940",
+		"5a1b1d2e-0c54-4e2b-a1c7-000000000010": "hostname=www.evil.com",
+		"5a1b1d2e-0c54-4e2b-a1c7-000000000020": "stix2-pattern=[url:value = 'http://a.example/x' OR url:value = 'http://b.example/y']",
+	}
+	if len(event.Attribute) != len(want) {
+		t.Errorf("Expected %d attributes, got %d", len(want), len(event.Attribute))
+	}
+	for _, attr := range event.Attribute {
+		if got := attr.Type + "=" + attr.Value; got != want[attr.UUID] {
+			t.Errorf("Attribute %s: expected %s, got %s", attr.UUID, want[attr.UUID], got)
+		}
+	}
+	if attr := event.Attribute[0]; !attr.ToIDS || attr.Category != CategoryPayloadDelivery || len(attr.Tags) != 1 || attr.Tags[0].Name != "tlp:amber" {
+		t.Errorf("Unexpected attribute %+v", attr)
+	}
+
+	if len(event.Objects) != 1 {
+		t.Fatalf("Expected 1 object, got %d", len(event.Objects))
+	}
+	object := event.Objects[0]
+	if object.Name != "domain-ip" || len(object.GetAttributes("domain")) != 1 || len(object.GetAttributes("ip-dst")) != 1 {
+		t.Errorf("Unexpected object %+v", object)
+	}
+	if len(object.References) != 1 || object.References[0].ReferencedUUID != "58b98766-73cc-437f-a814-4a9a0a3ac101" {
+		t.Errorf("Unexpected references %+v", object.References)
+	}
+
+	if len(event.Galaxies) != 1 || event.Galaxies[0].Clusters[0].Value != "APT28" {
+		t.Errorf("Unexpected galaxies %+v", event.Galaxies)
+	}
+}
+
+func Test_parseSTIXPattern(t *testing.T) {
+	observations, err := parseSTIXPattern(`[file:hashes.'SHA-256' = 'ab\'c' AND file:name = 'a.exe'] AND ([domain-name:value = 'evil.com'])`)
+	if err != nil {
+		t.Fatalf("parseSTIXPattern returned error: %s", err)
+	}
+	if len(observations) != 2 || len(observations[0]) != 2 || observations[0][0].path != "file:hashes.'SHA-256'" ||
+		observations[0][0].value != "ab'c" || observations[1][0].value != "evil.com" {
+		t.Errorf("Unexpected observations %+v", observations)
+	}
+
+	for _, pattern := range []string{
+		"[file:size > 1000]",
+		"[ipv4-addr:value IN ('1.2.3.4', '5.6.7.8')]",
+		"[url:value = 'http://a.example/'] WITHIN 60 SECONDS",
+		"[process:name NOT = 'a.exe'] FOLLOWEDBY [mutex:name = 'm']",
+	} {
+		observations, err = parseSTIXPattern(pattern)
+		if err != nil || observations != nil {
+			t.Errorf("%s: expected no observations, got %v, %v", pattern, observations, err)
+		}
+	}
+
+	if _, err = parseSTIXPattern("[file:name = 'a.exe'"); err == nil {
+		t.Errorf("parseSTIXPattern accepted an invalid pattern")
+	}
+}
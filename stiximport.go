@@ -0,0 +1,1048 @@
+package misp
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ReadSTIXBundle decodes a STIX 2.1 bundle
+func ReadSTIXBundle(r io.Reader) (*STIXBundle, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading STIX bundle: %s", err)
+	}
+
+	var bundle STIXBundle
+	if err = json.Unmarshal(data, &bundle); err != nil {
+		return nil, fmt.Errorf("Could not unmarshal STIX bundle: %s", err)
+	}
+	if bundle.Type != "bundle" {
+		return nil, fmt.Errorf("Not a STIX bundle: type %q", bundle.Type)
+	}
+
+	return &bundle, nil
+}
+
+// stixPathMapping is the MISP attribute type and object relation of a STIX
+// object path
+type stixPathMapping struct {
+	attrType string
+	relation string
+}
+
+// stixPathMappings maps the object paths of STIX patterns, with quotes
+// removed, to MISP attributes. Hashes are handled separately.
+var stixPathMappings = map[string]stixPathMapping{
+	"file:name":                                       {TypeFilename, "filename"},
+	"file:size":                                       {TypeSizeInBytes, "size-in-bytes"},
+	"domain-name:value":                               {TypeDomain, "domain"},
+	"domain-name:resolves_to_refs[*].value":           {TypeIPDst, "ip"},
+	"ipv4-addr:value":                                 {TypeIPDst, "ip"},
+	"ipv6-addr:value":                                 {TypeIPDst, "ip"},
+	"network-traffic:dst_ref.value":                   {TypeIPDst, "ip-dst"},
+	"network-traffic:src_ref.value":                   {TypeIPSrc, "ip-src"},
+	"network-traffic:dst_port":                        {TypePort, "dst-port"},
+	"network-traffic:src_port":                        {TypePort, "src-port"},
+	"url:value":                                       {TypeURL, "url"},
+	"email-addr:value":                                {TypeEmail, "email"},
+	"email-message:from_ref.value":                    {TypeEmailSrc, "from"},
+	"email-message:to_refs[*].value":                  {TypeEmailDst, "to"},
+	"email-message:cc_refs[*].value":                  {TypeEmailDst, "cc"},
+	"email-message:subject":                           {TypeEmailSubject, "subject"},
+	"email-message:additional_header_fields.reply_to": {TypeEmailReplyTo, "reply-to"},
+	"mutex:name":                                      {TypeMutex, "name"},
+	"windows-registry-key:key":                        {TypeRegkey, "key"},
+	"windows-registry-key:values[*].data":             {TypeText, "data"},
+	"autonomous-system:number":                        {TypeAS, "asn"},
+	"mac-addr:value":                                  {TypeMACAddress, "mac-address"},
+	"x509-certificate:serial_number":                  {TypeText, "serial-number"},
+	"network-traffic:extensions.http-request-ext.request_header.User-Agent": {TypeUserAgent, "user-agent"},
+}
+
+// stixCompositeRelations maps pairs of object relations to the composite type
+// holding both values, beside those named after the relations themselves like
+// filename|md5 or domain|ip
+var stixCompositeRelations = map[string]string{
+	"ip-dst|dst-port":   TypeIPDstPort,
+	"ip-src|src-port":   TypeIPSrcPort,
+	"hostname|dst-port": TypeHostnamePort,
+	"key|data":          TypeRegkeyValue,
+}
+
+// stixObjectNames maps STIX cyber-observable types to the MISP object
+// templates describing them
+var stixObjectNames = map[string]string{
+	"file":                 "file",
+	"domain-name":          "domain-ip",
+	"ipv4-addr":            "domain-ip",
+	"ipv6-addr":            "domain-ip",
+	"network-traffic":      "ip-port",
+	"url":                  "url",
+	"email-addr":           "email",
+	"email-message":        "email",
+	"windows-registry-key": "registry-key",
+	"x509-certificate":     "x509",
+	"autonomous-system":    "asn",
+	"mutex":                "mutex",
+}
+
+// stixGalaxyDefaults maps STIX domain object types to the MISP galaxy used
+// when the object does not carry its original galaxy
+var stixGalaxyDefaults = map[string]string{
+	"threat-actor":     "threat-actor",
+	"malware":          "mitre-malware",
+	"attack-pattern":   "mitre-attack-pattern",
+	"intrusion-set":    "mitre-intrusion-set",
+	"tool":             "mitre-tool",
+	"course-of-action": "mitre-course-of-action",
+}
+
+// stixEntry is an attribute value described by a STIX pattern or observable
+type stixEntry struct {
+	objType string
+	path    string
+	value   string
+}
+
+// stixImporter converts a bundle to an event, keeping track of the MISP
+// attribute, object or cluster produced from each STIX object
+type stixImporter struct {
+	objects    map[string]STIXObject
+	event      *Event
+	attributes map[string]int // STIX identifier -> index in event.Attribute
+	mispObjs   map[string]int // STIX identifier -> index in event.Objects
+	clusters   map[string]*GalaxyCluster
+	galaxies   map[string]int // galaxy type -> index in event.Galaxies
+	markings   map[string]string
+	handled    map[string]bool
+}
+
+// STIXToEvent converts a STIX 2.1 bundle to a MISP event, reversing the
+// misp-stix mapping used by EventsToSTIX and handling bundles produced by
+// other tools as well:
+//
+//   - reports and groupings give the event info, date and tags
+//   - indicators with STIX patterns become attributes flagged for IDS, or
+//     objects when the pattern describes several values. Patterns using
+//     other operators than AND and = are kept whole as stix2-pattern
+//     attributes, YARA, Snort and Sigma patterns as attributes of these types
+//   - observed-data become attributes or objects from their cyber-observables
+//   - vulnerabilities become vulnerability attributes, notes event reports
+//   - threat actors, malware, attack patterns, intrusion sets, tools and
+//     courses of action become galaxy clusters
+//   - relationships between objects become object references, and
+//     relationships to clusters attach them to the attributes
+//   - TLP marking definitions become tlp tags
+//
+// The STIX objects that could not be mapped are returned along with the event.
+func STIXToEvent(bundle *STIXBundle) (*Event, []STIXObject) {
+	im := &stixImporter{
+		objects:    make(map[string]STIXObject),
+		event:      &Event{},
+		attributes: make(map[string]int),
+		mispObjs:   make(map[string]int),
+		clusters:   make(map[string]*GalaxyCluster),
+		galaxies:   make(map[string]int),
+		markings:   make(map[string]string),
+		handled:    make(map[string]bool),
+	}
+	for _, object := range bundle.Objects {
+		im.objects[object.ID()] = object
+	}
+
+	for _, object := range bundle.Objects {
+		if object.Type() == "marking-definition" {
+			im.importMarking(object)
+		}
+	}
+
+	for _, object := range bundle.Objects {
+		switch object.Type() {
+		case "indicator":
+			im.importIndicator(object)
+		case "observed-data":
+			im.importObservedData(object)
+		case "vulnerability":
+			im.addAttribute(object, Attribute{Type: TypeVulnerability, Value: object.String("name")})
+		case "x-misp-attribute":
+			im.addAttribute(object, Attribute{
+				Type:     object.String("x_misp_type"),
+				Category: object.String("x_misp_category"),
+				Value:    object.String("x_misp_value"),
+			})
+		case "x-misp-object":
+			im.importCustomObject(object)
+		case "note":
+			im.importNote(object)
+		case "threat-actor", "malware", "attack-pattern", "intrusion-set", "tool", "course-of-action", "x-misp-galaxy-cluster":
+			im.importCluster(object)
+		}
+	}
+
+	// Reports and relationships refer to the objects imported above
+	for _, object := range bundle.Objects {
+		switch object.Type() {
+		case "report", "grouping":
+			im.importReport(object)
+		case "relationship":
+			im.importRelationship(object)
+		case "identity", "marking-definition", "extension-definition", "language-content":
+			im.handled[object.ID()] = true
+		}
+	}
+
+	im.finishEvent()
+
+	// Cyber-observables are handled with the observed-data referencing them
+	var unmapped []STIXObject
+	for _, object := range bundle.Objects {
+		if !im.handled[object.ID()] && stixSCOIDProperties[object.Type()] == nil {
+			unmapped = append(unmapped, object)
+		}
+	}
+
+	return im.event, unmapped
+}
+
+func (im *stixImporter) importMarking(object STIXObject) {
+	definition, _ := object["definition"].(map[string]interface{})
+	if tlp, ok := definition["tlp"].(string); ok {
+		im.markings[object.ID()] = "tlp:" + strings.ToLower(tlp)
+		return
+	}
+	name := strings.ToLower(object.String("name"))
+	if strings.HasPrefix(name, "tlp:") {
+		im.markings[object.ID()] = name
+	}
+}
+
+// tags returns the tags of a STIX object: its markings and its labels which
+// are not MISP conversion hints
+func (im *stixImporter) tags(object STIXObject) []Tag {
+	var tags []Tag
+	for _, ref := range object.Strings("object_marking_refs") {
+		if name, ok := im.markings[ref]; ok {
+			tags = append(tags, Tag{Name: name})
+		}
+	}
+	for _, label := range object.Strings("labels") {
+		if strings.HasPrefix(label, "misp:") || label == "Threat-Report" {
+			continue
+		}
+		tags = append(tags, Tag{Name: label})
+	}
+	return tags
+}
+
+// stixLabel returns the value of a misp:key="value" label of the object
+func stixLabel(object STIXObject, key string) string {
+	prefix := "misp:" + key + "="
+	for _, label := range object.Strings("labels") {
+		if strings.HasPrefix(label, prefix) {
+			if value, err := strconv.Unquote(label[len(prefix):]); err == nil {
+				return value
+			}
+		}
+	}
+	return ""
+}
+
+// stixUUID returns the UUID part of a STIX identifier
+func stixUUID(id string) string {
+	if i := strings.Index(id, "--"); i >= 0 {
+		return id[i+2:]
+	}
+	return id
+}
+
+// mispTimestamp converts a STIX timestamp to a MISP one
+func mispTimestamp(value string) string {
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return ""
+	}
+	return strconv.FormatInt(t.Unix(), 10)
+}
+
+func (im *stixImporter) addAttribute(object STIXObject, attr Attribute) {
+	if attr.Value == "" || attr.Type == "" {
+		return
+	}
+
+	attr.UUID = stixUUID(object.ID())
+	attr.Timestamp = mispTimestamp(object.String("modified"))
+	attr.Comment = object.String("description")
+	attr.Tags = im.tags(object)
+	if attr.Category == "" {
+		attr.Category = stixLabel(object, "category")
+	}
+	if attr.Category == "" {
+		attr.Category = stixKillChainCategory(object)
+	}
+	DefaultDescribeTypes.ApplyDefaults(&attr)
+	attr.ToIDS = attr.ToIDS || object.Type() == "indicator"
+
+	im.attributes[object.ID()] = len(im.event.Attribute)
+	im.event.Attribute = append(im.event.Attribute, attr)
+	im.handled[object.ID()] = true
+}
+
+func stixKillChainCategory(object STIXObject) string {
+	phases, _ := object["kill_chain_phases"].([]interface{})
+	for _, phase := range phases {
+		if p, ok := phase.(map[string]interface{}); ok && p["kill_chain_name"] == "misp-category" {
+			category, _ := p["phase_name"].(string)
+			return category
+		}
+	}
+	return ""
+}
+
+func (im *stixImporter) importIndicator(object STIXObject) {
+	pattern := object.String("pattern")
+	patternType := object.String("pattern_type")
+
+	for attrType, stixType := range stixPatternTypes {
+		if stixType == patternType && stixType != "stix" {
+			im.addAttribute(object, Attribute{Type: attrType, Value: pattern})
+			return
+		}
+	}
+	if patternType != "" && patternType != "stix" {
+		return
+	}
+
+	observations, err := parseSTIXPattern(pattern)
+	if err != nil || observations == nil {
+		im.addAttribute(object, Attribute{Type: TypeSTIX2Pattern, Value: pattern})
+		return
+	}
+
+	var entries []stixEntry
+	for _, comparisons := range observations {
+		for _, comparison := range comparisons {
+			entries = append(entries, stixEntry{
+				objType: comparison.path[:strings.Index(comparison.path, ":")],
+				path:    comparison.path,
+				value:   comparison.value,
+			})
+		}
+	}
+
+	if !im.importEntries(object, entries, true) {
+		im.addAttribute(object, Attribute{Type: TypeSTIX2Pattern, Value: pattern})
+	}
+}
+
+func (im *stixImporter) importObservedData(object STIXObject) {
+	refs := object.Strings("object_refs")
+
+	// Observables referenced by another one, like the address of a network
+	// connection, are described as part of it
+	nested := make(map[string]bool)
+	for _, ref := range refs {
+		for key, value := range im.objects[ref] {
+			if strings.HasSuffix(key, "_ref") {
+				if id, ok := value.(string); ok {
+					nested[id] = true
+				}
+			} else if strings.HasSuffix(key, "_refs") {
+				for _, id := range im.objects[ref].Strings(key) {
+					nested[id] = true
+				}
+			}
+		}
+	}
+
+	var entries []stixEntry
+	for _, ref := range refs {
+		sco, ok := im.objects[ref]
+		if !ok || nested[ref] {
+			continue
+		}
+		// Properties without MISP equivalent are left out
+		for _, entry := range im.observableEntries(sco) {
+			if _, ok := entryMapping(entry, false); ok || strings.HasSuffix(entry.path, "_ref.type") {
+				entries = append(entries, entry)
+			}
+		}
+	}
+
+	if im.importEntries(object, entries, false) {
+		for _, ref := range refs {
+			im.handled[ref] = true
+		}
+	}
+}
+
+// observableEntries flattens a cyber-observable into the paths a pattern
+// would use to describe it
+func (im *stixImporter) observableEntries(sco STIXObject) []stixEntry {
+	objType := sco.Type()
+	var entries []stixEntry
+	add := func(path string, value interface{}) {
+		var s string
+		switch v := value.(type) {
+		case string:
+			s = v
+		case float64:
+			s = strconv.FormatFloat(v, 'f', -1, 64)
+		case int:
+			s = strconv.Itoa(v)
+		default:
+			return
+		}
+		entries = append(entries, stixEntry{objType: objType, path: objType + ":" + path, value: s})
+	}
+	ref := func(id string) STIXObject {
+		return im.objects[id]
+	}
+
+	keys := make([]string, 0, len(sco))
+	for key := range sco {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		value := sco[key]
+		switch key {
+		case "type", "id", "spec_version", "defanged", "object_marking_refs", "granular_markings", "extensions":
+			continue
+		case "hashes":
+			hashes, _ := value.(map[string]interface{})
+			names := make([]string, 0, len(hashes))
+			for name := range hashes {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				add("hashes."+name, hashes[name])
+			}
+		case "values":
+			values, _ := value.([]interface{})
+			for _, v := range values {
+				if m, ok := v.(map[string]interface{}); ok {
+					add("values[*].data", m["data"])
+				}
+			}
+		case "additional_header_fields":
+			fields, _ := value.(map[string]interface{})
+			for name, v := range fields {
+				if strings.EqualFold(name, "Reply-To") {
+					add("additional_header_fields.reply_to", v)
+				}
+			}
+		case "src_ref", "dst_ref", "from_ref":
+			id, _ := value.(string)
+			target := ref(id)
+			if objType == "network-traffic" && target.Type() == "domain-name" {
+				entries = append(entries, stixEntry{objType, objType + ":" + key + ".type", "domain-name"})
+			}
+			add(key+".value", target["value"])
+		case "to_refs", "cc_refs", "resolves_to_refs":
+			for _, id := range sco.Strings(key) {
+				add(key+"[*].value", ref(id)["value"])
+			}
+		default:
+			add(key, value)
+		}
+	}
+
+	// The domain of a connection is described before its port
+	sort.SliceStable(entries, func(i, j int) bool {
+		return strings.HasSuffix(entries[i].path, "_ref.value") && !strings.HasSuffix(entries[j].path, "_ref.value")
+	})
+
+	return entries
+}
+
+// entryMapping returns the MISP attribute type and object relation of an
+// entry, ok being false if it has no equivalent
+func entryMapping(entry stixEntry, hostname bool) (stixPathMapping, bool) {
+	path := strings.Replace(entry.path, "'", "", -1)
+
+	for _, prefix := range []string{"file:hashes.", "x509-certificate:hashes."} {
+		if !strings.HasPrefix(path, prefix) {
+			continue
+		}
+		algorithm := strings.ToLower(strings.Replace(path[len(prefix):], "-", "", -1))
+		for attrType, name := range stixHashNames {
+			if strings.ToLower(strings.Replace(name, "-", "", -1)) != algorithm {
+				continue
+			}
+			if prefix == "x509-certificate:hashes." {
+				attrType = "x509-fingerprint-" + attrType
+			}
+			return stixPathMapping{attrType, attrType}, true
+		}
+		return stixPathMapping{}, false
+	}
+
+	mapping, ok := stixPathMappings[path]
+	if ok && hostname && path == "network-traffic:dst_ref.value" {
+		mapping = stixPathMapping{TypeHostname, "hostname"}
+	}
+	return mapping, ok
+}
+
+// importEntries converts the values described by an indicator or observed-data
+// to an attribute, a composite attribute or an object. It returns false if
+// some value has no MISP equivalent.
+func (im *stixImporter) importEntries(object STIXObject, entries []stixEntry, toIDS bool) bool {
+	hostname := false
+	var mapped []stixEntry
+	var mappings []stixPathMapping
+	for _, entry := range entries {
+		path := strings.Replace(entry.path, "'", "", -1)
+		if strings.HasSuffix(path, "_ref.type") {
+			hostname = hostname || entry.value == "domain-name"
+			continue
+		}
+		mapping, ok := entryMapping(entry, hostname)
+		if !ok {
+			return false
+		}
+		mapped = append(mapped, entry)
+		mappings = append(mappings, mapping)
+	}
+	if len(mapped) == 0 {
+		return false
+	}
+
+	labelType := stixLabel(object, "type")
+	name := stixLabel(object, "name")
+
+	if len(mapped) == 1 && name == "" {
+		attrType := mappings[0].attrType
+		if labelType != "" && !IsCompositeType(labelType) {
+			attrType = labelType
+		}
+		im.addAttribute(object, Attribute{Type: attrType, Value: mapped[0].value, ToIDS: toIDS})
+		return true
+	}
+
+	if len(mapped) == 2 && name == "" {
+		relations := mappings[0].relation + "|" + mappings[1].relation
+		compositeType, ok := stixCompositeRelations[relations]
+		if !ok && DefaultDescribeTypes.IsValidType(relations) {
+			compositeType, ok = relations, true
+		}
+		if IsCompositeType(labelType) {
+			compositeType, ok = labelType, true
+		}
+		if ok {
+			im.addAttribute(object, Attribute{Type: compositeType, Value: mapped[0].value + "|" + mapped[1].value, ToIDS: toIDS})
+			return true
+		}
+	}
+
+	if name == "" {
+		name = stixObjectNames[mapped[0].objType]
+	}
+	if name == "" {
+		name = mapped[0].objType
+	}
+	misp := NewObject(name, stixLabel(object, "meta-category"))
+	misp.UUID = stixUUID(object.ID())
+	misp.Timestamp = mispTimestamp(object.String("modified"))
+	misp.Comment = object.String("description")
+	for i, entry := range mapped {
+		attr := misp.AddAttribute(mappings[i].relation, mappings[i].attrType, entry.value)
+		if attr != nil {
+			DefaultDescribeTypes.ApplyDefaults(attr)
+			attr.ToIDS = toIDS
+		}
+	}
+
+	im.mispObjs[object.ID()] = len(im.event.Objects)
+	im.event.Objects = append(im.event.Objects, *misp)
+	im.handled[object.ID()] = true
+	return true
+}
+
+func (im *stixImporter) importCustomObject(object STIXObject) {
+	misp := NewObject(object.String("x_misp_name"), object.String("x_misp_meta_category"))
+	misp.UUID = stixUUID(object.ID())
+	misp.Timestamp = mispTimestamp(object.String("modified"))
+	misp.Comment = object.String("description")
+
+	attrs, _ := object["x_misp_attributes"].([]interface{})
+	for _, a := range attrs {
+		m, _ := a.(map[string]interface{})
+		relation, _ := m["object_relation"].(string)
+		attrType, _ := m["type"].(string)
+		value, _ := m["value"].(string)
+		if attr := misp.AddAttribute(relation, attrType, value); attr != nil {
+			DefaultDescribeTypes.ApplyDefaults(attr)
+			attr.ToIDS = DefaultDescribeTypes.DefaultToIDS(attr.Type)
+		}
+	}
+
+	im.mispObjs[object.ID()] = len(im.event.Objects)
+	im.event.Objects = append(im.event.Objects, *misp)
+	im.handled[object.ID()] = true
+}
+
+func (im *stixImporter) importNote(object STIXObject) {
+	name := object.String("abstract")
+	if name == "" {
+		name = "STIX note"
+	}
+	im.event.EventReports = append(im.event.EventReports, EventReport{
+		UUID:      stixUUID(object.ID()),
+		Name:      name,
+		Content:   object.String("content"),
+		Timestamp: mispTimestamp(object.String("modified")),
+	})
+	im.handled[object.ID()] = true
+}
+
+func (im *stixImporter) importCluster(object STIXObject) {
+	galaxyType := stixLabel(object, "galaxy-type")
+	if galaxyType == "" {
+		galaxyType = object.String("x_misp_type")
+	}
+	if galaxyType == "" {
+		galaxyType = stixGalaxyDefaults[object.Type()]
+	}
+	galaxyName := stixLabel(object, "galaxy-name")
+	if galaxyName == "" {
+		galaxyName = galaxyType
+	}
+
+	i, ok := im.galaxies[galaxyType]
+	if !ok {
+		i = len(im.event.Galaxies)
+		im.galaxies[galaxyType] = i
+		im.event.Galaxies = append(im.event.Galaxies, Galaxy{
+			UUID: stixUUIDv5("galaxy" + galaxyType),
+			Name: galaxyName,
+			Type: galaxyType,
+		})
+	}
+
+	cluster := GalaxyCluster{
+		UUID:        stixUUID(object.ID()),
+		Type:        galaxyType,
+		Value:       object.String("name"),
+		TagName:     object.String("x_misp_tag_name"),
+		Description: object.String("description"),
+		Meta:        make(map[string]interface{}),
+	}
+	if cluster.TagName == "" {
+		cluster.TagName = fmt.Sprintf("misp-galaxy:%s=%q", galaxyType, cluster.Value)
+	}
+	if aliases := object.Strings("aliases"); len(aliases) > 0 {
+		cluster.Meta["synonyms"] = aliases
+	}
+	references, _ := object["external_references"].([]interface{})
+	for _, r := range references {
+		m, _ := r.(map[string]interface{})
+		if id, ok := m["external_id"].(string); ok {
+			cluster.Meta["external_id"] = []string{id}
+			break
+		}
+	}
+
+	galaxy := &im.event.Galaxies[i]
+	galaxy.Clusters = append(galaxy.Clusters, cluster)
+	im.clusters[object.ID()] = &cluster
+	im.handled[object.ID()] = true
+}
+
+func (im *stixImporter) importReport(object STIXObject) {
+	event := im.event
+	if event.UUID == "" {
+		event.UUID = stixUUID(object.ID())
+		event.Info = object.String("name")
+		event.Timestamp = mispTimestamp(object.String("modified"))
+		if published, err := time.Parse(time.RFC3339Nano, object.String("published")); err == nil {
+			event.Date = published.UTC().Format("2006-01-02")
+		}
+		if author, ok := im.objects[object.String("created_by_ref")]; ok {
+			event.Orgc = Org{Name: author.String("name"), UUID: stixUUID(author.ID())}
+		}
+	}
+	event.Tags = append(event.Tags, im.tags(object)...)
+	im.handled[object.ID()] = true
+}
+
+func (im *stixImporter) importRelationship(object STIXObject) {
+	source := object.String("source_ref")
+	target := object.String("target_ref")
+	relationshipType := object.String("relationship_type")
+
+	if cluster, ok := im.clusters[target]; ok {
+		if i, ok := im.attributes[source]; ok {
+			attr := &im.event.Attribute[i]
+			attr.Galaxies = append(attr.Galaxies, Galaxy{
+				UUID:     stixUUIDv5("galaxy" + cluster.Type),
+				Name:     cluster.Type,
+				Type:     cluster.Type,
+				Clusters: []GalaxyCluster{*cluster},
+			})
+			im.handled[object.ID()] = true
+			return
+		}
+	}
+
+	i, ok := im.mispObjs[source]
+	if !ok {
+		return
+	}
+	referenced := ""
+	if _, ok := im.attributes[target]; ok {
+		referenced = stixUUID(target)
+	} else if _, ok := im.mispObjs[target]; ok {
+		referenced = stixUUID(target)
+	}
+	if referenced == "" {
+		return
+	}
+
+	misp := &im.event.Objects[i]
+	misp.References = append(misp.References, ObjectReference{
+		UUID:             stixUUID(object.ID()),
+		ObjectUUID:       misp.UUID,
+		ReferencedUUID:   referenced,
+		RelationshipType: relationshipType,
+	})
+	im.handled[object.ID()] = true
+}
+
+// finishEvent fills the mandatory fields of events built from bundles without
+// report
+func (im *stixImporter) finishEvent() {
+	event := im.event
+	if event.UUID == "" {
+		event.UUID = newUUID()
+	}
+	if event.Info == "" {
+		event.Info = "STIX 2.1 import"
+	}
+	if event.Date == "" {
+		event.Date = time.Now().UTC().Format("2006-01-02")
+	}
+
+	seen := make(map[string]bool)
+	var tags []Tag
+	for _, tag := range event.Tags {
+		if !seen[tag.Name] {
+			seen[tag.Name] = true
+			tags = append(tags, tag)
+		}
+	}
+	event.Tags = tags
+}
+
+// stixPatternComparison is a comparison expression of a STIX pattern
+type stixPatternComparison struct {
+	path  string
+	value string
+}
+
+// stixPatternParser parses the subset of the STIX patterning language made of
+// equality comparisons joined with AND
+type stixPatternParser struct {
+	s   string
+	pos int
+}
+
+// parseSTIXPattern returns the comparisons of each observation expression of
+// a pattern. It returns nil without error for valid patterns using
+// operators, qualifiers or joins which cannot be expressed as MISP values.
+func parseSTIXPattern(pattern string) ([][]stixPatternComparison, error) {
+	p := &stixPatternParser{s: pattern}
+	observations, simple, err := p.observations()
+	if err != nil {
+		return nil, err
+	}
+	if p.skipSpaces(); p.pos != len(p.s) {
+		return nil, fmt.Errorf("Unexpected %q at offset %d", p.s[p.pos:], p.pos)
+	}
+	if !simple {
+		return nil, nil
+	}
+	return observations, nil
+}
+
+func (p *stixPatternParser) skipSpaces() {
+	for p.pos < len(p.s) && strings.ContainsRune(" \t\r\n", rune(p.s[p.pos])) {
+		p.pos++
+	}
+}
+
+// keyword consumes the given keyword if it comes next
+func (p *stixPatternParser) keyword(word string) bool {
+	p.skipSpaces()
+	end := p.pos + len(word)
+	if end > len(p.s) || !strings.EqualFold(p.s[p.pos:end], word) {
+		return false
+	}
+	if end < len(p.s) && isSTIXWordChar(p.s[end]) {
+		return false
+	}
+	p.pos = end
+	return true
+}
+
+func (p *stixPatternParser) char(c byte) bool {
+	p.skipSpaces()
+	if p.pos < len(p.s) && p.s[p.pos] == c {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func isSTIXWordChar(c byte) bool {
+	return c == '_' || c == '-' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// observations parses observation expressions joined with AND, OR or
+// FOLLOWEDBY, simple being false if anything else than AND is used
+func (p *stixPatternParser) observations() ([][]stixPatternComparison, bool, error) {
+	var result [][]stixPatternComparison
+	simple := true
+	for {
+		var observations [][]stixPatternComparison
+		var s bool
+		var err error
+		if p.char('(') {
+			observations, s, err = p.observations()
+			if err == nil && !p.char(')') {
+				err = fmt.Errorf("Missing ) at offset %d", p.pos)
+			}
+		} else if p.char('[') {
+			var comparisons []stixPatternComparison
+			comparisons, s, err = p.comparisons()
+			if err == nil && !p.char(']') {
+				err = fmt.Errorf("Missing ] at offset %d", p.pos)
+			}
+			observations = [][]stixPatternComparison{comparisons}
+		} else {
+			err = fmt.Errorf("Expected observation expression at offset %d", p.pos)
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		result = append(result, observations...)
+		simple = simple && s
+
+		qualified, err := p.qualifiers()
+		if err != nil {
+			return nil, false, err
+		}
+		simple = simple && !qualified
+
+		if p.keyword("AND") {
+			continue
+		}
+		if p.keyword("OR") || p.keyword("FOLLOWEDBY") {
+			simple = false
+			continue
+		}
+		return result, simple, nil
+	}
+}
+
+// qualifiers consumes the WITHIN, REPEATS and START/STOP qualifiers
+func (p *stixPatternParser) qualifiers() (bool, error) {
+	qualified := false
+	for {
+		switch {
+		case p.keyword("WITHIN"):
+			if _, err := p.literal(); err != nil {
+				return false, err
+			}
+			if !p.keyword("SECONDS") {
+				return false, fmt.Errorf("Expected SECONDS at offset %d", p.pos)
+			}
+		case p.keyword("REPEATS"):
+			if _, err := p.literal(); err != nil {
+				return false, err
+			}
+			if !p.keyword("TIMES") {
+				return false, fmt.Errorf("Expected TIMES at offset %d", p.pos)
+			}
+		case p.keyword("START"):
+			if _, err := p.literal(); err != nil {
+				return false, err
+			}
+			if !p.keyword("STOP") {
+				return false, fmt.Errorf("Expected STOP at offset %d", p.pos)
+			}
+			if _, err := p.literal(); err != nil {
+				return false, err
+			}
+		default:
+			return qualified, nil
+		}
+		qualified = true
+	}
+}
+
+// comparisons parses comparison expressions joined with AND or OR
+func (p *stixPatternParser) comparisons() ([]stixPatternComparison, bool, error) {
+	var result []stixPatternComparison
+	simple := true
+	for {
+		if p.char('(') {
+			comparisons, s, err := p.comparisons()
+			if err != nil {
+				return nil, false, err
+			}
+			if !p.char(')') {
+				return nil, false, fmt.Errorf("Missing ) at offset %d", p.pos)
+			}
+			result = append(result, comparisons...)
+			simple = simple && s
+		} else {
+			comparison, s, err := p.comparison()
+			if err != nil {
+				return nil, false, err
+			}
+			result = append(result, comparison)
+			simple = simple && s
+		}
+
+		if p.keyword("AND") {
+			continue
+		}
+		if p.keyword("OR") {
+			simple = false
+			continue
+		}
+		return result, simple, nil
+	}
+}
+
+func (p *stixPatternParser) comparison() (stixPatternComparison, bool, error) {
+	path, err := p.path()
+	if err != nil {
+		return stixPatternComparison{}, false, err
+	}
+
+	simple := !p.keyword("NOT")
+	p.skipSpaces()
+	op := ""
+	for _, candidate := range []string{"!=", "<=", ">=", "=", "<", ">"} {
+		if strings.HasPrefix(p.s[p.pos:], candidate) {
+			op = candidate
+			p.pos += len(candidate)
+			break
+		}
+	}
+	if op == "" {
+		for _, candidate := range []string{"IN", "LIKE", "MATCHES", "ISSUBSET", "ISSUPERSET"} {
+			if p.keyword(candidate) {
+				op = candidate
+				break
+			}
+		}
+	}
+	if op == "" {
+		return stixPatternComparison{}, false, fmt.Errorf("Expected comparison operator at offset %d", p.pos)
+	}
+	simple = simple && op == "="
+
+	var value string
+	if op == "IN" {
+		if !p.char('(') {
+			return stixPatternComparison{}, false, fmt.Errorf("Expected ( at offset %d", p.pos)
+		}
+		for {
+			if _, err = p.literal(); err != nil {
+				return stixPatternComparison{}, false, err
+			}
+			if !p.char(',') {
+				break
+			}
+		}
+		if !p.char(')') {
+			return stixPatternComparison{}, false, fmt.Errorf("Missing ) at offset %d", p.pos)
+		}
+	} else if value, err = p.literal(); err != nil {
+		return stixPatternComparison{}, false, err
+	}
+
+	return stixPatternComparison{path: path, value: value}, simple, nil
+}
+
+// path parses an object path like file:hashes.'SHA-256' or
+// domain-name:resolves_to_refs[*].value
+func (p *stixPatternParser) path() (string, error) {
+	p.skipSpaces()
+	start := p.pos
+	for p.pos < len(p.s) {
+		c := p.s[p.pos]
+		if isSTIXWordChar(c) || c == ':' || c == '.' || c == '*' {
+			p.pos++
+			continue
+		}
+
+		// Indexes and quoted keys are taken whole
+		var closing byte
+		switch c {
+		case '[':
+			closing = ']'
+		case '\'':
+			closing = '\''
+		}
+		if closing == 0 {
+			break
+		}
+		end := strings.IndexByte(p.s[p.pos+1:], closing)
+		if end < 0 {
+			return "", fmt.Errorf("Unterminated path at offset %d", p.pos)
+		}
+		p.pos += end + 2
+	}
+	path := p.s[start:p.pos]
+	if !strings.Contains(path, ":") {
+		return "", fmt.Errorf("Expected object path at offset %d", start)
+	}
+	return path, nil
+}
+
+// literal parses a string, binary, hexadecimal or timestamp literal, a
+// number or a boolean, and returns its value
+func (p *stixPatternParser) literal() (string, error) {
+	p.skipSpaces()
+	if p.pos < len(p.s) && strings.ContainsRune("thb", rune(p.s[p.pos])) && p.pos+1 < len(p.s) && p.s[p.pos+1] == '\'' {
+		p.pos++
+	}
+	if p.pos < len(p.s) && p.s[p.pos] == '\'' {
+		var value strings.Builder
+		for p.pos++; p.pos < len(p.s); p.pos++ {
+			c := p.s[p.pos]
+			if c == '\\' && p.pos+1 < len(p.s) {
+				p.pos++
+				value.WriteByte(p.s[p.pos])
+				continue
+			}
+			if c == '\'' {
+				p.pos++
+				return value.String(), nil
+			}
+			value.WriteByte(c)
+		}
+		return "", fmt.Errorf("Unterminated string")
+	}
+
+	start := p.pos
+	for p.pos < len(p.s) && (isSTIXWordChar(p.s[p.pos]) || p.s[p.pos] == '.' || p.s[p.pos] == '+') {
+		p.pos++
+	}
+	if start == p.pos {
+		return "", fmt.Errorf("Expected literal at offset %d", start)
+	}
+	return p.s[start:p.pos], nil
+}
@@ -0,0 +1,201 @@
+package misp
+
+// MISP attribute types, see DescribeTypes
+const (
+	TypeMD5                       = "md5"
+	TypeSHA1                      = "sha1"
+	TypeSHA256                    = "sha256"
+	TypeSHA224                    = "sha224"
+	TypeSHA384                    = "sha384"
+	TypeSHA512                    = "sha512"
+	TypeSHA512_224                = "sha512/224"
+	TypeSHA512_256                = "sha512/256"
+	TypeSHA3_224                  = "sha3-224"
+	TypeSHA3_256                  = "sha3-256"
+	TypeSHA3_384                  = "sha3-384"
+	TypeSHA3_512                  = "sha3-512"
+	TypeSSDeep                    = "ssdeep"
+	TypeImphash                   = "imphash"
+	TypeTelfhash                  = "telfhash"
+	TypeImpfuzzy                  = "impfuzzy"
+	TypeAuthentihash              = "authentihash"
+	TypeVHash                     = "vhash"
+	TypeCDHash                    = "cdhash"
+	TypePEHash                    = "pehash"
+	TypeTLSH                      = "tlsh"
+	TypeFilename                  = "filename"
+	TypeFilenameMD5               = "filename|md5"
+	TypeFilenameSHA1              = "filename|sha1"
+	TypeFilenameSHA256            = "filename|sha256"
+	TypeFilenameSHA224            = "filename|sha224"
+	TypeFilenameSHA384            = "filename|sha384"
+	TypeFilenameSHA512            = "filename|sha512"
+	TypeFilenameSHA512_224        = "filename|sha512/224"
+	TypeFilenameSHA512_256        = "filename|sha512/256"
+	TypeFilenameSHA3_224          = "filename|sha3-224"
+	TypeFilenameSHA3_256          = "filename|sha3-256"
+	TypeFilenameSHA3_384          = "filename|sha3-384"
+	TypeFilenameSHA3_512          = "filename|sha3-512"
+	TypeFilenameSSDeep            = "filename|ssdeep"
+	TypeFilenameImphash           = "filename|imphash"
+	TypeFilenameImpfuzzy          = "filename|impfuzzy"
+	TypeFilenameAuthentihash      = "filename|authentihash"
+	TypeFilenameVHash             = "filename|vhash"
+	TypeFilenamePEHash            = "filename|pehash"
+	TypeFilenameTLSH              = "filename|tlsh"
+	TypeIPSrc                     = "ip-src"
+	TypeIPDst                     = "ip-dst"
+	TypeIPSrcPort                 = "ip-src|port"
+	TypeIPDstPort                 = "ip-dst|port"
+	TypePort                      = "port"
+	TypeHostname                  = "hostname"
+	TypeHostnamePort              = "hostname|port"
+	TypeDomain                    = "domain"
+	TypeDomainIP                  = "domain|ip"
+	TypeMACAddress                = "mac-address"
+	TypeMACEUI64                  = "mac-eui-64"
+	TypeEmail                     = "email"
+	TypeEmailSrc                  = "email-src"
+	TypeEmailDst                  = "email-dst"
+	TypeEmailSubject              = "email-subject"
+	TypeEmailAttachment           = "email-attachment"
+	TypeEmailBody                 = "email-body"
+	TypeEmailDstDisplayName       = "email-dst-display-name"
+	TypeEmailSrcDisplayName       = "email-src-display-name"
+	TypeEmailHeader               = "email-header"
+	TypeEmailReplyTo              = "email-reply-to"
+	TypeEmailXMailer              = "email-x-mailer"
+	TypeEmailMIMEBoundary         = "email-mime-boundary"
+	TypeEmailThreadIndex          = "email-thread-index"
+	TypeEmailMessageID            = "email-message-id"
+	TypeEPPN                      = "eppn"
+	TypeURL                       = "url"
+	TypeURI                       = "uri"
+	TypeUserAgent                 = "user-agent"
+	TypeHTTPMethod                = "http-method"
+	TypeAS                        = "AS"
+	TypeSnort                     = "snort"
+	TypeBro                       = "bro"
+	TypeZeek                      = "zeek"
+	TypeCommunityID               = "community-id"
+	TypePatternInFile             = "pattern-in-file"
+	TypePatternInTraffic          = "pattern-in-traffic"
+	TypePatternInMemory           = "pattern-in-memory"
+	TypeFilenamePattern           = "filename-pattern"
+	TypePGPPublicKey              = "pgp-public-key"
+	TypePGPPrivateKey             = "pgp-private-key"
+	TypeSSHFingerprint            = "ssh-fingerprint"
+	TypeYara                      = "yara"
+	TypeSTIX2Pattern              = "stix2-pattern"
+	TypeSigma                     = "sigma"
+	TypeGene                      = "gene"
+	TypeKustoQuery                = "kusto-query"
+	TypeMIMEType                  = "mime-type"
+	TypeIdentityCardNumber        = "identity-card-number"
+	TypeCookie                    = "cookie"
+	TypeVulnerability             = "vulnerability"
+	TypeCPE                       = "cpe"
+	TypeWeakness                  = "weakness"
+	TypeAttachment                = "attachment"
+	TypeMalwareSample             = "malware-sample"
+	TypeLink                      = "link"
+	TypeComment                   = "comment"
+	TypeText                      = "text"
+	TypeHex                       = "hex"
+	TypeOther                     = "other"
+	TypeNamedPipe                 = "named pipe"
+	TypeMutex                     = "mutex"
+	TypeProcessState              = "process-state"
+	TypeTargetUser                = "target-user"
+	TypeTargetEmail               = "target-email"
+	TypeTargetMachine             = "target-machine"
+	TypeTargetOrg                 = "target-org"
+	TypeTargetLocation            = "target-location"
+	TypeTargetExternal            = "target-external"
+	TypeBTC                       = "btc"
+	TypeDash                      = "dash"
+	TypeXMR                       = "xmr"
+	TypeIBAN                      = "iban"
+	TypeBIC                       = "bic"
+	TypeBankAccountNr             = "bank-account-nr"
+	TypeABARTN                    = "aba-rtn"
+	TypeBIN                       = "bin"
+	TypeCCNumber                  = "cc-number"
+	TypePRTN                      = "prtn"
+	TypePhoneNumber               = "phone-number"
+	TypeThreatActor               = "threat-actor"
+	TypeCampaignName              = "campaign-name"
+	TypeCampaignID                = "campaign-id"
+	TypeMalwareType               = "malware-type"
+	TypeRegkey                    = "regkey"
+	TypeRegkeyValue               = "regkey|value"
+	TypeX509FingerprintSHA1       = "x509-fingerprint-sha1"
+	TypeX509FingerprintMD5        = "x509-fingerprint-md5"
+	TypeX509FingerprintSHA256     = "x509-fingerprint-sha256"
+	TypeDNSSOAEmail               = "dns-soa-email"
+	TypeSizeInBytes               = "size-in-bytes"
+	TypeCounter                   = "counter"
+	TypeDatetime                  = "datetime"
+	TypeFloat                     = "float"
+	TypeBoolean                   = "boolean"
+	TypeAnonymised                = "anonymised"
+	TypeWhoisRegistrantEmail      = "whois-registrant-email"
+	TypeWhoisRegistrantPhone      = "whois-registrant-phone"
+	TypeWhoisRegistrantName       = "whois-registrant-name"
+	TypeWhoisRegistrantOrg        = "whois-registrant-org"
+	TypeWhoisRegistrar            = "whois-registrar"
+	TypeWhoisCreationDate         = "whois-creation-date"
+	TypeGithubUsername            = "github-username"
+	TypeGithubRepository          = "github-repository"
+	TypeGithubOrganisation        = "github-organisation"
+	TypeJabberID                  = "jabber-id"
+	TypeTwitterID                 = "twitter-id"
+	TypeDKIM                      = "dkim"
+	TypeDKIMSignature             = "dkim-signature"
+	TypeFirstName                 = "first-name"
+	TypeMiddleName                = "middle-name"
+	TypeLastName                  = "last-name"
+	TypeFullName                  = "full-name"
+	TypeDateOfBirth               = "date-of-birth"
+	TypePlaceOfBirth              = "place-of-birth"
+	TypeGender                    = "gender"
+	TypePassportNumber            = "passport-number"
+	TypePassportCountry           = "passport-country"
+	TypePassportExpiration        = "passport-expiration"
+	TypeNationality               = "nationality"
+	TypeMobileApplicationID       = "mobile-application-id"
+	TypeChromeExtensionID         = "chrome-extension-id"
+	TypeAzureApplicationID        = "azure-application-id"
+	TypeCortex                    = "cortex"
+	TypeJA3FingerprintMD5         = "ja3-fingerprint-md5"
+	TypeJARMFingerprint           = "jarm-fingerprint"
+	TypeHASSHMD5                  = "hassh-md5"
+	TypeHASSHServerMD5            = "hasshserver-md5"
+	TypeFaviconMMH3               = "favicon-mmh3"
+	TypeDOMHash                   = "dom-hash"
+	TypeOnionAddress              = "onion-address"
+	TypePDB                       = "pdb"
+	TypeWindowsScheduledTask      = "windows-scheduled-task"
+	TypeWindowsServiceName        = "windows-service-name"
+	TypeWindowsServiceDisplayName = "windows-service-displayname"
+)
+
+// MISP attribute categories, see DescribeTypes
+const (
+	CategoryInternalReference    = "Internal reference"
+	CategoryTargetingData        = "Targeting data"
+	CategoryAntivirusDetection   = "Antivirus detection"
+	CategoryPayloadDelivery      = "Payload delivery"
+	CategoryArtifactsDropped     = "Artifacts dropped"
+	CategoryPayloadInstallation  = "Payload installation"
+	CategoryPersistenceMechanism = "Persistence mechanism"
+	CategoryNetworkActivity      = "Network activity"
+	CategoryPayloadType          = "Payload type"
+	CategoryAttribution          = "Attribution"
+	CategoryExternalAnalysis     = "External analysis"
+	CategoryFinancialFraud       = "Financial fraud"
+	CategorySupportTool          = "Support Tool"
+	CategorySocialNetwork        = "Social network"
+	CategoryPerson               = "Person"
+	CategoryOther                = "Other"
+)
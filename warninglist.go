@@ -0,0 +1,441 @@
+package misp
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Warninglist is a list of well-known values, such as public DNS resolvers or
+// popular domains, that are likely false positives when used as indicators.
+// It decodes both the misp-warninglists JSON format and the lists returned
+// by the server.
+type Warninglist struct {
+	ID                 string      `json:"id,omitempty"`
+	Name               string      `json:"name"`
+	Type               string      `json:"type"` // string, substring, hostname, cidr or regex
+	Description        string      `json:"description"`
+	Version            json.Number `json:"version,omitempty"`
+	Enabled            bool        `json:"enabled,omitempty"`
+	MatchingAttributes []string    `json:"matching_attributes,omitempty"`
+	List               []string    `json:"list,omitempty"`
+
+	// Server representation of the values and matching attributes
+	Entries []WarninglistEntry `json:"WarninglistEntry,omitempty"`
+	Types   []WarninglistType  `json:"WarninglistType,omitempty"`
+}
+
+// WarninglistEntry is a value of a warninglist, as returned by the server
+type WarninglistEntry struct {
+	ID            string `json:"id,omitempty"`
+	Value         string `json:"value"`
+	WarninglistID string `json:"warninglist_id,omitempty"`
+	Comment       string `json:"comment,omitempty"`
+}
+
+// WarninglistType is an attribute type a warninglist applies to, as returned
+// by the server
+type WarninglistType struct {
+	ID            string `json:"id,omitempty"`
+	Type          string `json:"type"`
+	WarninglistID string `json:"warninglist_id,omitempty"`
+}
+
+// WarninglistMatch tells which warninglist a value matched, and on which entry
+type WarninglistMatch struct {
+	ID      string `json:"id,omitempty"`
+	Name    string `json:"name"`
+	Matched string `json:"matched,omitempty"`
+}
+
+// Values returns the values of the warninglist, whichever format it was read from
+func (w *Warninglist) Values() []string {
+	if len(w.List) > 0 {
+		return w.List
+	}
+
+	values := make([]string, len(w.Entries))
+	for i, entry := range w.Entries {
+		values[i] = entry.Value
+	}
+	return values
+}
+
+// AttributeTypes returns the attribute types the warninglist applies to
+func (w *Warninglist) AttributeTypes() []string {
+	if len(w.MatchingAttributes) > 0 {
+		return w.MatchingAttributes
+	}
+
+	types := make([]string, len(w.Types))
+	for i, t := range w.Types {
+		types[i] = t.Type
+	}
+	return types
+}
+
+// GetWarninglists fetches the list of warninglists known by the server,
+// without their values
+func (client *Client) GetWarninglists() ([]Warninglist, error) {
+	type indexType struct {
+		Warninglists []struct {
+			Warninglist Warninglist `json:"Warninglist"`
+		} `json:"Warninglists"`
+	}
+
+	resp, err := client.Get("/warninglists/index", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var index indexType
+	decoder := json.NewDecoder(resp.Body)
+	if err = decoder.Decode(&index); err != nil {
+		return nil, fmt.Errorf("Could not unmarshal warninglists: %s", err)
+	}
+
+	lists := make([]Warninglist, len(index.Warninglists))
+	for i, list := range index.Warninglists {
+		lists[i] = list.Warninglist
+	}
+
+	return lists, nil
+}
+
+// GetWarninglist fetches a warninglist and its values
+func (client *Client) GetWarninglist(warninglistID string) (*Warninglist, error) {
+	type viewType struct {
+		Warninglist Warninglist `json:"Warninglist"`
+	}
+
+	path := fmt.Sprintf("/warninglists/view/%s", warninglistID)
+
+	resp, err := client.Get(path, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var view viewType
+	decoder := json.NewDecoder(resp.Body)
+	if err = decoder.Decode(&view); err != nil {
+		return nil, fmt.Errorf("Could not unmarshal warninglist: %s", err)
+	}
+
+	return &view.Warninglist, nil
+}
+
+// EnableWarninglist enables or disables a warninglist on the server
+func (client *Client) EnableWarninglist(warninglistID string, enabled bool) error {
+	type toggleRequest struct {
+		ID      string `json:"id"`
+		Enabled bool   `json:"enabled"`
+	}
+
+	resp, err := client.Post("/warninglists/toggleEnable", toggleRequest{
+		ID:      warninglistID,
+		Enabled: enabled,
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Saved   bool   `json:"saved"`
+		Errors  string `json:"errors"`
+		Success string `json:"success"`
+	}
+	decoder := json.NewDecoder(resp.Body)
+	if err = decoder.Decode(&result); err != nil {
+		return fmt.Errorf("Could not unmarshal response: %s", err)
+	}
+
+	if !result.Saved {
+		return fmt.Errorf("MISP returned an error: %s", result.Errors)
+	}
+
+	return nil
+}
+
+// CheckWarninglistValues asks the server which enabled warninglists the given
+// values match. Values matching no list are absent from the result.
+func (client *Client) CheckWarninglistValues(values []string) (map[string][]WarninglistMatch, error) {
+	resp, err := client.Post("/warninglists/checkValue", values)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// MISP returns an empty array rather than an empty object
+	var raw json.RawMessage
+	decoder := json.NewDecoder(resp.Body)
+	if err = decoder.Decode(&raw); err != nil {
+		return nil, fmt.Errorf("Could not unmarshal response: %s", err)
+	}
+
+	matches := make(map[string][]WarninglistMatch)
+	if err := json.Unmarshal(raw, &matches); err != nil {
+		var empty []interface{}
+		if err := json.Unmarshal(raw, &empty); err != nil {
+			return nil, fmt.Errorf("Response has unknown format: %s", raw)
+		}
+	}
+
+	return matches, nil
+}
+
+// LoadWarninglist reads a warninglist in the misp-warninglists JSON format
+func LoadWarninglist(filename string) (*Warninglist, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("Error opening %s: %s", filename, err)
+	}
+	defer f.Close()
+
+	var list Warninglist
+	decoder := json.NewDecoder(f)
+	if err = decoder.Decode(&list); err != nil {
+		return nil, fmt.Errorf("Could not unmarshal %s: %s", filename, err)
+	}
+
+	return &list, nil
+}
+
+// LoadWarninglists reads all the list.json files found under dir, typically a
+// checkout of https://github.com/MISP/misp-warninglists, and compiles them
+func LoadWarninglists(dir string) (*Warninglists, error) {
+	var lists []Warninglist
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || info.Name() != "list.json" {
+			return nil
+		}
+
+		list, err := LoadWarninglist(path)
+		if err != nil {
+			return err
+		}
+		lists = append(lists, *list)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return NewWarninglists(lists)
+}
+
+// Warninglists matches values locally against a set of warninglists
+type Warninglists struct {
+	lists []*compiledWarninglist
+}
+
+type compiledWarninglist struct {
+	list    *Warninglist
+	types   map[string]bool
+	values  map[string]bool
+	substrs []string
+	nets    []*net.IPNet
+	regexps []*regexp.Regexp
+}
+
+// NewWarninglists compiles the given warninglists for local matching
+func NewWarninglists(lists []Warninglist) (*Warninglists, error) {
+	result := &Warninglists{}
+
+	for i := range lists {
+		list := &lists[i]
+		compiled := &compiledWarninglist{
+			list:   list,
+			types:  make(map[string]bool),
+			values: make(map[string]bool),
+		}
+
+		for _, t := range list.AttributeTypes() {
+			compiled.types[t] = true
+		}
+
+		for _, value := range list.Values() {
+			switch list.Type {
+			case "cidr":
+				network, err := parseNetwork(value)
+				if err != nil {
+					return nil, fmt.Errorf("Invalid entry %q in warninglist %s: %s", value, list.Name, err)
+				}
+				compiled.nets = append(compiled.nets, network)
+			case "substring":
+				compiled.substrs = append(compiled.substrs, strings.ToLower(value))
+			case "regex":
+				re, err := compileWarninglistRegexp(value)
+				if err != nil {
+					return nil, fmt.Errorf("Invalid entry %q in warninglist %s: %s", value, list.Name, err)
+				}
+				compiled.regexps = append(compiled.regexps, re)
+			case "hostname":
+				compiled.values[strings.TrimSuffix(strings.ToLower(value), ".")] = true
+			default:
+				compiled.values[strings.ToLower(value)] = true
+			}
+		}
+
+		result.lists = append(result.lists, compiled)
+	}
+
+	return result, nil
+}
+
+// parseNetwork parses a CIDR block, or an IP address as a single host block
+func parseNetwork(value string) (*net.IPNet, error) {
+	if !strings.Contains(value, "/") {
+		ip := net.ParseIP(value)
+		if ip == nil {
+			return nil, fmt.Errorf("not an IP address")
+		}
+		bits := 128
+		if ip.To4() != nil {
+			ip, bits = ip.To4(), 32
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+	}
+
+	_, network, err := net.ParseCIDR(value)
+	return network, err
+}
+
+// compileWarninglistRegexp compiles a PCRE style "/pattern/flags" entry
+func compileWarninglistRegexp(value string) (*regexp.Regexp, error) {
+	if strings.HasPrefix(value, "/") {
+		if end := strings.LastIndex(value, "/"); end > 0 {
+			flags := value[end+1:]
+			value = value[1:end]
+			if strings.Contains(flags, "i") {
+				value = "(?i)" + value
+			}
+		}
+	}
+	return regexp.Compile(value)
+}
+
+// Check returns the warninglists matching the value of attr. Lists restricted
+// to some attribute types only apply to those, and each part of composite
+// values is checked on its own.
+func (w *Warninglists) Check(attr *Attribute) []WarninglistMatch {
+	values := []string{attr.Value}
+	if parts, err := attr.Composite(); err == nil {
+		values = append(values, parts...)
+	}
+
+	var matches []WarninglistMatch
+	for _, list := range w.lists {
+		if len(list.types) > 0 && !list.types[attr.Type] {
+			continue
+		}
+		for _, value := range values {
+			if matched, ok := list.match(value); ok {
+				matches = append(matches, WarninglistMatch{ID: list.list.ID, Name: list.list.Name, Matched: matched})
+				break
+			}
+		}
+	}
+
+	return matches
+}
+
+// CheckValue returns the warninglists matching value, regardless of the
+// attribute types they are restricted to
+func (w *Warninglists) CheckValue(value string) []WarninglistMatch {
+	var matches []WarninglistMatch
+	for _, list := range w.lists {
+		if matched, ok := list.match(value); ok {
+			matches = append(matches, WarninglistMatch{ID: list.list.ID, Name: list.list.Name, Matched: matched})
+		}
+	}
+	return matches
+}
+
+// Filter splits attrs into the attributes matching no warninglist and the
+// ones matching at least one
+func (w *Warninglists) Filter(attrs []Attribute) (kept, dropped []Attribute) {
+	for i := range attrs {
+		if len(w.Check(&attrs[i])) > 0 {
+			dropped = append(dropped, attrs[i])
+		} else {
+			kept = append(kept, attrs[i])
+		}
+	}
+	return kept, dropped
+}
+
+// match tells whether value matches an entry of the list, and which one
+func (l *compiledWarninglist) match(value string) (string, bool) {
+	value = strings.ToLower(strings.TrimSpace(value))
+
+	switch l.list.Type {
+	case "cidr":
+		ip := net.ParseIP(value)
+		if ip == nil {
+			network, err := parseNetwork(value)
+			if err != nil {
+				return "", false
+			}
+			ip = network.IP
+		}
+		for _, network := range l.nets {
+			if network.Contains(ip) {
+				return network.String(), true
+			}
+		}
+	case "substring":
+		for _, substr := range l.substrs {
+			if strings.Contains(value, substr) {
+				return substr, true
+			}
+		}
+	case "regex":
+		for _, re := range l.regexps {
+			if re.MatchString(value) {
+				return re.String(), true
+			}
+		}
+	case "hostname":
+		host := warninglistHostname(value)
+		for host != "" {
+			if l.values[host] {
+				return host, true
+			}
+			i := strings.Index(host, ".")
+			if i < 0 {
+				break
+			}
+			host = host[i+1:]
+		}
+	default:
+		if l.values[value] {
+			return value, true
+		}
+	}
+
+	return "", false
+}
+
+// warninglistHostname extracts the host name out of URLs and email addresses
+func warninglistHostname(value string) string {
+	if strings.Contains(value, "://") {
+		if u, err := url.Parse(value); err == nil {
+			return strings.TrimSuffix(u.Hostname(), ".")
+		}
+	}
+	if i := strings.LastIndex(value, "@"); i >= 0 {
+		value = value[i+1:]
+	}
+	return strings.TrimSuffix(value, ".")
+}
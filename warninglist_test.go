@@ -0,0 +1,104 @@
+package misp
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_LoadWarninglists(t *testing.T) {
+	dir, err := ioutil.TempDir("", "warninglists")
+	if err != nil {
+		t.Fatalf("TempDir returned error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	lists := map[string]string{
+		"public-dns-v4": `{"name": "List of known IPv4 public DNS resolvers", "type": "cidr", "version": 20210101, "matching_attributes": ["ip-src", "ip-dst", "domain|ip"], "list": ["8.8.8.8", "1.1.1.0/24"]}`,
+		"google":        `{"name": "Google domains", "type": "hostname", "version": 3, "matching_attributes": ["domain", "hostname", "url"], "list": ["google.com"]}`,
+		"rfc-paths":     `{"name": "Common paths", "type": "substring", "version": 1, "list": ["/wp-admin/"]}`,
+	}
+	for name, content := range lists {
+		if err := os.MkdirAll(filepath.Join(dir, "lists", name), 0755); err != nil {
+			t.Fatalf("MkdirAll returned error: %s", err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, "lists", name, "list.json"), []byte(content), 0644); err != nil {
+			t.Fatalf("WriteFile returned error: %s", err)
+		}
+	}
+
+	w, err := LoadWarninglists(dir)
+	if err != nil {
+		t.Fatalf("LoadWarninglists returned error: %s", err)
+	}
+
+	tests := []struct {
+		attr    Attribute
+		matches int
+	}{
+		{Attribute{Type: TypeIPDst, Value: "8.8.8.8"}, 1},
+		{Attribute{Type: TypeIPDst, Value: "1.1.1.1"}, 1},
+		{Attribute{Type: TypeIPDst, Value: "8.8.4.4"}, 0},
+		{Attribute{Type: TypeDomainIP, Value: "dns.google|8.8.8.8"}, 1},
+		{Attribute{Type: TypeHostname, Value: "8.8.8.8"}, 0},
+		{Attribute{Type: TypeHostname, Value: "mail.google.com"}, 1},
+		{Attribute{Type: TypeDomain, Value: "notgoogle.com"}, 0},
+		{Attribute{Type: TypeURL, Value: "https://www.google.com/wp-admin/"}, 2},
+		{Attribute{Type: TypeURL, Value: "https://evil.com/wp-admin/x.php"}, 1},
+	}
+
+	for _, test := range tests {
+		if got := w.Check(&test.attr); len(got) != test.matches {
+			t.Errorf("Check(%+v) returned %+v, want %d matches", test.attr, got, test.matches)
+		}
+	}
+
+	kept, dropped := w.Filter([]Attribute{tests[0].attr, tests[2].attr})
+	if len(kept) != 1 || len(dropped) != 1 || kept[0].Value != "8.8.4.4" {
+		t.Errorf("Filter returned kept=%+v dropped=%+v", kept, dropped)
+	}
+}
+
+func Test_CheckWarninglistValues(t *testing.T) {
+	setup()
+
+	mux.HandleFunc("/warninglists/checkValue",
+		func(w http.ResponseWriter, r *http.Request) {
+			testMethod(t, r, "POST")
+			fmt.Fprint(w, `{"8.8.8.8": [{"id": "12", "name": "List of known IPv4 public DNS resolvers", "matched": "8.8.8.8/32"}]}`)
+		})
+
+	matches, err := client.CheckWarninglistValues([]string{"8.8.8.8", "evil.com"})
+	if err != nil {
+		t.Fatalf("CheckWarninglistValues returned error: %s", err)
+	}
+	if len(matches) != 1 || matches["8.8.8.8"][0].ID != "12" {
+		t.Errorf("CheckWarninglistValues returned %+v", matches)
+	}
+}
+
+func Test_GetWarninglist(t *testing.T) {
+	setup()
+
+	mux.HandleFunc("/warninglists/view/12",
+		func(w http.ResponseWriter, r *http.Request) {
+			testMethod(t, r, "GET")
+			fmt.Fprint(w, `{"Warninglist": {"id": "12", "name": "List of known IPv4 public DNS resolvers", "type": "cidr", "version": "20210101", "enabled": true, "WarninglistEntry": [{"id": "1", "value": "8.8.8.8/32", "warninglist_id": "12"}], "WarninglistType": [{"id": "1", "type": "ip-dst", "warninglist_id": "12"}]}}`)
+		})
+
+	list, err := client.GetWarninglist("12")
+	if err != nil {
+		t.Fatalf("GetWarninglist returned error: %s", err)
+	}
+
+	w, err := NewWarninglists([]Warninglist{*list})
+	if err != nil {
+		t.Fatalf("NewWarninglists returned error: %s", err)
+	}
+	if got := w.Check(&Attribute{Type: TypeIPDst, Value: "8.8.8.8"}); len(got) != 1 || got[0].ID != "12" {
+		t.Errorf("Check returned %+v", got)
+	}
+}
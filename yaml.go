@@ -0,0 +1,502 @@
+package misp
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parseYAML parses the subset of YAML used by Sigma rules and similar
+// configuration files: block mappings and sequences, plain, quoted and block
+// scalars, flow sequences and mappings, and comments. Mappings are returned as
+// map[string]interface{}, sequences as []interface{} and scalars as strings,
+// without type resolution. Null values are nil. Anchors, aliases, tags and
+// multiple documents are not supported.
+func parseYAML(source string) (interface{}, error) {
+	p := &yamlParser{}
+	for i, raw := range strings.Split(strings.ReplaceAll(source, "\r\n", "\n"), "\n") {
+		if strings.HasPrefix(raw, "---") || strings.HasPrefix(raw, "...") {
+			if strings.TrimSpace(yamlStripComment(raw[3:])) == "" {
+				if raw[0] == '-' && p.content() {
+					return nil, fmt.Errorf("Line %d: multiple documents are not supported", i+1)
+				}
+				raw = ""
+			}
+		}
+		p.lines = append(p.lines, yamlLine{raw: raw, num: i + 1})
+	}
+	for i := range p.lines {
+		line := &p.lines[i]
+		text := yamlStripComment(line.raw)
+		line.text = strings.TrimLeft(text, " ")
+		line.indent = len(text) - len(line.text)
+		if strings.HasPrefix(line.text, "\t") {
+			return nil, fmt.Errorf("Line %d: tabs are not allowed in indentation", line.num)
+		}
+	}
+
+	line := p.next()
+	if line == nil {
+		return nil, nil
+	}
+	value, err := p.parseNode(line.indent)
+	if err != nil {
+		return nil, err
+	}
+	if line := p.next(); line != nil {
+		return nil, fmt.Errorf("Line %d: unexpected %q", line.num, line.text)
+	}
+	return value, nil
+}
+
+// yamlLine is a line of YAML source, without its comment
+type yamlLine struct {
+	raw    string
+	text   string
+	indent int
+	num    int
+}
+
+type yamlParser struct {
+	lines []yamlLine
+	pos   int
+}
+
+// content tells whether a non blank line was read
+func (p *yamlParser) content() bool {
+	for _, line := range p.lines {
+		if strings.TrimSpace(yamlStripComment(line.raw)) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// next returns the next non blank line without consuming it
+func (p *yamlParser) next() *yamlLine {
+	for ; p.pos < len(p.lines); p.pos++ {
+		if p.lines[p.pos].text != "" {
+			return &p.lines[p.pos]
+		}
+	}
+	return nil
+}
+
+// parseNode parses the node starting at the next line, indented by indent
+func (p *yamlParser) parseNode(indent int) (interface{}, error) {
+	line := p.next()
+	if line == nil || line.indent < indent {
+		return nil, nil
+	}
+
+	if line.text == "-" || strings.HasPrefix(line.text, "- ") {
+		return p.parseSequence(line.indent)
+	}
+	if _, _, ok := yamlSplitKey(line.text); ok {
+		return p.parseMapping(line.indent)
+	}
+
+	p.pos++
+	return p.parseValue(line, line.text, indent-1)
+}
+
+func (p *yamlParser) parseMapping(indent int) (interface{}, error) {
+	mapping := make(map[string]interface{})
+	for {
+		line := p.next()
+		if line == nil || line.indent < indent {
+			return mapping, nil
+		}
+		if line.indent > indent {
+			return nil, fmt.Errorf("Line %d: bad indentation", line.num)
+		}
+
+		key, rest, ok := yamlSplitKey(line.text)
+		if !ok {
+			return nil, fmt.Errorf("Line %d: expected a mapping key, got %q", line.num, line.text)
+		}
+		if _, ok := mapping[key]; ok {
+			return nil, fmt.Errorf("Line %d: duplicate key %q", line.num, key)
+		}
+		p.pos++
+
+		var value interface{}
+		var err error
+		if rest == "" {
+			// Sequences may be indented as much as their key
+			if next := p.next(); next != nil && next.indent == indent && (next.text == "-" || strings.HasPrefix(next.text, "- ")) {
+				value, err = p.parseSequence(indent)
+			} else {
+				value, err = p.parseNode(indent + 1)
+			}
+		} else {
+			value, err = p.parseValue(line, rest, indent)
+		}
+		if err != nil {
+			return nil, err
+		}
+		mapping[key] = value
+	}
+}
+
+func (p *yamlParser) parseSequence(indent int) (interface{}, error) {
+	sequence := []interface{}{}
+	for {
+		line := p.next()
+		if line == nil || line.indent < indent {
+			return sequence, nil
+		}
+		if line.indent > indent {
+			return nil, fmt.Errorf("Line %d: bad indentation", line.num)
+		}
+		if line.text != "-" && !strings.HasPrefix(line.text, "- ") {
+			return sequence, nil
+		}
+
+		rest := strings.TrimLeft(line.text[1:], " ")
+		var value interface{}
+		var err error
+		switch {
+		case rest == "":
+			p.pos++
+			value, err = p.parseNode(indent + 1)
+		case rest == "-" || strings.HasPrefix(rest, "- "):
+			// Nested sequence, parsed from the position of its first dash
+			line.indent += len(line.text) - len(rest)
+			line.text = rest
+			value, err = p.parseSequence(line.indent)
+		default:
+			if _, _, ok := yamlSplitKey(rest); ok {
+				// Mapping starting on the line of the dash
+				line.indent += len(line.text) - len(rest)
+				line.text = rest
+				value, err = p.parseMapping(line.indent)
+			} else {
+				p.pos++
+				value, err = p.parseValue(line, rest, indent)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		sequence = append(sequence, value)
+	}
+}
+
+// parseValue parses the scalar or flow collection value found on line, after
+// the key or dash of a node indented by indent. Block scalars and plain
+// scalars continued on more indented lines are read from the following lines.
+func (p *yamlParser) parseValue(line *yamlLine, value string, indent int) (interface{}, error) {
+	switch value[0] {
+	case '|', '>':
+		return p.parseBlockScalar(line, value, indent)
+	case '[', '{':
+		// Flow collections may span several lines
+		for !yamlFlowClosed(value) {
+			if p.pos >= len(p.lines) {
+				return nil, fmt.Errorf("Line %d: unterminated flow collection", line.num)
+			}
+			value += " " + strings.TrimSpace(p.lines[p.pos].text)
+			p.pos++
+		}
+		result, rest, err := parseYAMLFlow(value)
+		if err != nil {
+			return nil, fmt.Errorf("Line %d: %s", line.num, err)
+		}
+		if strings.TrimSpace(rest) != "" {
+			return nil, fmt.Errorf("Line %d: unexpected %q after flow collection", line.num, rest)
+		}
+		return result, nil
+	case '"', '\'':
+		result, rest, err := yamlUnquote(value)
+		if err != nil {
+			return nil, fmt.Errorf("Line %d: %s", line.num, err)
+		}
+		if strings.TrimSpace(rest) != "" {
+			return nil, fmt.Errorf("Line %d: unexpected %q after quoted scalar", line.num, rest)
+		}
+		return result, nil
+	case '&', '*', '!':
+		return nil, fmt.Errorf("Line %d: anchors, aliases and tags are not supported", line.num)
+	}
+
+	// Plain scalars folded over more indented lines
+	for {
+		next := p.next()
+		if next == nil || next.indent <= indent {
+			break
+		}
+		if _, _, ok := yamlSplitKey(next.text); ok {
+			return nil, fmt.Errorf("Line %d: bad indentation", next.num)
+		}
+		value += " " + next.text
+		p.pos++
+	}
+	if value == "~" || value == "null" || value == "Null" || value == "NULL" {
+		return nil, nil
+	}
+	return value, nil
+}
+
+func (p *yamlParser) parseBlockScalar(line *yamlLine, header string, indent int) (interface{}, error) {
+	folded := header[0] == '>'
+	chomping := byte(0)
+	for _, c := range []byte(header[1:]) {
+		switch {
+		case c == '-' || c == '+':
+			chomping = c
+		case c >= '1' && c <= '9':
+			return nil, fmt.Errorf("Line %d: block indentation indicators are not supported", line.num)
+		case c != ' ':
+			return nil, fmt.Errorf("Line %d: invalid block scalar header %q", line.num, header)
+		}
+	}
+
+	// The content of the scalar is raw text, comments included
+	var lines []string
+	blockIndent := -1
+	for ; p.pos < len(p.lines); p.pos++ {
+		raw := strings.TrimRight(p.lines[p.pos].raw, " ")
+		content := strings.TrimLeft(raw, " ")
+		if content == "" {
+			lines = append(lines, "")
+			continue
+		}
+		lineIndent := len(raw) - len(content)
+		if blockIndent < 0 {
+			if lineIndent <= indent {
+				break
+			}
+			blockIndent = lineIndent
+		}
+		if lineIndent < blockIndent {
+			break
+		}
+		lines = append(lines, raw[blockIndent:])
+	}
+
+	// Trailing blank lines belong to the scalar only when kept
+	end := len(lines)
+	for end > 0 && lines[end-1] == "" {
+		end--
+	}
+	p.pos -= len(lines) - end
+	trailing := len(lines) - end
+	lines = lines[:end]
+
+	var b strings.Builder
+	for i, l := range lines {
+		if i > 0 {
+			if folded && l != "" && lines[i-1] != "" && !strings.HasPrefix(l, " ") && !strings.HasPrefix(lines[i-1], " ") {
+				b.WriteByte(' ')
+			} else if !folded || lines[i-1] != "" || l == "" {
+				b.WriteByte('\n')
+			}
+		}
+		b.WriteString(l)
+	}
+
+	switch {
+	case len(lines) == 0:
+	case chomping == '+':
+		b.WriteString(strings.Repeat("\n", trailing+1))
+	case chomping == 0:
+		b.WriteByte('\n')
+	}
+	return b.String(), nil
+}
+
+// yamlStripComment removes the comment at the end of a line
+func yamlStripComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote == '\'' && c == '\'':
+			quote = 0
+		case quote == '"' && c == '\\':
+			i++
+		case quote == '"' && c == '"':
+			quote = 0
+		case quote != 0:
+		case (c == '"' || c == '\'') && (i == 0 || strings.IndexByte(" [{,:-", line[i-1]) >= 0):
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return strings.TrimRight(line[:i], " \t")
+		}
+	}
+	return strings.TrimRight(line, " \t")
+}
+
+// yamlSplitKey splits a "key: value" line into its key and value
+func yamlSplitKey(text string) (key, rest string, ok bool) {
+	if text == "" || strings.IndexByte("[{-", text[0]) >= 0 && (text[0] != '-' || strings.HasPrefix(text, "- ") || text == "-") {
+		return "", "", false
+	}
+
+	if text[0] == '"' || text[0] == '\'' {
+		unquoted, after, err := yamlUnquote(text)
+		if err != nil || !strings.HasPrefix(after, ":") || len(after) > 1 && after[1] != ' ' {
+			return "", "", false
+		}
+		return unquoted, strings.TrimSpace(after[1:]), true
+	}
+
+	for i := 0; i < len(text); i++ {
+		if text[i] == ':' && (i == len(text)-1 || text[i+1] == ' ') {
+			return strings.TrimRight(text[:i], " "), strings.TrimSpace(text[i+1:]), true
+		}
+	}
+	return "", "", false
+}
+
+// yamlUnquote parses the quoted scalar at the start of s and returns it with
+// the text following it
+func yamlUnquote(s string) (string, string, error) {
+	quote := s[0]
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == quote && quote == '\'' && i+1 < len(s) && s[i+1] == '\'':
+			b.WriteByte('\'')
+			i++
+		case c == quote:
+			return b.String(), s[i+1:], nil
+		case c == '\\' && quote == '"' && i+1 < len(s):
+			i++
+			switch s[i] {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			case 'r':
+				b.WriteByte('\r')
+			case '0':
+				b.WriteByte(0)
+			case 'x', 'u', 'U':
+				size := map[byte]int{'x': 2, 'u': 4, 'U': 8}[s[i]]
+				if i+size >= len(s) {
+					return "", "", fmt.Errorf("Invalid escape sequence in %s", s)
+				}
+				r, err := strconv.ParseUint(s[i+1:i+1+size], 16, 32)
+				if err != nil {
+					return "", "", fmt.Errorf("Invalid escape sequence in %s", s)
+				}
+				b.WriteRune(rune(r))
+				i += size
+			default:
+				b.WriteByte(s[i])
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", "", fmt.Errorf("Unterminated quoted scalar %s", s)
+}
+
+// yamlFlowClosed tells whether the brackets of a flow collection are balanced
+func yamlFlowClosed(s string) bool {
+	depth := 0
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '[' || c == '{':
+			depth++
+		case c == ']' || c == '}':
+			depth--
+		}
+	}
+	return depth <= 0
+}
+
+// parseYAMLFlow parses the flow collection or scalar at the start of s and
+// returns it with the text following it
+func parseYAMLFlow(s string) (interface{}, string, error) {
+	s = strings.TrimLeft(s, " ")
+	if s == "" {
+		return nil, "", fmt.Errorf("Unexpected end of flow collection")
+	}
+
+	switch s[0] {
+	case '[':
+		sequence := []interface{}{}
+		s = strings.TrimLeft(s[1:], " ")
+		for !strings.HasPrefix(s, "]") {
+			value, rest, err := parseYAMLFlow(s)
+			if err != nil {
+				return nil, "", err
+			}
+			sequence = append(sequence, value)
+			if s, err = yamlFlowSeparator(rest, ']'); err != nil {
+				return nil, "", err
+			}
+		}
+		return sequence, s[1:], nil
+	case '{':
+		mapping := make(map[string]interface{})
+		s = strings.TrimLeft(s[1:], " ")
+		for !strings.HasPrefix(s, "}") {
+			key, rest, err := parseYAMLFlow(s)
+			if err != nil {
+				return nil, "", err
+			}
+			keyString, ok := key.(string)
+			if !ok {
+				return nil, "", fmt.Errorf("Invalid flow mapping key")
+			}
+			var value interface{}
+			if rest = strings.TrimLeft(rest, " "); strings.HasPrefix(rest, ":") {
+				if value, rest, err = parseYAMLFlow(rest[1:]); err != nil {
+					return nil, "", err
+				}
+			}
+			mapping[keyString] = value
+			if s, err = yamlFlowSeparator(rest, '}'); err != nil {
+				return nil, "", err
+			}
+		}
+		return mapping, s[1:], nil
+	case '"', '\'':
+		return yamlUnquote(s)
+	}
+
+	end := strings.IndexAny(s, ",]}")
+	for i := 0; i < len(s) && (end < 0 || i < end); i++ {
+		if s[i] == ':' && (i == len(s)-1 || s[i+1] == ' ') {
+			end = i
+			break
+		}
+	}
+	if end < 0 {
+		end = len(s)
+	}
+	value := strings.TrimRight(s[:end], " ")
+	if value == "~" || value == "null" || value == "" {
+		return nil, s[end:], nil
+	}
+	return value, s[end:], nil
+}
+
+// yamlFlowSeparator skips the comma following an element of a flow
+// collection. The returned text starts with the next element or with the
+// closing bracket.
+func yamlFlowSeparator(s string, closing byte) (string, error) {
+	s = strings.TrimLeft(s, " ")
+	switch {
+	case strings.HasPrefix(s, ","):
+		return strings.TrimLeft(s[1:], " "), nil
+	case s != "" && s[0] == closing:
+		return s, nil
+	}
+	return "", fmt.Errorf("Expected , or %c in flow collection", closing)
+}
@@ -0,0 +1,447 @@
+package misp
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// YaraRuleSet collects the YARA rules of yara attributes into a single rules
+// file. Rules are checked for syntax errors the YARA compiler would report
+// on their structure, renamed when their name is already taken by another
+// rule, and given a meta section pointing back to their event and attribute.
+// Rules referring to other rules by name are not updated when these are
+// renamed.
+type YaraRuleSet struct {
+	// Synthesize, for each event, a rule matching the files whose MD5, SHA-1
+	// or SHA-256 is the value of an attribute, using the YARA hash module
+	HashRules bool
+
+	imports map[string]bool
+	rules   []string
+	names   map[string]string // rule name -> original rule text
+	hashes  map[string][]string
+	order   []string // events with hashes, in order of addition
+	meta    map[string]yaraMeta
+}
+
+// yaraMeta is the metadata identifying an event in rules
+type yaraMeta struct {
+	uuid string
+	id   string
+	info string
+}
+
+// yaraRule is a rule of a yara attribute, with the position of its name and
+// body in its text
+type yaraRule struct {
+	text      string
+	nameStart int
+	nameEnd   int
+	bodyStart int
+}
+
+var (
+	yaraIdentifierRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]{0,127}$`)
+	yaraConditionRegexp  = regexp.MustCompile(`\bcondition\s*:`)
+	yaraMetaRegexp       = regexp.MustCompile(`\bmeta\s*:`)
+)
+
+// yaraHashFunctions are the hash module functions of the hash types
+var yaraHashFunctions = map[string]string{
+	TypeMD5:    "md5",
+	TypeSHA1:   "sha1",
+	TypeSHA256: "sha256",
+}
+
+// AddEvent adds the yara attributes of the event and of its objects, and
+// their hashes if HashRules is set. It returns the errors of the attributes
+// whose rules are invalid and were left out.
+func (s *YaraRuleSet) AddEvent(event *Event) []error {
+	meta := yaraMeta{uuid: event.UUID, id: event.ID, info: event.Info}
+
+	var errs []error
+	add := func(attr *Attribute) {
+		if err := s.add(attr, meta); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for i := range event.Attribute {
+		add(&event.Attribute[i])
+	}
+	for _, object := range event.Objects {
+		if object.Deleted {
+			continue
+		}
+		for i := range object.Attributes {
+			add(&object.Attributes[i])
+		}
+	}
+
+	return errs
+}
+
+// AddAttributes adds yara attributes, such as SearchAttribute results, and
+// their hashes if HashRules is set. Rules refer to their event by ID. It
+// returns the errors of the attributes whose rules are invalid and were left
+// out.
+func (s *YaraRuleSet) AddAttributes(attrs []Attribute) []error {
+	var errs []error
+	for i := range attrs {
+		if err := s.add(&attrs[i], yaraMeta{id: attrs[i].EventID}); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+func (s *YaraRuleSet) init() {
+	if s.names == nil {
+		s.imports = make(map[string]bool)
+		s.names = make(map[string]string)
+		s.hashes = make(map[string][]string)
+		s.meta = make(map[string]yaraMeta)
+	}
+}
+
+func (s *YaraRuleSet) add(attr *Attribute, meta yaraMeta) error {
+	if attr.Deleted {
+		return nil
+	}
+	s.init()
+
+	if s.HashRules {
+		s.addHash(attr, meta)
+	}
+	if attr.Type != TypeYara {
+		return nil
+	}
+
+	imports, rules, err := parseYaraRules(attr.Value)
+	if err != nil {
+		return fmt.Errorf("Attribute %s: %s", attr.UUID, err)
+	}
+	for _, module := range imports {
+		s.imports[module] = true
+	}
+
+	for _, rule := range rules {
+		text := addYaraMeta(rule, meta, attr.UUID)
+		name := rule.text[rule.nameStart:rule.nameEnd]
+
+		// The same rule found in several attributes is kept once
+		unique := name
+		for i := 2; s.names[unique] != "" && s.names[unique] != rule.text; i++ {
+			unique = fmt.Sprintf("%s_%d", name, i)
+		}
+		if s.names[unique] == rule.text {
+			continue
+		}
+		if unique != name {
+			text = text[:rule.nameStart] + unique + text[rule.nameEnd:]
+		}
+
+		s.names[unique] = rule.text
+		s.rules = append(s.rules, text)
+	}
+
+	return nil
+}
+
+func (s *YaraRuleSet) addHash(attr *Attribute, meta yaraMeta) {
+	attrType, value := attr.Type, attr.Value
+	if types := CompositePartTypes(attr.Type); len(types) == 2 && types[0] == TypeFilename {
+		if parts, err := attr.Composite(); err == nil {
+			attrType, value = types[1], parts[1]
+		}
+	}
+	function, ok := yaraHashFunctions[attrType]
+	if !ok {
+		return
+	}
+
+	key := defaultString(meta.uuid, meta.id)
+	if _, ok := s.hashes[key]; !ok {
+		s.order = append(s.order, key)
+		s.meta[key] = meta
+	}
+	condition := fmt.Sprintf("hash.%s(0, filesize) == %q", function, strings.ToLower(value))
+	if !containsString(s.hashes[key], condition) {
+		s.hashes[key] = append(s.hashes[key], condition)
+	}
+}
+
+// Write writes the rules file: the imports, the rules of the attributes and
+// the hash rules
+func (s *YaraRuleSet) Write(w io.Writer) error {
+	s.init()
+
+	imports := make([]string, 0, len(s.imports))
+	for module := range s.imports {
+		imports = append(imports, module)
+	}
+	if len(s.order) > 0 && !s.imports["hash"] {
+		imports = append(imports, "hash")
+	}
+	sort.Strings(imports)
+
+	var b strings.Builder
+	for _, module := range imports {
+		fmt.Fprintf(&b, "import %q\n", module)
+	}
+
+	for _, rule := range s.rules {
+		b.WriteString("\n" + rule + "\n")
+	}
+
+	for i, key := range s.order {
+		meta := s.meta[key]
+		var name string
+		switch {
+		case meta.uuid != "":
+			name = "misp_" + strings.Replace(key, "-", "_", -1) + "_hashes"
+		case meta.id != "":
+			name = "misp_e" + key + "_hashes"
+		default:
+			// Attributes of unidentified events, numbered after their
+			// position among the hash rules
+			name = fmt.Sprintf("misp_hashes_%d", i+1)
+		}
+		metaLines := yaraMetaLines(meta, "")
+		if metaLines != "" {
+			metaLines = "\tmeta:\n" + metaLines
+		}
+		fmt.Fprintf(&b, "\nrule %s\n{\n%s\tcondition:\n\t\t%s\n}\n",
+			name, metaLines, strings.Join(s.hashes[key], " or\n\t\t"))
+	}
+
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		return fmt.Errorf("Could not write YARA rules: %s", err)
+	}
+	return nil
+}
+
+// yaraMetaLines returns the meta entries identifying an event and attribute
+func yaraMetaLines(meta yaraMeta, attrUUID string) string {
+	var b strings.Builder
+	entry := func(key, value string) {
+		if value != "" {
+			fmt.Fprintf(&b, "\t\t%s = %s\n", key, yaraQuote(value))
+		}
+	}
+	entry("misp_event_uuid", meta.uuid)
+	entry("misp_event_id", meta.id)
+	entry("misp_event_info", meta.info)
+	entry("misp_attribute_uuid", attrUUID)
+	return b.String()
+}
+
+// addYaraMeta returns the text of the rule with the meta entries identifying
+// its event, unless it already has them
+func addYaraMeta(rule yaraRule, meta yaraMeta, attrUUID string) string {
+	body := rule.text[rule.bodyStart:]
+	if strings.Contains(body, "misp_event_uuid") || strings.Contains(body, "misp_event_id") {
+		return rule.text
+	}
+
+	lines := yaraMetaLines(meta, attrUUID)
+	if lines == "" {
+		return rule.text
+	}
+	lines = strings.TrimSuffix(lines, "\n")
+
+	if loc := yaraMetaRegexp.FindStringIndex(body); loc != nil {
+		at := rule.bodyStart + loc[1]
+		return rule.text[:at] + "\n" + lines + rule.text[at:]
+	}
+	// Rules written on one line continue on the next one
+	rest := rule.text[rule.bodyStart:]
+	if trimmed := strings.TrimLeft(rest, " \t"); !strings.HasPrefix(trimmed, "\n") && !strings.HasPrefix(trimmed, "\r") {
+		rest = "\n\t" + trimmed
+	}
+	return rule.text[:rule.bodyStart] + "\n\tmeta:\n" + lines + rest
+}
+
+// parseYaraRules splits YARA source into its imported modules and its rules,
+// checking the structure of each rule: modifiers, name, tags, balanced
+// braces, terminated strings and regular expressions, and a condition
+func parseYaraRules(source string) ([]string, []yaraRule, error) {
+	var imports []string
+	var rules []yaraRule
+
+	i := 0
+	skip := func() error {
+		for i < len(source) {
+			switch {
+			case strings.ContainsRune(" \t\r\n", rune(source[i])):
+				i++
+			case strings.HasPrefix(source[i:], "//"):
+				end := strings.IndexByte(source[i:], '\n')
+				if end < 0 {
+					i = len(source)
+				} else {
+					i += end
+				}
+			case strings.HasPrefix(source[i:], "/*"):
+				end := strings.Index(source[i+2:], "*/")
+				if end < 0 {
+					return fmt.Errorf("Unterminated comment")
+				}
+				i += end + 4
+			default:
+				return nil
+			}
+		}
+		return nil
+	}
+	word := func() string {
+		start := i
+		for i < len(source) && (source[i] == '_' || source[i] >= 'a' && source[i] <= 'z' ||
+			source[i] >= 'A' && source[i] <= 'Z' || source[i] >= '0' && source[i] <= '9') {
+			i++
+		}
+		return source[start:i]
+	}
+
+	for {
+		if err := skip(); err != nil {
+			return nil, nil, err
+		}
+		if i >= len(source) {
+			break
+		}
+
+		start := i
+		keyword := word()
+		switch keyword {
+		case "import":
+			if err := skip(); err != nil {
+				return nil, nil, err
+			}
+			if i >= len(source) || source[i] != '"' {
+				return nil, nil, fmt.Errorf("Invalid import")
+			}
+			end := strings.IndexByte(source[i+1:], '"')
+			if end < 0 {
+				return nil, nil, fmt.Errorf("Invalid import")
+			}
+			imports = append(imports, source[i+1:i+1+end])
+			i += end + 2
+			continue
+		case "include":
+			return nil, nil, fmt.Errorf("Includes are not supported")
+		}
+
+		for keyword == "private" || keyword == "global" {
+			if err := skip(); err != nil {
+				return nil, nil, err
+			}
+			keyword = word()
+		}
+		if keyword != "rule" {
+			return nil, nil, fmt.Errorf("Unexpected %q", strings.SplitN(source[start:], "\n", 2)[0])
+		}
+
+		if err := skip(); err != nil {
+			return nil, nil, err
+		}
+		nameStart := i
+		name := word()
+		if !yaraIdentifierRegexp.MatchString(name) || name == "rule" || name == "condition" {
+			return nil, nil, fmt.Errorf("Invalid rule name %q", name)
+		}
+		nameEnd := i
+
+		// Tags
+		if err := skip(); err != nil {
+			return nil, nil, err
+		}
+		if i < len(source) && source[i] == ':' {
+			i++
+			for {
+				if err := skip(); err != nil {
+					return nil, nil, err
+				}
+				if tag := word(); tag == "" {
+					break
+				}
+			}
+		}
+		if i >= len(source) || source[i] != '{' {
+			return nil, nil, fmt.Errorf("Rule %s: expected {", name)
+		}
+		bodyStart := i + 1
+
+		end, err := yaraRuleEnd(source, bodyStart)
+		if err != nil {
+			return nil, nil, fmt.Errorf("Rule %s: %s", name, err)
+		}
+		if !yaraConditionRegexp.MatchString(source[bodyStart:end]) {
+			return nil, nil, fmt.Errorf("Rule %s: missing condition", name)
+		}
+		i = end + 1
+
+		rules = append(rules, yaraRule{
+			text:      source[start:i],
+			nameStart: nameStart - start,
+			nameEnd:   nameEnd - start,
+			bodyStart: bodyStart - start,
+		})
+	}
+
+	if len(rules) == 0 {
+		return nil, nil, fmt.Errorf("No rule")
+	}
+	return imports, rules, nil
+}
+
+// yaraRuleEnd returns the position of the brace closing the body of a rule
+// starting at i, skipping strings, regular expressions and comments
+func yaraRuleEnd(source string, i int) (int, error) {
+	depth := 1
+	var previous byte
+	for ; i < len(source); i++ {
+		c := source[i]
+		switch {
+		case c == '"' || c == '/' && previous == '=':
+			end := i + 1
+			for ; end < len(source) && source[end] != c && source[end] != '\n'; end++ {
+				if source[end] == '\\' {
+					end++
+				}
+			}
+			if end >= len(source) || source[end] != c {
+				return 0, fmt.Errorf("Unterminated string or regular expression")
+			}
+			i = end
+		case strings.HasPrefix(source[i:], "//"):
+			for i < len(source) && source[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(source[i:], "/*"):
+			end := strings.Index(source[i+2:], "*/")
+			if end < 0 {
+				return 0, fmt.Errorf("Unterminated comment")
+			}
+			i += end + 3
+		case c == '{':
+			depth++
+		case c == '}':
+			depth--
+			if depth == 0 {
+				return i, nil
+			}
+		}
+		if !strings.ContainsRune(" \t\r\n", rune(c)) {
+			previous = c
+		}
+	}
+	return 0, fmt.Errorf("Unbalanced braces")
+}
+
+// yaraQuote returns s as a YARA text string
+func yaraQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "\t", `\t`).Replace(s) + `"`
+}
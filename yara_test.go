@@ -0,0 +1,82 @@
+package misp
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func Test_YaraRuleSet(t *testing.T) {
+	event := &Event{
+		UUID: "58b9864a-b6ec-4fa6-a5e6-4a9a0a3ac101",
+		Info: `Dropper "invoice"`,
+		Attribute: []Attribute{
+			{UUID: "5a1b1d2e-0c54-4e2b-a1c7-000000000001", Type: TypeYara, Value: `import "pe"
+
+rule dropper : loader
+{
+	meta:
+		author = "CERT"
+	strings:
+		$a = "invoice {" // brace in a string
+		$b = { 4D 5A [2-4] 90 }
+		$c = /inv[0-9]{2}\//
+	condition:
+		pe.is_pe and any of them
+}
+
+private rule helper { condition: filesize < 1MB }`},
+			{UUID: "5a1b1d2e-0c54-4e2b-a1c7-000000000002", Type: TypeYara, Value: "rule dropper { condition: false }"},
+			{UUID: "5a1b1d2e-0c54-4e2b-a1c7-000000000003", Type: TypeYara, Value: "rule broken { strings: $a = \"x\" }"},
+			{UUID: "5a1b1d2e-0c54-4e2b-a1c7-000000000004", Type: TypeYara, Value: "rule unbalanced { condition: true "},
+			{Type: TypeMD5, Value: "68B329DA9893E34099C7D8AD5CB9C940"},
+			{Type: TypeFilenameSHA256, Value: "invoice.exe|e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"},
+			{Type: TypeSHA512, Value: "ignored"},
+		},
+	}
+
+	set := &YaraRuleSet{HashRules: true}
+	errs := set.AddEvent(event)
+	if len(errs) != 2 || !strings.Contains(errs[0].Error(), "missing condition") || !strings.Contains(errs[1].Error(), "Unbalanced") {
+		t.Errorf("Unexpected errors %v", errs)
+	}
+
+	// The same rule from another source is not duplicated
+	errs = set.AddAttributes([]Attribute{{EventID: "12", Type: TypeYara, Value: "rule dropper { condition: false }"}})
+	if len(errs) != 0 {
+		t.Errorf("Unexpected errors %v", errs)
+	}
+
+	// Hash rules are named after the event ID, or numbered without one
+	errs = set.AddAttributes([]Attribute{
+		{EventID: "13", Type: TypeSHA1, Value: "da39a3ee5e6b4b0d3255bfef95601890afd80709"},
+		{Type: TypeMD5, Value: "d41d8cd98f00b204e9800998ecf8427e"},
+	})
+	if len(errs) != 0 {
+		t.Errorf("Unexpected errors %v", errs)
+	}
+
+	var buf bytes.Buffer
+	if err := set.Write(&buf); err != nil {
+		t.Fatalf("Write returned error: %s", err)
+	}
+	rules := buf.String()
+
+	for _, want := range []string{
+		"import \"hash\"\nimport \"pe\"\n\nrule dropper : loader\n{\n\tmeta:\n\t\tmisp_event_uuid = \"58b9864a-b6ec-4fa6-a5e6-4a9a0a3ac101\"\n\t\tmisp_event_info = \"Dropper \\\"invoice\\\"\"\n\t\tmisp_attribute_uuid = \"5a1b1d2e-0c54-4e2b-a1c7-000000000001\"\n\t\tauthor = \"CERT\"",
+		"private rule helper {\n\tmeta:\n",
+		"\t\tmisp_attribute_uuid = \"5a1b1d2e-0c54-4e2b-a1c7-000000000002\"\n\tcondition: false }\n",
+		"rule dropper_2 {\n\tmeta:\n",
+		"rule misp_58b9864a_b6ec_4fa6_a5e6_4a9a0a3ac101_hashes\n{\n\tmeta:\n\t\tmisp_event_uuid = \"58b9864a-b6ec-4fa6-a5e6-4a9a0a3ac101\"\n",
+		"\tcondition:\n\t\thash.md5(0, filesize) == \"68b329da9893e34099c7d8ad5cb9c940\" or\n\t\thash.sha256(0, filesize) == \"e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855\"\n}\n",
+		"rule misp_e13_hashes\n{\n\tmeta:\n\t\tmisp_event_id = \"13\"\n",
+		"rule misp_hashes_3\n{\n\tcondition:\n\t\thash.md5(0, filesize) == \"d41d8cd98f00b204e9800998ecf8427e\"\n}\n",
+	} {
+		if !strings.Contains(rules, want) {
+			t.Errorf("Rules do not contain %q:\n%s", want, rules)
+		}
+	}
+	if strings.Count(rules, "rule dropper") != 2 || strings.Contains(rules, "broken") || strings.Contains(rules, "misp_event_id = \"12\"") {
+		t.Errorf("Unexpected rules:\n%s", rules)
+	}
+}
@@ -0,0 +1,201 @@
+package misp
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// zeekIntelTypes maps MISP attribute types to Zeek Intel framework indicator
+// types. Composite types are mapped part by part, see zeekIndicators.
+var zeekIntelTypes = map[string]string{
+	TypeIPSrc:                 "Intel::ADDR",
+	TypeIPDst:                 "Intel::ADDR",
+	TypeDomain:                "Intel::DOMAIN",
+	TypeHostname:              "Intel::DOMAIN",
+	TypeURL:                   "Intel::URL",
+	TypeURI:                   "Intel::URL",
+	TypeMD5:                   "Intel::FILE_HASH",
+	TypeSHA1:                  "Intel::FILE_HASH",
+	TypeSHA256:                "Intel::FILE_HASH",
+	TypeSHA512:                "Intel::FILE_HASH",
+	TypeFilename:              "Intel::FILE_NAME",
+	TypeEmail:                 "Intel::EMAIL",
+	TypeEmailSrc:              "Intel::EMAIL",
+	TypeEmailDst:              "Intel::EMAIL",
+	TypeX509FingerprintMD5:    "Intel::CERT_HASH",
+	TypeX509FingerprintSHA1:   "Intel::CERT_HASH",
+	TypeX509FingerprintSHA256: "Intel::CERT_HASH",
+	TypeUserAgent:             "Intel::SOFTWARE",
+	TypeTargetUser:            "Intel::USER_NAME",
+}
+
+// zeekHeader is the header of Intel framework files
+const zeekHeader = "#fields\tindicator\tindicator_type\tmeta.source\tmeta.desc\tmeta.url\tmeta.do_notice\n"
+
+// ZeekIntelExporter writes indicators in the TSV format of the Zeek Intel
+// framework. IP addresses map to Intel::ADDR, or Intel::SUBNET for networks,
+// domains and hostnames to Intel::DOMAIN, URLs to Intel::URL without scheme,
+// file hashes to Intel::FILE_HASH, file names to Intel::FILE_NAME, email
+// addresses to Intel::EMAIL, certificate fingerprints to Intel::CERT_HASH,
+// target users to Intel::USER_NAME and user agents to Intel::SOFTWARE, the
+// type Zeek checks user agents against.
+// Each part of composite attributes is exported on its own.
+type ZeekIntelExporter struct {
+	BlocklistFilter
+
+	// meta.source of the indicators, by default MISP
+	Source string
+
+	// Base URL of the MISP instance. When set, meta.url links to the event of
+	// each indicator.
+	BaseURL string
+
+	// meta.do_notice of the indicators, to raise a notice on matches when
+	// the do_notice policy script is loaded
+	DoNotice bool
+}
+
+// Write writes the indicators of attributes such as SearchAttribute results.
+// meta.desc is the comment of the attribute.
+func (e *ZeekIntelExporter) Write(w io.Writer, attrs []Attribute) error {
+	var b strings.Builder
+	b.WriteString(zeekHeader)
+
+	seen := make(map[string]bool)
+	for i := range attrs {
+		e.writeAttribute(&b, &attrs[i], "", seen)
+	}
+
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		return fmt.Errorf("Could not write Zeek intel: %s", err)
+	}
+	return nil
+}
+
+// WriteEvents writes the indicators of events, including those of their
+// objects. meta.desc is the event info, followed by the attribute comment.
+func (e *ZeekIntelExporter) WriteEvents(w io.Writer, events []Event) error {
+	var b strings.Builder
+	b.WriteString(zeekHeader)
+
+	seen := make(map[string]bool)
+	for _, event := range events {
+		write := func(attr Attribute) {
+			attr.EventID = defaultString(attr.EventID, event.ID)
+			e.writeAttribute(&b, &attr, event.Info, seen)
+		}
+		for _, attr := range event.Attribute {
+			write(attr)
+		}
+		for _, object := range event.Objects {
+			if object.Deleted {
+				continue
+			}
+			for _, attr := range object.Attributes {
+				write(attr)
+			}
+		}
+	}
+
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		return fmt.Errorf("Could not write Zeek intel: %s", err)
+	}
+	return nil
+}
+
+func (e *ZeekIntelExporter) writeAttribute(b *strings.Builder, attr *Attribute, info string, seen map[string]bool) {
+	if !e.accept(attr) {
+		return
+	}
+
+	desc := attr.Comment
+	if info != "" && desc != "" {
+		desc = info + " - " + desc
+	} else if info != "" {
+		desc = info
+	}
+
+	url := "-"
+	if e.BaseURL != "" && attr.EventID != "" {
+		url = strings.TrimSuffix(e.BaseURL, "/") + "/events/view/" + attr.EventID
+	}
+
+	doNotice := "F"
+	if e.DoNotice {
+		doNotice = "T"
+	}
+
+	for _, indicator := range zeekIndicators(attr) {
+		key := indicator[0] + "\t" + indicator[1]
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		fields := []string{indicator[0], indicator[1], defaultString(e.Source, "MISP"), desc, url, doNotice}
+		for i, field := range fields {
+			fields[i] = zeekField(field)
+		}
+		b.WriteString(strings.Join(fields, "\t") + "\n")
+	}
+}
+
+// zeekIndicators returns the indicators and indicator types of an attribute
+func zeekIndicators(attr *Attribute) [][2]string {
+	types := []string{attr.Type}
+	values := []string{attr.Value}
+	if parts, err := attr.Composite(); err == nil {
+		types = CompositePartTypes(attr.Type)
+		values = parts
+	}
+
+	var indicators [][2]string
+	for i, attrType := range types {
+		intelType := zeekIntelTypes[attrType]
+		if intelType == "" {
+			continue
+		}
+
+		value := strings.TrimSpace(values[i])
+		switch intelType {
+		case "Intel::ADDR":
+			if strings.Contains(value, "/") {
+				network, err := parseNetwork(value)
+				if err != nil {
+					continue
+				}
+				if ones, bits := network.Mask.Size(); ones != bits {
+					intelType, value = "Intel::SUBNET", network.String()
+				} else {
+					value = network.IP.String()
+				}
+			}
+		case "Intel::URL":
+			// Zeek matches URLs without their scheme
+			if i := strings.Index(value, "://"); i >= 0 {
+				value = value[i+3:]
+			}
+		case "Intel::DOMAIN", "Intel::EMAIL", "Intel::FILE_HASH", "Intel::CERT_HASH":
+			value = strings.ToLower(value)
+		}
+
+		indicators = append(indicators, [2]string{value, intelType})
+	}
+
+	return indicators
+}
+
+// zeekField returns value as a TSV field, "-" standing for empty fields
+func zeekField(value string) string {
+	value = strings.Map(func(r rune) rune {
+		if r == '\t' || r == '\n' || r == '\r' {
+			return ' '
+		}
+		return r
+	}, value)
+	if value == "" {
+		return "-"
+	}
+	return value
+}
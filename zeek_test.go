@@ -0,0 +1,56 @@
+package misp
+
+import (
+	"bytes"
+	"testing"
+)
+
+func Test_ZeekIntelExporter(t *testing.T) {
+	attrs := []Attribute{
+		{EventID: "42", Type: TypeIPDst, Value: "203.0.113.9", ToIDS: true, Comment: "C2\tserver"},
+		{EventID: "42", Type: TypeIPDst, Value: "203.0.113.0/24", ToIDS: true},
+		{EventID: "42", Type: TypeURL, Value: "https://evil.com/gate.php", ToIDS: true},
+		{EventID: "42", Type: TypeFilenameMD5, Value: "invoice.exe|68B329DA9893E34099C7D8AD5CB9C940", ToIDS: true},
+		{EventID: "42", Type: TypeDomainIP, Value: "Evil.com|203.0.113.9", ToIDS: true},
+		{EventID: "43", Type: TypeUserAgent, Value: "EvilBot/1.0", ToIDS: true},
+		{EventID: "43", Type: TypeX509FingerprintSHA1, Value: "a2b5c5e5f6b2e0d4c9e0a1b2c3d4e5f6a7b8c9d0", ToIDS: true},
+		{EventID: "43", Type: TypeEmailSrc, Value: "phish@evil.com"},
+		{EventID: "43", Type: TypeMutex, Value: "Global\\evil", ToIDS: true},
+	}
+
+	exporter := &ZeekIntelExporter{
+		BlocklistFilter: BlocklistFilter{OnlyIDS: true},
+		BaseURL:         "https://misp.local/",
+	}
+
+	var buf bytes.Buffer
+	if err := exporter.Write(&buf, attrs); err != nil {
+		t.Fatalf("Write returned error: %s", err)
+	}
+
+	want := "#fields\tindicator\tindicator_type\tmeta.source\tmeta.desc\tmeta.url\tmeta.do_notice\n" +
+		"203.0.113.9\tIntel::ADDR\tMISP\tC2 server\thttps://misp.local/events/view/42\tF\n" +
+		"203.0.113.0/24\tIntel::SUBNET\tMISP\t-\thttps://misp.local/events/view/42\tF\n" +
+		"evil.com/gate.php\tIntel::URL\tMISP\t-\thttps://misp.local/events/view/42\tF\n" +
+		"invoice.exe\tIntel::FILE_NAME\tMISP\t-\thttps://misp.local/events/view/42\tF\n" +
+		"68b329da9893e34099c7d8ad5cb9c940\tIntel::FILE_HASH\tMISP\t-\thttps://misp.local/events/view/42\tF\n" +
+		"evil.com\tIntel::DOMAIN\tMISP\t-\thttps://misp.local/events/view/42\tF\n" +
+		"EvilBot/1.0\tIntel::SOFTWARE\tMISP\t-\thttps://misp.local/events/view/43\tF\n" +
+		"a2b5c5e5f6b2e0d4c9e0a1b2c3d4e5f6a7b8c9d0\tIntel::CERT_HASH\tMISP\t-\thttps://misp.local/events/view/43\tF\n"
+	if buf.String() != want {
+		t.Errorf("Expected:\n%s\ngot:\n%s", want, buf.String())
+	}
+
+	exporter = &ZeekIntelExporter{Source: "CIRCL", DoNotice: true}
+	buf.Reset()
+	event := Event{ID: "7", Info: "Phishing", Attribute: []Attribute{{Type: TypeEmailSrc, Value: "phish@evil.com", Comment: "sender"}}}
+	if err := exporter.WriteEvents(&buf, []Event{event}); err != nil {
+		t.Fatalf("WriteEvents returned error: %s", err)
+	}
+
+	want = "#fields\tindicator\tindicator_type\tmeta.source\tmeta.desc\tmeta.url\tmeta.do_notice\n" +
+		"phish@evil.com\tIntel::EMAIL\tCIRCL\tPhishing - sender\t-\tT\n"
+	if buf.String() != want {
+		t.Errorf("Expected:\n%s\ngot:\n%s", want, buf.String())
+	}
+}